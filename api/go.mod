@@ -4,6 +4,7 @@ go 1.18
 
 require (
 	github.com/go-piv/piv-go v1.10.0
+	github.com/gofrs/flock v0.8.1
 	github.com/gogo/protobuf v1.3.2
 	github.com/google/go-cmp v0.5.9
 	github.com/gravitational/trace v1.1.19
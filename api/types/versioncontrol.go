@@ -0,0 +1,252 @@
+/*
+Copyright 2022 Gravitational, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gravitational/trace"
+)
+
+// execScriptTypePattern matches the kebab-case identifiers used as execution types.
+var execScriptTypePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ExecScriptCodeTimeout is a sentinel exit code recorded in ExecScriptResult
+// when a script was killed because its timeout elapsed, distinguishing
+// timeouts from ordinary failures.
+const ExecScriptCodeTimeout = -2
+
+// ExecScript size limits applied by Check. These are variables rather than
+// constants so specialized deployments can tune them; most callers should
+// keep the defaults.
+var (
+	// ExecScriptMinScriptSize is the minimum accepted size of a script body
+	// in bytes.
+	ExecScriptMinScriptSize = 1
+	// ExecScriptMaxScriptSize is the maximum accepted size of a script body
+	// in bytes. Scripts are persisted to disk by the executor, so unbounded
+	// bodies would only fail later and less clearly.
+	ExecScriptMaxScriptSize = 1024 * 1024
+	// ExecScriptMaxEnvSize is the maximum accepted total size of Env in
+	// bytes, counting both names and values.
+	ExecScriptMaxEnvSize = 256 * 1024
+	// ExecScriptMaxTimeout is the maximum accepted value of Timeout. Absurdly
+	// large timeouts are almost always a unit confusion on the caller's part
+	// and are better rejected up front than diagnosed in the executor.
+	ExecScriptMaxTimeout = 24 * time.Hour
+	// ExecScriptArgDeniedChars lists shell metacharacters rejected in script
+	// arguments. Arguments are passed to the interpreter verbatim rather than
+	// through a shell, but installer scripts routinely interpolate them into
+	// shell commands, so characters that would change the meaning of such a
+	// command are rejected up front. Deployments whose scripts never
+	// interpolate arguments can narrow the set.
+	ExecScriptArgDeniedChars = "`$|&;<>(){}"
+)
+
+// ExecScript describes a script to be run by a node-local script executor,
+// along with the environment it should run in.
+type ExecScript struct {
+	// Type is the kebab-case type of this execution (e.g. "install").
+	Type string `json:"type"`
+	// ID distinguishes this execution from other executions of the same type.
+	ID uint64 `json:"id"`
+	// Script is the script body to execute.
+	Script string `json:"script"`
+	// Args are positional arguments passed to the script, allowing values to
+	// be supplied at run time without embedding them in the script body.
+	Args []string `json:"args,omitempty"`
+	// Shell is the interpreter directive used to run the script, either a
+	// bare interpreter path or an interpreter with a single argument
+	// (e.g. "/usr/bin/env bash"). Defaults to "/bin/sh" when unset.
+	Shell string `json:"shell,omitempty"`
+	// WorkingDir is the directory the script runs from. Must be an absolute
+	// path when set. Defaults to the executor-managed state directory when
+	// unset.
+	WorkingDir string `json:"working_dir,omitempty"`
+	// Env are environment variables set for the script. Values may reference
+	// EnvPassthrough variables and other Env entries with ${VAR} syntax
+	// (e.g. "${PATH}:/opt/teleport/bin"); undefined references expand to the
+	// empty string.
+	Env map[string]string `json:"env,omitempty"`
+	// EnvPassthrough lists host environment variables passed through to the
+	// script when present in the host environment.
+	EnvPassthrough []string `json:"env_passthrough,omitempty"`
+	// Timeout bounds how long the script may run before it is killed. Zero
+	// means no timeout.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// EqualSpec reports whether two scripts describe the same work, ignoring the
+// execution identity (Type and ID). Env passthrough lists are compared
+// order-insensitively since reordering them does not change behavior. This
+// lets reconcilers skip re-running a script whose parameters have not
+// meaningfully changed.
+func (s *ExecScript) EqualSpec(other ExecScript) bool {
+	if s.Script != other.Script || s.Shell != other.Shell || s.WorkingDir != other.WorkingDir || s.Timeout != other.Timeout {
+		return false
+	}
+
+	if len(s.Args) != len(other.Args) {
+		return false
+	}
+	for i, arg := range s.Args {
+		if other.Args[i] != arg {
+			return false
+		}
+	}
+
+	if len(s.Env) != len(other.Env) {
+		return false
+	}
+	for name, val := range s.Env {
+		if otherVal, ok := other.Env[name]; !ok || otherVal != val {
+			return false
+		}
+	}
+
+	if len(s.EnvPassthrough) != len(other.EnvPassthrough) {
+		return false
+	}
+	passthrough := make(map[string]struct{}, len(s.EnvPassthrough))
+	for _, name := range s.EnvPassthrough {
+		passthrough[name] = struct{}{}
+	}
+	for _, name := range other.EnvPassthrough {
+		if _, ok := passthrough[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Check verifies that all required parameters are present and valid.
+func (s *ExecScript) Check() error {
+	if s.Type == "" {
+		return trace.BadParameter("exec script missing required parameter 'type'")
+	}
+
+	if !execScriptTypePattern.MatchString(s.Type) {
+		return trace.BadParameter("exec script type %q is not valid kebab-case", s.Type)
+	}
+
+	if s.Script == "" {
+		return trace.BadParameter("exec script missing required parameter 'script'")
+	}
+
+	if len(s.Script) < ExecScriptMinScriptSize {
+		return trace.BadParameter("exec script body is %d bytes, below the minimum of %d", len(s.Script), ExecScriptMinScriptSize)
+	}
+
+	if len(s.Script) > ExecScriptMaxScriptSize {
+		return trace.BadParameter("exec script body is %d bytes, exceeding the maximum of %d", len(s.Script), ExecScriptMaxScriptSize)
+	}
+
+	var envSize int
+	for name, val := range s.Env {
+		envSize += len(name) + len(val)
+		if err := checkEnvRefs(val); err != nil {
+			return trace.BadParameter("exec script env %q: %v", name, err)
+		}
+	}
+	if envSize > ExecScriptMaxEnvSize {
+		return trace.BadParameter("exec script env is %d bytes, exceeding the maximum of %d", envSize, ExecScriptMaxEnvSize)
+	}
+
+	for i, arg := range s.Args {
+		if arg == "" {
+			return trace.BadParameter("exec script argument %d must not be empty", i+1)
+		}
+		if idx := strings.IndexAny(arg, ExecScriptArgDeniedChars); idx >= 0 {
+			return trace.BadParameter("exec script argument %d contains shell metacharacter %q", i+1, arg[idx])
+		}
+	}
+
+	if s.WorkingDir != "" && !filepath.IsAbs(s.WorkingDir) {
+		return trace.BadParameter("exec script working dir %q must be an absolute path", s.WorkingDir)
+	}
+
+	if s.Timeout < 0 {
+		return trace.BadParameter("exec script timeout must not be negative (got %v)", s.Timeout)
+	}
+
+	if s.Timeout > ExecScriptMaxTimeout {
+		return trace.BadParameter("exec script timeout %v exceeds the maximum of %v", s.Timeout, ExecScriptMaxTimeout)
+	}
+
+	return nil
+}
+
+// execEnvRefNamePattern matches valid variable names within ${VAR} references.
+var execEnvRefNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkEnvRefs validates ${VAR} reference syntax within an env value: every
+// "${" must be terminated by "}" and enclose a valid variable name. The
+// references themselves are resolved by the executor at run time.
+func checkEnvRefs(val string) error {
+	for i := 0; i+1 < len(val); i++ {
+		if val[i] != '$' || val[i+1] != '{' {
+			continue
+		}
+
+		end := strings.IndexByte(val[i+2:], '}')
+		if end < 0 {
+			return trace.BadParameter("unterminated ${ reference")
+		}
+
+		if name := val[i+2 : i+2+end]; !execEnvRefNamePattern.MatchString(name) {
+			return trace.BadParameter("invalid variable reference ${%s}", name)
+		}
+
+		i += 2 + end
+	}
+
+	return nil
+}
+
+// ExecScriptResult describes the outcome of a script execution.
+type ExecScriptResult struct {
+	// Type is the type of the execution this result belongs to.
+	Type string `json:"type"`
+	// ID is the id of the execution this result belongs to.
+	ID uint64 `json:"id"`
+	// Success is true if the script ran to completion with a zero exit code.
+	Success bool `json:"success"`
+	// Code is the script's exit code. Killed scripts record -1, and scripts
+	// killed due to timeout record ExecScriptCodeTimeout.
+	Code int `json:"code"`
+	// Error describes why the execution failed, if it did.
+	Error string `json:"error,omitempty"`
+	// OutputTruncated is true if the script produced more output than the
+	// executor's output cap and the excess was discarded.
+	OutputTruncated bool `json:"output_truncated,omitempty"`
+	// Signal is the name of the signal that ultimately stopped the script,
+	// if it was stopped due to timeout or cancellation.
+	Signal string `json:"signal,omitempty"`
+	// StartTime is the time at which the script started running.
+	StartTime time.Time `json:"start_time,omitempty"`
+	// EndTime is the time at which the execution completed.
+	EndTime time.Time `json:"end_time,omitempty"`
+	// Time is the time at which the execution completed. Deprecated in favor
+	// of EndTime, but still populated for backward compatibility.
+	Time time.Time `json:"time"`
+}
+
+// Duration returns how long the script ran for.
+func (r *ExecScriptResult) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2023 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecScriptCheckSizeLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		script    string
+		env       map[string]string
+		expectErr bool
+	}{
+		{
+			name:      "empty script",
+			script:    "",
+			expectErr: true,
+		},
+		{
+			name:   "normal script",
+			script: "#!/bin/sh\necho hello\n",
+		},
+		{
+			name:      "oversize script",
+			script:    strings.Repeat("a", ExecScriptMaxScriptSize+1),
+			expectErr: true,
+		},
+		{
+			name:   "script at the limit",
+			script: strings.Repeat("a", ExecScriptMaxScriptSize),
+		},
+		{
+			name:   "normal env",
+			script: "echo hello",
+			env:    map[string]string{"KEY": "value"},
+		},
+		{
+			name:   "oversize env",
+			script: "echo hello",
+			env: map[string]string{
+				"KEY": strings.Repeat("v", ExecScriptMaxEnvSize),
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := ExecScript{
+				Type:   "install",
+				ID:     1,
+				Script: tt.script,
+				Env:    tt.env,
+			}
+			err := script.Check()
+			if tt.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestExecScriptCheckArgs(t *testing.T) {
+	t.Parallel()
+
+	check := func(args ...string) error {
+		script := ExecScript{
+			Type:   "install",
+			ID:     1,
+			Script: "echo hello",
+			Args:   args,
+		}
+		return script.Check()
+	}
+
+	require.NoError(t, check("one", "two-2", "/opt/teleport", "--flag=value"))
+
+	require.Error(t, check("one", ""))
+
+	for _, c := range ExecScriptArgDeniedChars {
+		arg := "prefix" + string(c) + "suffix"
+		err := check(arg)
+		require.Error(t, err, "expected argument %q to be rejected", arg)
+		require.Contains(t, err.Error(), "shell metacharacter")
+	}
+}
+
+func TestExecScriptCheckEnvRefs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		value     string
+		expectErr bool
+	}{
+		{
+			name:  "no references",
+			value: "/opt/teleport/bin",
+		},
+		{
+			name:  "valid reference",
+			value: "${PATH}:/opt/teleport/bin",
+		},
+		{
+			name:  "bare dollar is not a reference",
+			value: "cost is $5",
+		},
+		{
+			name:      "unterminated reference",
+			value:     "${PATH:/opt/teleport/bin",
+			expectErr: true,
+		},
+		{
+			name:      "invalid reference name",
+			value:     "${1BAD}",
+			expectErr: true,
+		},
+		{
+			name:      "empty reference name",
+			value:     "${}",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := ExecScript{
+				Type:   "install",
+				ID:     1,
+				Script: "echo hello",
+				Env:    map[string]string{"KEY": tt.value},
+			}
+			err := script.Check()
+			if tt.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestExecScriptEqualSpec(t *testing.T) {
+	t.Parallel()
+
+	base := ExecScript{
+		Type:           "install",
+		ID:             1,
+		Script:         "echo install",
+		Shell:          "/usr/bin/env bash",
+		Env:            map[string]string{"KEY": "value"},
+		EnvPassthrough: []string{"PATH", "HOME"},
+	}
+
+	tests := []struct {
+		name  string
+		other func(s ExecScript) ExecScript
+		equal bool
+	}{
+		{
+			name:  "identical specs",
+			other: func(s ExecScript) ExecScript { return s },
+			equal: true,
+		},
+		{
+			name: "execution identity ignored",
+			other: func(s ExecScript) ExecScript {
+				s.Type = "reinstall"
+				s.ID = 7
+				return s
+			},
+			equal: true,
+		},
+		{
+			name: "reordered passthrough",
+			other: func(s ExecScript) ExecScript {
+				s.EnvPassthrough = []string{"HOME", "PATH"}
+				return s
+			},
+			equal: true,
+		},
+		{
+			name: "changed script",
+			other: func(s ExecScript) ExecScript {
+				s.Script = "echo something else"
+				return s
+			},
+			equal: false,
+		},
+		{
+			name: "changed env value",
+			other: func(s ExecScript) ExecScript {
+				s.Env = map[string]string{"KEY": "other"}
+				return s
+			},
+			equal: false,
+		},
+		{
+			name: "changed shell",
+			other: func(s ExecScript) ExecScript {
+				s.Shell = "/bin/sh"
+				return s
+			},
+			equal: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.equal, base.EqualSpec(tt.other(base)))
+		})
+	}
+}
+
+func TestExecScriptCheckWorkingDir(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		workingDir string
+		expectErr  bool
+	}{
+		{
+			name:       "empty working dir",
+			workingDir: "",
+		},
+		{
+			name:       "absolute working dir",
+			workingDir: "/opt/teleport",
+		},
+		{
+			name:       "relative working dir",
+			workingDir: "opt/teleport",
+			expectErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := ExecScript{
+				Type:       "install",
+				ID:         1,
+				Script:     "echo hello",
+				WorkingDir: tt.workingDir,
+			}
+			err := script.Check()
+			if tt.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestExecScriptCheckTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		expectErr bool
+	}{
+		{
+			name:    "zero means no timeout",
+			timeout: 0,
+		},
+		{
+			name:    "valid timeout",
+			timeout: time.Minute,
+		},
+		{
+			name:      "negative timeout",
+			timeout:   -time.Second,
+			expectErr: true,
+		},
+		{
+			name:      "over-ceiling timeout",
+			timeout:   ExecScriptMaxTimeout + time.Second,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := ExecScript{
+				Type:    "install",
+				ID:      1,
+				Script:  "echo hello",
+				Timeout: tt.timeout,
+			}
+			err := script.Check()
+			if tt.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -34,6 +34,10 @@ const (
 	// hardware key to generate and store their private keys securely, and
 	// this key must require touch to be accessed and used.
 	PrivateKeyPolicyHardwareKeyTouch PrivateKeyPolicy = "hardware_key_touch"
+	// PrivateKeyPolicyHardwareKeyPIN means that the client must use a valid
+	// hardware key to generate and store their private keys securely, and
+	// this key must require a PIN to be accessed and used.
+	PrivateKeyPolicyHardwareKeyPIN PrivateKeyPolicy = "hardware_key_pin"
 )
 
 // VerifyPolicy verifies that the given policy meets the requirements of this policy.
@@ -44,20 +48,24 @@ func (p PrivateKeyPolicy) VerifyPolicy(policy PrivateKeyPolicy) error {
 	case PrivateKeyPolicyNone:
 		return nil
 	case PrivateKeyPolicyHardwareKey:
-		if policy == PrivateKeyPolicyHardwareKey || policy == PrivateKeyPolicyHardwareKeyTouch {
+		if policy == PrivateKeyPolicyHardwareKey || policy == PrivateKeyPolicyHardwareKeyTouch || policy == PrivateKeyPolicyHardwareKeyPIN {
 			return nil
 		}
 	case PrivateKeyPolicyHardwareKeyTouch:
 		if policy == PrivateKeyPolicyHardwareKeyTouch {
 			return nil
 		}
+	case PrivateKeyPolicyHardwareKeyPIN:
+		if policy == PrivateKeyPolicyHardwareKeyPIN {
+			return nil
+		}
 	}
 	return NewPrivateKeyPolicyError(p)
 }
 
 func (p PrivateKeyPolicy) validate() error {
 	switch p {
-	case PrivateKeyPolicyNone, PrivateKeyPolicyHardwareKey, PrivateKeyPolicyHardwareKeyTouch:
+	case PrivateKeyPolicyNone, PrivateKeyPolicyHardwareKey, PrivateKeyPolicyHardwareKeyTouch, PrivateKeyPolicyHardwareKeyPIN:
 		return nil
 	}
 	return trace.BadParameter("%q is not a valid key policy", p)
@@ -29,16 +29,25 @@ func TestVerifyPolicy(t *testing.T) {
 		require.NoError(t, PrivateKeyPolicyNone.VerifyPolicy(PrivateKeyPolicyNone))
 		require.NoError(t, PrivateKeyPolicyNone.VerifyPolicy(PrivateKeyPolicyHardwareKey))
 		require.NoError(t, PrivateKeyPolicyNone.VerifyPolicy(PrivateKeyPolicyHardwareKeyTouch))
+		require.NoError(t, PrivateKeyPolicyNone.VerifyPolicy(PrivateKeyPolicyHardwareKeyPIN))
 	})
 	t.Run("key policy hardware_key", func(t *testing.T) {
 		require.Error(t, PrivateKeyPolicyHardwareKey.VerifyPolicy(PrivateKeyPolicyNone))
 		require.NoError(t, PrivateKeyPolicyHardwareKey.VerifyPolicy(PrivateKeyPolicyHardwareKey))
 		require.NoError(t, PrivateKeyPolicyHardwareKey.VerifyPolicy(PrivateKeyPolicyHardwareKeyTouch))
+		require.NoError(t, PrivateKeyPolicyHardwareKey.VerifyPolicy(PrivateKeyPolicyHardwareKeyPIN))
 	})
 	t.Run("key policy hardware_key_touch", func(t *testing.T) {
 		require.Error(t, PrivateKeyPolicyHardwareKeyTouch.VerifyPolicy(PrivateKeyPolicyNone))
 		require.Error(t, PrivateKeyPolicyHardwareKeyTouch.VerifyPolicy(PrivateKeyPolicyHardwareKey))
 		require.NoError(t, PrivateKeyPolicyHardwareKeyTouch.VerifyPolicy(PrivateKeyPolicyHardwareKeyTouch))
+		require.Error(t, PrivateKeyPolicyHardwareKeyTouch.VerifyPolicy(PrivateKeyPolicyHardwareKeyPIN))
+	})
+	t.Run("key policy hardware_key_pin", func(t *testing.T) {
+		require.Error(t, PrivateKeyPolicyHardwareKeyPIN.VerifyPolicy(PrivateKeyPolicyNone))
+		require.Error(t, PrivateKeyPolicyHardwareKeyPIN.VerifyPolicy(PrivateKeyPolicyHardwareKey))
+		require.Error(t, PrivateKeyPolicyHardwareKeyPIN.VerifyPolicy(PrivateKeyPolicyHardwareKeyTouch))
+		require.NoError(t, PrivateKeyPolicyHardwareKeyPIN.VerifyPolicy(PrivateKeyPolicyHardwareKeyPIN))
 	})
 }
 
@@ -18,20 +18,28 @@ package keys
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-piv/piv-go/piv"
+	"github.com/gofrs/flock"
 	"github.com/gravitational/trace"
 
 	"github.com/gravitational/teleport/api"
@@ -50,31 +58,49 @@ var (
 	// We use slot 9c for Teleport Clients which require `private_key_policy: hardware_key_touch`.
 	// Private keys generated on this slot will use TouchPolicy=Cached.
 	pivSlotWithTouch = piv.SlotSignature
+	// We use slot 9d for Teleport Clients which require `private_key_policy: hardware_key_pin`.
+	// Private keys generated on this slot will use PINPolicy=Once.
+	pivSlotWithPIN = piv.SlotKeyManagement
 )
 
 // getOrGenerateYubiKeyPrivateKey connects to a connected yubiKey and gets a private key
-// matching the given touch requirement. This private key will either be newly generated
-// or previously generated by a Teleport client and reused.
-func getOrGenerateYubiKeyPrivateKey(touchRequired bool) (*PrivateKey, error) {
-	// Use the first yubiKey we find.
-	y, err := findYubiKey(0)
+// matching the given hardware private key policy. This private key will either be newly
+// generated with the given algorithm or previously generated by a Teleport client and
+// reused. If serialNumber is non-zero, the yubiKey with that serial number is used.
+// Otherwise, the first yubiKey found is used.
+func getOrGenerateYubiKeyPrivateKey(policy PrivateKeyPolicy, algorithm PIVAlgorithm, serialNumber uint32, managementKey *[24]byte) (*PrivateKey, error) {
+	if err := algorithm.checkAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	y, err := findYubiKey(serialNumber)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
+	y.managementKey = managementKey
 
-	// Get the correct PIV slot and Touch policy for the given touch requirement.
-	pivSlot := pivSlotNoTouch
+	// Get the correct PIV slot and PIV policies for the given private key policy.
+	var pivSlot piv.Slot
 	touchPolicy := piv.TouchPolicyNever
-	if touchRequired {
+	pinPolicy := piv.PINPolicyNever
+	switch policy {
+	case PrivateKeyPolicyHardwareKey:
+		pivSlot = pivSlotNoTouch
+	case PrivateKeyPolicyHardwareKeyTouch:
 		pivSlot = pivSlotWithTouch
 		touchPolicy = piv.TouchPolicyCached
+	case PrivateKeyPolicyHardwareKeyPIN:
+		pivSlot = pivSlotWithPIN
+		pinPolicy = piv.PINPolicyOnce
+	default:
+		return nil, trace.BadParameter("private key policy %q is not supported for YubiKey private keys", policy)
 	}
 
 	// First, check if there is already a private key set up by a Teleport Client.
 	priv, err := y.getPrivateKey(pivSlot)
 	if trace.IsNotFound(err) {
 		// Generate a new private key on the PIV slot.
-		if priv, err = y.generatePrivateKey(pivSlot, touchPolicy); err != nil {
+		if priv, err = y.generatePrivateKey(pivSlot, touchPolicy, pinPolicy, algorithm); err != nil {
 			return nil, trace.Wrap(err)
 		}
 	} else if err != nil {
@@ -89,27 +115,54 @@ func getOrGenerateYubiKeyPrivateKey(touchRequired bool) (*PrivateKey, error) {
 	return NewPrivateKey(priv, keyPEM)
 }
 
-// YubiKeyPrivateKey is a YubiKey PIV private key. Cryptographical operations open
-// a new temporary connection to the PIV card to perform the operation.
+// YubiKeyPrivateKey is a YubiKey PIV private key. Cryptographical operations are
+// performed over a shared connection to the PIV card.
 type YubiKeyPrivateKey struct {
 	// yubiKey is a specific yubiKey PIV module.
 	*yubiKey
-	pivSlot piv.Slot
-	pub     crypto.PublicKey
-	signMux sync.Mutex
+	pivSlot   piv.Slot
+	pub       crypto.PublicKey
+	algorithm PIVAlgorithm
+
+	// pinPrompt is an optional callback used to retrieve the PIV PIN for
+	// keys generated with `private_key_policy: hardware_key_pin`.
+	pinPrompt func() (string, error)
+}
+
+// SetPINPrompt sets a callback used to retrieve the YubiKey PIV PIN when this
+// private key requires a PIN to sign.
+func (y *YubiKeyPrivateKey) SetPINPrompt(prompt func() (string, error)) {
+	y.pinPrompt = prompt
+}
+
+// SetTouchPrompt sets a callback invoked when an operation is waiting on the
+// user to touch the YubiKey, in place of the default stderr prompt. Callers
+// like Teleport Connect can use this to surface a touch notification in the UI.
+func (y *YubiKeyPrivateKey) SetTouchPrompt(prompt func()) {
+	y.touchPrompt = prompt
 }
 
 // yubiKeyPrivateKeyData is marshalable data used to retrieve a specific yubiKey PIV private key.
 type yubiKeyPrivateKeyData struct {
-	SerialNumber uint32 `json:"serial_number"`
-	SlotKey      uint32 `json:"slot_key"`
+	SerialNumber uint32       `json:"serial_number"`
+	SlotKey      uint32       `json:"slot_key"`
+	Algorithm    PIVAlgorithm `json:"algorithm,omitempty"`
+	// PublicKey optionally holds the PKIX, ASN.1 DER encoded public key so
+	// that the key can still be loaded if the slot certificate is unreadable.
+	PublicKey []byte `json:"public_key,omitempty"`
 }
 
 func newYubiKeyPrivateKey(y *yubiKey, slot piv.Slot, pub crypto.PublicKey) (*YubiKeyPrivateKey, error) {
+	algorithm, err := pivAlgorithmFromPublicKey(pub)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	return &YubiKeyPrivateKey{
-		yubiKey: y,
-		pivSlot: slot,
-		pub:     pub,
+		yubiKey:   y,
+		pivSlot:   slot,
+		pub:       pub,
+		algorithm: algorithm,
 	}, nil
 }
 
@@ -124,6 +177,10 @@ func parseYubiKeyPrivateKeyData(keyDataBytes []byte) (*YubiKeyPrivateKey, error)
 		return nil, trace.Wrap(err)
 	}
 
+	if err := validatePIVSlot(pivSlot); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	y, err := findYubiKey(keyData.SerialNumber)
 	if err != nil {
 		return nil, trace.Wrap(err)
@@ -131,7 +188,27 @@ func parseYubiKeyPrivateKeyData(keyDataBytes []byte) (*YubiKeyPrivateKey, error)
 
 	priv, err := y.getPrivateKey(pivSlot)
 	if err != nil {
-		return nil, trace.Wrap(err)
+		// If the slot certificate is unreadable, fall back to the public key
+		// embedded in the key PEM, if any. This keeps keys loadable when the
+		// certificate was corrupted or wiped but the private key remains.
+		if len(keyData.PublicKey) == 0 {
+			return nil, trace.Wrap(err)
+		}
+
+		pub, parseErr := x509.ParsePKIXPublicKey(keyData.PublicKey)
+		if parseErr != nil {
+			return nil, trace.NewAggregate(err, parseErr)
+		}
+
+		if priv, parseErr = newYubiKeyPrivateKey(y, pivSlot, pub); parseErr != nil {
+			return nil, trace.NewAggregate(err, parseErr)
+		}
+	}
+
+	// Older key PEMs do not record an algorithm, in which case the public key
+	// recovered from the slot's certificate is trusted as is.
+	if keyData.Algorithm != "" && keyData.Algorithm != priv.algorithm {
+		return nil, trace.BadParameter("expected key algorithm %q, but found a %q key in slot %X", keyData.Algorithm, priv.algorithm, pivSlot.Key)
 	}
 
 	return priv, nil
@@ -143,44 +220,62 @@ func (y *YubiKeyPrivateKey) Public() crypto.PublicKey {
 }
 
 // Sign implements crypto.Signer.
-func (y *YubiKeyPrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
-	// To prevent concurrent calls to Sign from failing due to PIV only handling a
-	// single connection, use a lock to queue through signature requests one at a time.
-	y.signMux.Lock()
-	defer y.signMux.Unlock()
-
-	yk, err := y.open()
-	if err != nil {
-		return nil, trace.Wrap(err)
+func (y *YubiKeyPrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	keyAuth := piv.KeyAuth{}
+	if y.pivSlot == pivSlotWithPIN {
+		if y.pinPrompt == nil {
+			return nil, trace.BadParameter("this YubiKey private key requires a PIN, provide one with SetPINPrompt")
+		}
+		keyAuth = piv.KeyAuth{
+			PINPrompt: y.pinPrompt,
+			PINPolicy: piv.PINPolicyOnce,
+		}
 	}
-	defer yk.Close()
 
-	privateKey, err := yk.PrivateKey(y.pivSlot, y.pub, piv.KeyAuth{})
-	if err != nil {
-		return nil, trace.Wrap(err)
-	}
+	err = y.withConnection(func(yk *piv.YubiKey) error {
+		privateKey, err := yk.PrivateKey(y.pivSlot, y.pub, keyAuth)
+		if err != nil {
+			return trace.Wrap(err)
+		}
 
-	if y.pivSlot == pivSlotWithTouch {
-		cancelTouchPrompt := delayedTouchPrompt(signTouchPromptDelay)
-		defer cancelTouchPrompt()
-	}
+		if y.pivSlot == pivSlotWithTouch {
+			cancelTouchPrompt := y.delayedTouchPrompt(signTouchPromptDelay)
+			defer cancelTouchPrompt()
+		}
 
-	signer, ok := privateKey.(crypto.Signer)
-	if !ok {
-		return nil, trace.BadParameter("private key type %T does not implement crypto.Signer", privateKey)
-	}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return trace.BadParameter("private key type %T does not implement crypto.Signer", privateKey)
+		}
 
-	signature, err := signer.Sign(rand, digest, opts)
+		signature, err = signer.Sign(rand, digest, opts)
+		return trace.Wrap(err)
+	})
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 	return signature, nil
 }
 
+// Close closes the shared PIV connection held for this key's YubiKey, if any,
+// releasing the PIV module for other applications (e.g. on logout). It is safe
+// to call multiple times, and the key remains usable; subsequent operations
+// transparently reopen a connection.
+func (y *YubiKeyPrivateKey) Close() error {
+	return trace.Wrap(y.closeConnection())
+}
+
 func (y *YubiKeyPrivateKey) keyPEM() ([]byte, error) {
+	pubBytes, err := x509.MarshalPKIXPublicKey(y.pub)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	keyDataBytes, err := json.Marshal(yubiKeyPrivateKeyData{
 		SerialNumber: y.serialNumber,
 		SlotKey:      y.pivSlot.Key,
+		Algorithm:    y.algorithm,
+		PublicKey:    pubBytes,
 	})
 	if err != nil {
 		return nil, trace.Wrap(err)
@@ -195,18 +290,19 @@ func (y *YubiKeyPrivateKey) keyPEM() ([]byte, error) {
 
 // GetAttestationStatement returns an AttestationStatement for this YubiKeyPrivateKey.
 func (y *YubiKeyPrivateKey) GetAttestationStatement() (*AttestationStatement, error) {
-	yk, err := y.open()
-	if err != nil {
-		return nil, trace.Wrap(err)
-	}
-	defer yk.Close()
-
-	slotCert, err := yk.Attest(y.pivSlot)
+	// The slot certificate can change when the slot is overwritten, so it
+	// must be re-attested on every call.
+	var slotCert *x509.Certificate
+	err := y.withConnection(func(yk *piv.YubiKey) error {
+		var err error
+		slotCert, err = yk.Attest(y.pivSlot)
+		return trace.Wrap(err)
+	})
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	attCert, err := yk.AttestationCertificate()
+	attCert, err := y.attestationCertificate()
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -227,11 +323,27 @@ func (y *YubiKeyPrivateKey) GetAttestationStatement() (*AttestationStatement, er
 
 // GetPrivateKeyPolicy returns the PrivateKeyPolicy supported by this YubiKeyPrivateKey.
 func (y *YubiKeyPrivateKey) GetPrivateKeyPolicy() PrivateKeyPolicy {
-	switch y.pivSlot {
+	return slotPrivateKeyPolicy(y.pivSlot)
+}
+
+// SatisfiesPolicy returns whether this YubiKeyPrivateKey meets the given
+// required private key policy. Stricter keys satisfy weaker requirements, e.g.
+// a key in the touch slot satisfies `private_key_policy: hardware_key`.
+// Callers can use this to detect a mismatch between a role's requirement and
+// the stored key before a signing attempt fails, and prompt to re-provision.
+func (y *YubiKeyPrivateKey) SatisfiesPolicy(required PrivateKeyPolicy) bool {
+	return required.VerifyPolicy(y.GetPrivateKeyPolicy()) == nil
+}
+
+// slotPrivateKeyPolicy returns the PrivateKeyPolicy supported by keys in the given PIV slot.
+func slotPrivateKeyPolicy(slot piv.Slot) PrivateKeyPolicy {
+	switch slot {
 	case pivSlotNoTouch:
 		return PrivateKeyPolicyHardwareKey
 	case pivSlotWithTouch:
 		return PrivateKeyPolicyHardwareKeyTouch
+	case pivSlotWithPIN:
+		return PrivateKeyPolicyHardwareKeyPIN
 	default:
 		return PrivateKeyPolicyNone
 	}
@@ -244,113 +356,706 @@ type yubiKey struct {
 	card string
 	// serialNumber is the yubiKey's 8 digit serial number.
 	serialNumber uint32
+
+	// connMux serializes operations on the shared PIV connection, since
+	// PIV modules only support a single connection at a time.
+	connMux sync.Mutex
+	// conn is a shared open connection to the yubiKey PIV module. It is
+	// closed after remaining idle for pivConnectionIdleTimeout.
+	conn *piv.YubiKey
+	// idleTimer closes conn once it has gone idle.
+	idleTimer *time.Timer
+	// lastUse records when the shared connection was last used.
+	lastUse time.Time
+
+	// managementKey is an optional custom management key used to authenticate
+	// slot mutations. When nil, piv.DefaultManagementKey is used.
+	managementKey *[24]byte
+
+	// retry configures the retry loop used when opening a connection to the
+	// PIV module. Unset parameters use the defaults in checkAndSetDefaults.
+	retry pivRetryConfig
+
+	// openFunc opens a connection to the PIV module. It may be overridden in
+	// tests to avoid connecting to a real device. When nil, piv.Open is used.
+	openFunc func(card string) (*piv.YubiKey, error)
+
+	// attestationCertMux guards attestationCert.
+	attestationCertMux sync.Mutex
+	// attestationCert caches the yubiKey's attestation certificate, which is
+	// device-wide and immutable, to avoid re-fetching it on every attestation.
+	attestationCert *x509.Certificate
+
+	// touchPrompt is an optional callback invoked when an operation is
+	// waiting on touch. When nil, a prompt is printed to stderr instead.
+	touchPrompt func()
+}
+
+// pivRetryConfig configures the retry loop used when opening a connection to
+// the PIV module.
+type pivRetryConfig struct {
+	// first, step, and max configure the linear backoff between connection attempts.
+	first, step, max time.Duration
+	// timeout bounds the total time spent retrying.
+	timeout time.Duration
+}
+
+// checkAndSetDefaults fills in unset retry parameters with their defaults.
+func (c *pivRetryConfig) checkAndSetDefaults() {
+	if c.first == 0 {
+		// If a PIV connection has just been closed, it take ~5 ms to become
+		// available to new connections. For this reason, we initially wait a
+		// short 10ms before stepping up to a longer 50ms retry.
+		c.first = time.Millisecond * 10
+	}
+	if c.step == 0 {
+		c.step = time.Millisecond * 10
+	}
+	if c.max == 0 {
+		// Since PIV modules only allow a single connection, it is a bottleneck
+		// resource. To maximize usage, we use a short 50ms retry to catch the
+		// connection opening up as soon as possible.
+		c.max = time.Millisecond * 50
+	}
+	if c.timeout == 0 {
+		// Backoff and retry for up to 1 second.
+		c.timeout = time.Second
+	}
+}
+
+// getManagementKey returns the management key used to authenticate slot mutations,
+// defaulting to piv.DefaultManagementKey when no custom key is configured.
+func (y *yubiKey) getManagementKey() [24]byte {
+	if y.managementKey != nil {
+		return *y.managementKey
+	}
+	return piv.DefaultManagementKey
+}
+
+// wrapManagementKeyError adds guidance to management key authentication errors so
+// users know to supply the right management key for their yubiKey.
+func wrapManagementKeyError(err error) error {
+	var authErr piv.AuthErr
+	if errors.As(err, &authErr) {
+		return trace.AccessDenied("failed to authenticate with the YubiKey management key, please supply the management key configured for this YubiKey: %v", err)
+	}
+	return trace.Wrap(err)
+}
+
+// pivConnectionIdleTimeout determines how long the shared PIV connection is
+// kept alive after the last operation before being closed. Other PIV programs
+// cannot connect to the yubiKey while the shared connection is held open.
+const pivConnectionIdleTimeout = time.Second * 5
+
+var (
+	// openConnectionsMu guards openConnections.
+	openConnectionsMu sync.Mutex
+	// openConnections tracks the yubiKeys currently holding a cached PIV
+	// connection, so that closeAllYubiKeys can release them.
+	openConnections = make(map[*yubiKey]struct{})
+)
+
+// closeAllYubiKeys closes the cached PIV connections of all yubiKeys.
+func closeAllYubiKeys() error {
+	openConnectionsMu.Lock()
+	yubiKeys := make([]*yubiKey, 0, len(openConnections))
+	for y := range openConnections {
+		yubiKeys = append(yubiKeys, y)
+	}
+	openConnectionsMu.Unlock()
+
+	var errs []error
+	for _, y := range yubiKeys {
+		errs = append(errs, y.closeConnection())
+	}
+	return trace.NewAggregate(errs...)
 }
 
 func newYubiKey(card string) (*yubiKey, error) {
 	y := &yubiKey{card: card}
 
-	yk, err := y.open()
+	err := y.withConnection(func(yk *piv.YubiKey) error {
+		var err error
+		y.serialNumber, err = yk.Serial()
+		return trace.Wrap(err)
+	})
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
-	defer yk.Close()
 
-	y.serialNumber, err = yk.Serial()
+	return y, nil
+}
+
+// withConnection runs the given function with a shared connection to the yubiKey
+// PIV module. The connection is kept alive for pivConnectionIdleTimeout after the
+// last operation, so that bursts of operations, like Teleport Connect performs on
+// login, reuse a single handle rather than reconnecting for each operation.
+// Operations are serialized since PIV modules only support a single connection.
+func (y *yubiKey) withConnection(fn func(yk *piv.YubiKey) error) error {
+	y.connMux.Lock()
+	defer y.connMux.Unlock()
+
+	if y.conn == nil {
+		conn, err := y.open()
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		y.conn = conn
+
+		openConnectionsMu.Lock()
+		openConnections[y] = struct{}{}
+		openConnectionsMu.Unlock()
+	}
+
+	// Stop the idle timer for the duration of the operation and reset it
+	// once the operation completes.
+	if y.idleTimer != nil {
+		y.idleTimer.Stop()
+	}
+	defer func() {
+		y.lastUse = time.Now()
+		y.idleTimer = time.AfterFunc(pivConnectionIdleTimeout, y.closeIdleConnection)
+	}()
+
+	return fn(y.conn)
+}
+
+// attestationCertificate returns the yubiKey's attestation certificate. The
+// certificate is device-wide and immutable, so it is cached after the first fetch.
+func (y *yubiKey) attestationCertificate() (*x509.Certificate, error) {
+	y.attestationCertMux.Lock()
+	defer y.attestationCertMux.Unlock()
+
+	if y.attestationCert != nil {
+		return y.attestationCert, nil
+	}
+
+	var attCert *x509.Certificate
+	err := y.withConnection(func(yk *piv.YubiKey) error {
+		var err error
+		attCert, err = yk.AttestationCertificate()
+		return trace.Wrap(err)
+	})
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	return y, nil
+	y.attestationCert = attCert
+	return attCert, nil
 }
 
-// generatePrivateKey generates a new private key from the given PIV slot with the given PIV policies.
-func (y *yubiKey) generatePrivateKey(slot piv.Slot, touchPolicy piv.TouchPolicy) (*YubiKeyPrivateKey, error) {
-	yk, err := y.open()
+// closeIdleConnection closes the shared PIV connection once it has gone idle.
+func (y *yubiKey) closeIdleConnection() {
+	y.connMux.Lock()
+	defer y.connMux.Unlock()
+
+	if y.conn == nil {
+		return
+	}
+
+	// The connection was used again after this timer fired but before it
+	// acquired the lock. Leave it open for the newer timer to close.
+	if time.Since(y.lastUse) < pivConnectionIdleTimeout {
+		return
+	}
+
+	y.conn.Close()
+	y.conn = nil
+
+	openConnectionsMu.Lock()
+	delete(openConnections, y)
+	openConnectionsMu.Unlock()
+}
+
+// closeConnection closes the shared PIV connection, if one is cached, and
+// clears the cached connection state. It is idempotent; closing an already
+// closed connection is a no-op. Subsequent operations transparently open a
+// new connection.
+func (y *yubiKey) closeConnection() error {
+	y.connMux.Lock()
+	defer y.connMux.Unlock()
+
+	if y.conn == nil {
+		return nil
+	}
+
+	if y.idleTimer != nil {
+		y.idleTimer.Stop()
+		y.idleTimer = nil
+	}
+
+	err := y.conn.Close()
+	y.conn = nil
+
+	openConnectionsMu.Lock()
+	delete(openConnections, y)
+	openConnectionsMu.Unlock()
+
+	return trace.Wrap(err)
+}
+
+// listYubiKeyTeleportKeys lists the keys present in the PIV slots used by
+// Teleport clients on a connected yubiKey.
+func listYubiKeyTeleportKeys(serialNumber uint32) ([]SlotInfo, error) {
+	y, err := findYubiKey(serialNumber)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
-	defer yk.Close()
 
-	opts := piv.Key{
-		Algorithm:   piv.AlgorithmEC256,
-		PINPolicy:   piv.PINPolicyNever,
-		TouchPolicy: touchPolicy,
+	infos, err := y.listTeleportKeys()
+	if err != nil {
+		return nil, trace.Wrap(err)
 	}
 
-	if slot == pivSlotWithTouch {
-		cancelTouchPrompt := delayedTouchPrompt(generateKeyTouchPromptDelay)
-		defer cancelTouchPrompt()
+	return infos, nil
+}
+
+// listTeleportKeys lists certificates found in the PIV slots used by Teleport
+// clients, including the retired key management slots. Empty slots are skipped,
+// and slots holding foreign certificates are reported with IsTeleport unset
+// rather than failing the scan.
+func (y *yubiKey) listTeleportKeys() ([]SlotInfo, error) {
+	slots := []piv.Slot{pivSlotNoTouch, pivSlotWithTouch}
+	for slotKey := uint32(0x82); slotKey <= 0x95; slotKey++ {
+		if retiredSlot, ok := piv.RetiredKeyManagementSlot(slotKey); ok {
+			slots = append(slots, retiredSlot)
+		}
 	}
 
-	pub, err := yk.GenerateKey(piv.DefaultManagementKey, slot, opts)
+	var infos []SlotInfo
+	err := y.withConnection(func(yk *piv.YubiKey) error {
+		for _, slot := range slots {
+			cert, err := yk.Certificate(slot)
+			if err != nil || cert == nil {
+				// Skip empty slots quietly.
+				continue
+			}
+
+			infos = append(infos, SlotInfo{
+				SerialNumber: y.serialNumber,
+				SlotKey:      slot.Key,
+				Policy:       slotPrivateKeyPolicy(slot),
+				Fingerprint:  certFingerprint(cert),
+				IsTeleport:   len(cert.Subject.Organization) > 0 && cert.Subject.Organization[0] == certOrgName,
+			})
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	// Create a self signed certificate and store it in the PIV slot so that other
-	// Teleport Clients know to reuse the stored key instead of genearting a new one.
-	priv, err := yk.PrivateKey(slot, pub, piv.KeyAuth{})
+	return infos, nil
+}
+
+// migrateYubiKeyRetiredSlotKeys finds a connected yubiKey and migrates any
+// Teleport keys found in its retired key management slots.
+func migrateYubiKeyRetiredSlotKeys(serialNumber uint32, confirm func(info SlotInfo) (bool, error)) ([]SlotInfo, error) {
+	y, err := findYubiKey(serialNumber)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	cert, err := selfSignedTeleportClientCertificate(priv, pub)
+	return y.migrateRetiredSlotKeys(confirm)
+}
+
+// migrateRetiredSlotKeys scans the retired key management slots for Teleport
+// keys and, for each one the confirm callback approves, generates a fresh key
+// in the canonical slot matching its touch policy and clears the retired slot.
+// Returns the migrated keys with their new slot information.
+func (y *yubiKey) migrateRetiredSlotKeys(confirm func(info SlotInfo) (bool, error)) ([]SlotInfo, error) {
+	infos, err := y.listTeleportKeys()
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	// Store a self-signed certificate to mark this slot as used by tsh.
-	if err = yk.SetCertificate(piv.DefaultManagementKey, slot, cert); err != nil {
+	var migrated []SlotInfo
+	for _, info := range infos {
+		if !info.IsTeleport {
+			continue
+		}
+
+		slot, err := parsePIVSlot(info.SlotKey)
+		if err != nil {
+			return migrated, trace.Wrap(err)
+		}
+		if validatePIVSlot(slot) == nil {
+			// The key is already in a canonical slot.
+			continue
+		}
+
+		// Preserve the touch policy where discoverable. Keys whose touch
+		// policy cannot be attested are treated as no-touch.
+		targetSlot := pivSlotNoTouch
+		touchPolicy := piv.TouchPolicyNever
+		if tp, err := y.slotTouchPolicy(slot); err == nil && tp != piv.TouchPolicyNever {
+			targetSlot = pivSlotWithTouch
+			touchPolicy = piv.TouchPolicyCached
+		}
+
+		// Refuse to clobber a Teleport key already in the canonical slot.
+		if _, err := y.getPrivateKey(targetSlot); err == nil {
+			return migrated, trace.BadParameter(
+				"cannot migrate YubiKey slot 0x%x: the %s slot (0x%x) already holds a Teleport key",
+				slot.Key, pivSlotName(targetSlot), targetSlot.Key)
+		}
+
+		if confirm != nil {
+			ok, err := confirm(info)
+			if err != nil {
+				return migrated, trace.Wrap(err)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		// Private keys cannot be moved between PIV slots, so generate a fresh
+		// key in the canonical slot with the same algorithm and clear the
+		// retired one.
+		algorithm, err := y.slotAlgorithm(slot)
+		if err != nil {
+			return migrated, trace.Wrap(err)
+		}
+
+		if _, err := y.generatePrivateKey(targetSlot, touchPolicy, piv.PINPolicyNever, algorithm); err != nil {
+			return migrated, trace.Wrap(err)
+		}
+
+		if err := y.clearSlot(slot); err != nil {
+			return migrated, trace.Wrap(err)
+		}
+
+		info.SlotKey = targetSlot.Key
+		info.Policy = slotPrivateKeyPolicy(targetSlot)
+		migrated = append(migrated, info)
+	}
+
+	return migrated, nil
+}
+
+// slotTouchPolicy returns the touch policy of the key in the given slot, as
+// recorded in its attestation certificate.
+func (y *yubiKey) slotTouchPolicy(slot piv.Slot) (piv.TouchPolicy, error) {
+	// The attestation certificate is fetched up front since
+	// attestationCertificate takes the connection itself.
+	attCert, err := y.attestationCertificate()
+	if err != nil {
+		return 0, trace.Wrap(err)
+	}
+
+	var slotCert *x509.Certificate
+	err = y.withConnection(func(yk *piv.YubiKey) error {
+		var err error
+		slotCert, err = yk.Attest(slot)
+		return trace.Wrap(err)
+	})
+	if err != nil {
+		return 0, trace.Wrap(err)
+	}
+
+	attestation, err := piv.Verify(attCert, slotCert)
+	if err != nil {
+		return 0, trace.Wrap(err)
+	}
+
+	return attestation.TouchPolicy, nil
+}
+
+// slotAlgorithm returns the PIVAlgorithm of the key in the given slot, based
+// on the public key of its stored certificate.
+func (y *yubiKey) slotAlgorithm(slot piv.Slot) (PIVAlgorithm, error) {
+	var cert *x509.Certificate
+	err := y.withConnection(func(yk *piv.YubiKey) error {
+		var err error
+		cert, err = yk.Certificate(slot)
+		return trace.Wrap(err)
+	})
+	if err != nil || cert == nil {
+		return "", trace.NotFound("YubiKey certificate slot is empty")
+	}
+
+	return pivAlgorithmFromPublicKey(cert.PublicKey)
+}
+
+// certFingerprint returns the hex-encoded SHA256 fingerprint of the given certificate.
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// deleteYubiKeyKey deletes the Teleport key and self-signed certificate stored
+// in the given PIV slot of a connected yubiKey.
+func deleteYubiKeyKey(serialNumber uint32, slotKey uint32) error {
+	slot, err := parsePIVSlot(slotKey)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	y, err := findYubiKey(serialNumber)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	return trace.Wrap(y.clearSlot(slot))
+}
+
+// clearSlot wipes the Teleport key and self-signed certificate stored in the given
+// PIV slot. The slot's certificate must be a Teleport Client certificate, a slot
+// holding a foreign certificate is refused rather than overwritten.
+func (y *yubiKey) clearSlot(slot piv.Slot) error {
+	return y.withConnection(func(yk *piv.YubiKey) error {
+		cert, err := yk.Certificate(slot)
+		if err != nil || cert == nil {
+			return trace.NotFound("YubiKey certificate slot is empty, expected a Teleport Client cert")
+		} else if len(cert.Subject.Organization) == 0 || cert.Subject.Organization[0] != certOrgName {
+			return trace.BadParameter("YubiKey slot %X holds a non-Teleport certificate, refusing to clear it:\n%+v", slot.Key, cert)
+		}
+
+		// piv-go does not support deleting a slot's key or certificate directly,
+		// so overwrite the private key with a fresh throwaway key and replace the
+		// stored certificate with one that Teleport Clients will not reuse.
+		pub, err := yk.GenerateKey(y.getManagementKey(), slot, piv.Key{
+			Algorithm:   piv.AlgorithmEC256,
+			PINPolicy:   piv.PINPolicyNever,
+			TouchPolicy: piv.TouchPolicyNever,
+		})
+		if err != nil {
+			return wrapManagementKeyError(err)
+		}
+
+		priv, err := yk.PrivateKey(slot, pub, piv.KeyAuth{})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+
+		wipedCert, err := selfSignedCertificate(priv, pub, wipedCertOrgName)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+
+		return wrapManagementKeyError(yk.SetCertificate(y.getManagementKey(), slot, wipedCert))
+	})
+}
+
+// generateKeyLockTimeout is how long to wait for another process to release
+// the per-device generation lock before giving up.
+const generateKeyLockTimeout = time.Second * 5
+
+// lockForGeneration acquires an advisory file lock keyed to this yubiKey's
+// serial number. The lock prevents concurrent Teleport processes from racing
+// through the generate-and-store sequence on the same device, which could
+// leave a slot with a mismatched key and certificate.
+func (y *yubiKey) lockForGeneration(timeout time.Duration) (unlock func() error, err error) {
+	lockDir, err := os.UserHomeDir()
+	if err != nil {
+		// Fall back to the system temp dir when the home dir can't be resolved.
+		lockDir = os.TempDir()
+	}
+
+	fileLock := flock.New(filepath.Join(lockDir, fmt.Sprintf(".teleport-yubikey-%d.lock", y.serialNumber)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	locked, err := fileLock.TryLockContext(ctx, time.Millisecond*50)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
 		return nil, trace.Wrap(err)
 	}
+	if !locked {
+		return nil, trace.CompareFailed("YubiKey (serial number %d) is locked by another process generating a key", y.serialNumber)
+	}
 
-	return newYubiKeyPrivateKey(y, slot, pub)
+	return fileLock.Unlock, nil
 }
 
-// getPrivateKey gets an existing private key from the given PIV slot.
-func (y *yubiKey) getPrivateKey(slot piv.Slot) (*YubiKeyPrivateKey, error) {
-	yk, err := y.open()
+// generatePrivateKey generates a new private key from the given PIV slot with the given PIV policies.
+func (y *yubiKey) generatePrivateKey(slot piv.Slot, touchPolicy piv.TouchPolicy, pinPolicy piv.PINPolicy, algorithm PIVAlgorithm) (*YubiKeyPrivateKey, error) {
+	pivAlgorithm, err := algorithm.pivAlgorithm()
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
-	defer yk.Close()
+
+	unlock, err := y.lockForGeneration(generateKeyLockTimeout)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer unlock()
+
+	var pub crypto.PublicKey
+	err = y.withConnection(func(yk *piv.YubiKey) error {
+		opts := piv.Key{
+			Algorithm:   pivAlgorithm,
+			PINPolicy:   pinPolicy,
+			TouchPolicy: touchPolicy,
+		}
+
+		if slot == pivSlotWithTouch {
+			cancelTouchPrompt := y.delayedTouchPrompt(generateKeyTouchPromptDelay)
+			defer cancelTouchPrompt()
+		}
+
+		pub, err = yk.GenerateKey(y.getManagementKey(), slot, opts)
+		if err != nil {
+			return wrapManagementKeyError(err)
+		}
+
+		// Create a self signed certificate and store it in the PIV slot so that other
+		// Teleport Clients know to reuse the stored key instead of genearting a new one.
+		var priv crypto.PrivateKey
+		if pinPolicy == piv.PINPolicyNever {
+			priv, err = yk.PrivateKey(slot, pub, piv.KeyAuth{})
+			if err != nil {
+				return trace.Wrap(err)
+			}
+		} else {
+			// Signing with a PIN-gated key would require the PIN at generation
+			// time, so sign the marker certificate with an ephemeral key instead.
+			// The certificate is only used to mark the slot as used by Teleport
+			// Clients, its signature is never verified.
+			priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				return trace.Wrap(err)
+			}
+		}
+
+		cert, err := selfSignedTeleportClientCertificate(priv, pub)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+
+		// Store a self-signed certificate to mark this slot as used by tsh.
+		return wrapManagementKeyError(yk.SetCertificate(y.getManagementKey(), slot, cert))
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return newYubiKeyPrivateKey(y, slot, pub)
+}
+
+// getPrivateKey gets an existing private key from the given PIV slot.
+func (y *yubiKey) getPrivateKey(slot piv.Slot) (*YubiKeyPrivateKey, error) {
+	var cert *x509.Certificate
+	err := y.withConnection(func(yk *piv.YubiKey) error {
+		var err error
+		cert, err = yk.Certificate(slot)
+		return trace.Wrap(err)
+	})
 
 	// Check the slot's certificate to see if it contains a self signed Teleport Client cert.
-	cert, err := yk.Certificate(slot)
 	if err != nil || cert == nil {
 		return nil, trace.NotFound("YubiKey certificate slot is empty, expected a Teleport Client cert")
 	} else if len(cert.Subject.Organization) == 0 || cert.Subject.Organization[0] != certOrgName {
-		return nil, trace.NotFound("YubiKey certificate slot contained unknown certificate:\n%+v", cert)
+		return nil, nonTeleportCertificateError(y.serialNumber, slot, cert)
 	}
 
 	return newYubiKeyPrivateKey(y, slot, cert.PublicKey)
 }
 
+// getPrivateKeyWithPublicKey gets an existing private key from the given PIV
+// slot using a public key already known to the caller, without reading the
+// slot's certificate. This supports recovery when the certificate was wiped
+// but the caller still holds the public key from the user's profile. The key
+// is verified to match the slot by performing a test sign-and-verify.
+func (y *yubiKey) getPrivateKeyWithPublicKey(slot piv.Slot, pub crypto.PublicKey) (*YubiKeyPrivateKey, error) {
+	priv, err := newYubiKeyPrivateKey(y, slot, pub)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	if err := priv.verifyTestSignature(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return priv, nil
+}
+
+// verifyTestSignature signs a test digest with the private key in the PIV slot
+// and verifies the signature against the key's public key, proving that the
+// two halves belong together.
+func (y *YubiKeyPrivateKey) verifyTestSignature() error {
+	digest := sha256.Sum256([]byte("teleport-piv-test-signature"))
+
+	signature, err := y.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	switch pub := y.pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return trace.CompareFailed("the key in YubiKey PIV slot 0x%x does not match the given public key", y.pivSlot.Key)
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return trace.CompareFailed("the key in YubiKey PIV slot 0x%x does not match the given public key", y.pivSlot.Key)
+		}
+	default:
+		return trace.BadParameter("unsupported public key type %T", pub)
+	}
+
+	return nil
+}
+
+// nonTeleportCertificateError returns an error describing a PIV slot which holds
+// a certificate that was not generated by a Teleport client. The message names
+// the physical device by serial number and the slot by both its human name and
+// hex key to match `ykman piv info` output.
+func nonTeleportCertificateError(serialNumber uint32, slot piv.Slot, cert *x509.Certificate) error {
+	return trace.Wrap(ErrSlotInUse,
+		"YubiKey (serial number %d) %s slot (0x%x) contains an unknown certificate (fingerprint %s), expected a Teleport Client cert",
+		serialNumber, pivSlotName(slot), slot.Key, certFingerprint(cert))
+}
+
+// pivSlotName returns the human name for a PIV slot, matching the names used
+// in the PIV standard and by ykman.
+func pivSlotName(slot piv.Slot) string {
+	switch slot {
+	case piv.SlotAuthentication:
+		return "authentication"
+	case piv.SlotSignature:
+		return "signature"
+	case piv.SlotKeyManagement:
+		return "key management"
+	case piv.SlotCardAuthentication:
+		return "card authentication"
+	}
+	return "unknown"
+}
+
 // open a connection to YubiKey PIV module. The returned connection should be closed once
 // it's been used. The YubiKey PIV module itself takes some additional time to handle closed
 // connections, so we use a retry loop to give the PIV module time to close prior connections.
-func (y *yubiKey) open() (yk *piv.YubiKey, err error) {
+func (y *yubiKey) open() (*piv.YubiKey, error) {
+	return y.openWithContext(context.Background())
+}
+
+// openWithContext opens a connection to the YubiKey PIV module, abandoning the
+// retry loop early if the given context is canceled.
+func (y *yubiKey) openWithContext(ctx context.Context) (yk *piv.YubiKey, err error) {
+	retryConfig := y.retry
+	retryConfig.checkAndSetDefaults()
+
 	linearRetry, err := retryutils.NewLinear(retryutils.LinearConfig{
-		// If a PIV connection has just been closed, it take ~5 ms to become
-		// available to new connections. For this reason, we initially wait a
-		// short 10ms before stepping up to a longer 50ms retry.
-		First: time.Millisecond * 10,
-		Step:  time.Millisecond * 10,
-		// Since PIV modules only allow a single connection, it is a bottleneck
-		// resource. To maximize usage, we use a short 50ms retry to catch the
-		// connection opening up as soon as possible.
-		Max: time.Millisecond * 50,
+		First: retryConfig.first,
+		Step:  retryConfig.step,
+		Max:   retryConfig.max,
 	})
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	// Backoff and retry for up to 1 second.
-	retryCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	openFunc := y.openFunc
+	if openFunc == nil {
+		openFunc = piv.Open
+	}
+
+	retryCtx, cancel := context.WithTimeout(ctx, retryConfig.timeout)
 	defer cancel()
 
 	err = linearRetry.For(retryCtx, func() error {
-		yk, err = piv.Open(y.card)
+		yk, err = openFunc(y.card)
 		if err != nil && !isRetryError(err) {
 			return retryutils.PermanentRetryError(err)
 		}
@@ -365,7 +1070,7 @@ func (y *yubiKey) open() (yk *piv.YubiKey, err error) {
 		// It's also possible that the user is running another PIV program, which may hold the PIV
 		// connection indefinitely (yubikey-agent). In this case, user action is necessary, so we
 		// alert them with this issue.
-		return nil, trace.LimitExceeded("could not connect to YubiKey as another application is using it. Please try again once the program that uses the YubiKey, such as yubikey-agent is closed")
+		return nil, trace.Wrap(ErrYubiKeyBusy, "could not connect to YubiKey as another application is using it. Please try again once the program that uses the YubiKey, such as yubikey-agent is closed")
 	} else if err != nil {
 		return nil, trace.Wrap(err)
 	}
@@ -377,6 +1082,15 @@ func isRetryError(err error) bool {
 	return strings.Contains(err.Error(), retryError)
 }
 
+// cardsFunc lists the connected smart card reader names. It may be overridden
+// in tests to fake connected cards.
+var cardsFunc = piv.Cards
+
+// newYubiKeyFunc constructs a yubiKey from a card name, reading its serial
+// number over a PIV connection. It may be overridden in tests, alongside
+// cardsFunc, to fake connected cards without a real device.
+var newYubiKeyFunc = newYubiKey
+
 // findYubiKey finds a yubiKey PIV card by serial number. If no serial
 // number is provided, the first yubiKey found will be returned.
 func findYubiKey(serialNumber uint32) (*yubiKey, error) {
@@ -387,13 +1101,13 @@ func findYubiKey(serialNumber uint32) (*yubiKey, error) {
 
 	if len(yubiKeyCards) == 0 {
 		if serialNumber != 0 {
-			return nil, trace.ConnectionProblem(nil, "no YubiKey device connected with serial number %d", serialNumber)
+			return nil, trace.Wrap(ErrNoYubiKey, "no YubiKey device connected with serial number %d", serialNumber)
 		}
-		return nil, trace.ConnectionProblem(nil, "no YubiKey device connected")
+		return nil, trace.Wrap(ErrNoYubiKey)
 	}
 
 	for _, card := range yubiKeyCards {
-		y, err := newYubiKey(card)
+		y, err := newYubiKeyFunc(card)
 		if err != nil {
 			return nil, trace.Wrap(err)
 		}
@@ -403,19 +1117,19 @@ func findYubiKey(serialNumber uint32) (*yubiKey, error) {
 		}
 	}
 
-	return nil, trace.ConnectionProblem(nil, "no YubiKey device connected with serial number %d", serialNumber)
+	return nil, trace.Wrap(ErrNoYubiKey, "no YubiKey device connected with serial number %d", serialNumber)
 }
 
 // findYubiKeyCards returns a list of connected yubiKey PIV card names.
 func findYubiKeyCards() ([]string, error) {
-	cards, err := piv.Cards()
+	cards, err := cardsFunc()
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
 	var yubiKeyCards []string
 	for _, card := range cards {
-		if strings.Contains(strings.ToLower(card), PIVCardTypeYubiKey) {
+		if matchPIVCardType(card) {
 			yubiKeyCards = append(yubiKeyCards, card)
 		}
 	}
@@ -423,6 +1137,58 @@ func findYubiKeyCards() ([]string, error) {
 	return yubiKeyCards, nil
 }
 
+// matchPIVCardType returns whether the given card name matches the default
+// "yubikey" substring or one of the additional card type substrings configured
+// with SetAdditionalPIVCardTypes.
+func matchPIVCardType(card string) bool {
+	card = strings.ToLower(card)
+	if strings.Contains(card, PIVCardTypeYubiKey) {
+		return true
+	}
+	for _, cardType := range getAdditionalPIVCardTypes() {
+		if cardType != "" && strings.Contains(card, strings.ToLower(cardType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// pivAlgorithm converts a PIVAlgorithm into its piv-go representation.
+func (a PIVAlgorithm) pivAlgorithm() (piv.Algorithm, error) {
+	switch a {
+	case PIVAlgorithmEC256:
+		return piv.AlgorithmEC256, nil
+	case PIVAlgorithmEC384:
+		return piv.AlgorithmEC384, nil
+	case PIVAlgorithmRSA2048:
+		return piv.AlgorithmRSA2048, nil
+	default:
+		return 0, trace.BadParameter("unsupported PIV algorithm %q", a)
+	}
+}
+
+// pivAlgorithmFromPublicKey returns the PIVAlgorithm used to generate the given public key.
+func pivAlgorithmFromPublicKey(pub crypto.PublicKey) (PIVAlgorithm, error) {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return PIVAlgorithmEC256, nil
+		case elliptic.P384():
+			return PIVAlgorithmEC384, nil
+		default:
+			return "", trace.BadParameter("unsupported elliptic curve %q", pub.Curve.Params().Name)
+		}
+	case *rsa.PublicKey:
+		if bitSize := pub.Size() * 8; bitSize != 2048 {
+			return "", trace.BadParameter("unsupported RSA key size %d", bitSize)
+		}
+		return PIVAlgorithmRSA2048, nil
+	default:
+		return "", trace.BadParameter("unsupported public key type %T", pub)
+	}
+}
+
 func parsePIVSlot(slotKey uint32) (piv.Slot, error) {
 	switch slotKey {
 	case piv.SlotAuthentication.Key:
@@ -442,10 +1208,69 @@ func parsePIVSlot(slotKey uint32) (piv.Slot, error) {
 	}
 }
 
+// validatePIVSlot checks that the given PIV slot is one that Teleport Clients
+// store keys in. Teleport only uses the authentication (9a), signature (9c),
+// and key management (9d) slots, which map to the hardware_key,
+// hardware_key_touch, and hardware_key_pin policies respectively. A key PEM
+// referencing any other slot, including the retired key management slots,
+// was not written by a Teleport client and has no private key policy, so it
+// is rejected rather than silently treated as an unrestricted key.
+func validatePIVSlot(slot piv.Slot) error {
+	if slotPrivateKeyPolicy(slot) == PrivateKeyPolicyNone {
+		return trace.BadParameter("YubiKey PIV slot 0x%x is not used by Teleport Clients", slot.Key)
+	}
+	return nil
+}
+
+// checkYubiKeyAvailable checks that a YubiKey matching the given serial number
+// is connected and usable.
+func checkYubiKeyAvailable(ctx context.Context, serialNumber uint32) error {
+	y, err := findYubiKey(serialNumber)
+	if err != nil {
+		if errors.Is(err, ErrNoYubiKey) {
+			// The exported contract promises a NotFound error when no matching
+			// YubiKey is connected, reserving ConnectionProblem for devices
+			// that are present but unusable.
+			return trace.NotFound(err.Error())
+		}
+		return trace.Wrap(err)
+	}
+
+	return trace.Wrap(y.checkAvailable(ctx))
+}
+
+// checkAvailable opens a connection to the yubiKey and reads its serial number
+// to verify that the device is usable, then closes the connection. Unlike
+// getPrivateKey, it does not read or write any PIV slots.
+func (y *yubiKey) checkAvailable(ctx context.Context) error {
+	yk, err := y.openWithContext(ctx)
+	if err != nil {
+		return trace.ConnectionProblem(err, "YubiKey (serial number %d) is not available", y.serialNumber)
+	}
+	defer yk.Close()
+
+	if _, err := yk.Serial(); err != nil {
+		return trace.ConnectionProblem(err, "YubiKey (serial number %d) is not available", y.serialNumber)
+	}
+
+	return nil
+}
+
 // certOrgName is used to identify Teleport Client self-signed certificates stored in yubiKey PIV slots.
 const certOrgName = "teleport"
 
+// wipedCertOrgName marks a slot whose Teleport key was deleted by a Teleport Client.
+const wipedCertOrgName = "teleport-wiped"
+
 func selfSignedTeleportClientCertificate(priv crypto.PrivateKey, pub crypto.PublicKey) (*x509.Certificate, error) {
+	cert, err := selfSignedCertificate(priv, pub, certOrgName)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return cert, nil
+}
+
+func selfSignedCertificate(priv crypto.PrivateKey, pub crypto.PublicKey, orgName string) (*x509.Certificate, error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit) // see crypto/tls/generate_cert.go
 	if err != nil {
@@ -455,7 +1280,7 @@ func selfSignedTeleportClientCertificate(priv crypto.PrivateKey, pub crypto.Publ
 		SerialNumber: serialNumber,
 		PublicKey:    pub,
 		Subject: pkix.Name{
-			Organization:       []string{certOrgName},
+			Organization:       []string{orgName},
 			OrganizationalUnit: []string{api.Version},
 		},
 	}
@@ -487,12 +1312,20 @@ const (
 // delayedTouchPrompt prompts the user for touch after the given delay.
 // The returned cancel function can be used to cancel the prompt if the
 // calling function succeeds without touch, meaning touch was cached.
-func delayedTouchPrompt(delay time.Duration) (cancel func()) {
+// The prompt fires at most once per call.
+func (y *yubiKey) delayedTouchPrompt(delay time.Duration) (cancel func()) {
+	prompt := y.touchPrompt
+	if prompt == nil {
+		prompt = func() {
+			fmt.Fprintln(os.Stderr, "Tap your YubiKey")
+		}
+	}
+
 	touchCtx, cancel := context.WithTimeout(context.Background(), delay)
 	go func() {
 		<-touchCtx.Done()
 		if touchCtx.Err() == context.DeadlineExceeded {
-			fmt.Fprintln(os.Stderr, "Tap your YubiKey")
+			prompt()
 		}
 	}()
 
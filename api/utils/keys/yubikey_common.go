@@ -14,11 +14,174 @@ limitations under the License.
 package keys
 
 import (
+	"context"
+	"sync"
+
 	"github.com/gravitational/trace"
 )
 
-func GetOrGenerateYubiKeyPrivateKey(touchRequired bool) (*PrivateKey, error) {
-	priv, err := getOrGenerateYubiKeyPrivateKey(touchRequired)
+var (
+	// additionalPIVCardTypesMu guards additionalPIVCardTypes.
+	additionalPIVCardTypesMu sync.Mutex
+	// additionalPIVCardTypes holds additional reader-name substrings, beyond
+	// the default "yubikey", that are recognized as compatible PIV cards.
+	additionalPIVCardTypes []string
+)
+
+// SetAdditionalPIVCardTypes configures additional reader-name substrings that
+// are recognized as compatible PIV cards, letting compatible tokens from other
+// vendors (e.g. Nitrokey, SoloKeys) be used for hardware key policies. Matching
+// is case-insensitive, and the default "yubikey" substring is always matched.
+// Note that hardware key attestation may not be supported on non-YubiKey
+// devices, in which case only policies that do not require attestation can be
+// satisfied.
+func SetAdditionalPIVCardTypes(cardTypes []string) {
+	additionalPIVCardTypesMu.Lock()
+	defer additionalPIVCardTypesMu.Unlock()
+	additionalPIVCardTypes = append([]string{}, cardTypes...)
+}
+
+// getAdditionalPIVCardTypes returns a copy of the configured additional PIV
+// card type substrings.
+func getAdditionalPIVCardTypes() []string {
+	additionalPIVCardTypesMu.Lock()
+	defer additionalPIVCardTypesMu.Unlock()
+	return append([]string{}, additionalPIVCardTypes...)
+}
+
+// The following sentinel errors let callers distinguish common YubiKey failure
+// modes with errors.Is instead of matching error strings. They are typed trace
+// errors so the existing trace predicates (trace.IsLimitExceeded and friends)
+// keep matching when they are wrapped.
+var (
+	// ErrYubiKeyBusy is returned when the YubiKey PIV connection could not be
+	// opened because another application is holding it.
+	ErrYubiKeyBusy error = &trace.LimitExceededError{Message: "YubiKey is in use by another application"}
+	// ErrNoYubiKey is returned when no matching YubiKey device is connected.
+	ErrNoYubiKey error = &trace.ConnectionProblemError{Message: "no YubiKey device connected"}
+	// ErrSlotInUse is returned when a PIV slot holds a certificate that was
+	// not generated by a Teleport client.
+	ErrSlotInUse error = &trace.NotFoundError{Message: "PIV slot is in use by a non-Teleport certificate"}
+)
+
+// PIVAlgorithm is an algorithm used to generate a private key on a YubiKey PIV slot.
+type PIVAlgorithm string
+
+const (
+	// PIVAlgorithmEC256 is an ECDSA private key on the NIST P-256 curve.
+	// This is the default algorithm.
+	PIVAlgorithmEC256 PIVAlgorithm = "EC256"
+	// PIVAlgorithmEC384 is an ECDSA private key on the NIST P-384 curve.
+	PIVAlgorithmEC384 PIVAlgorithm = "EC384"
+	// PIVAlgorithmRSA2048 is a 2048-bit RSA private key.
+	PIVAlgorithmRSA2048 PIVAlgorithm = "RSA2048"
+)
+
+// checkAndSetDefaults checks that the PIVAlgorithm is in the supported set,
+// defaulting to PIVAlgorithmEC256 when unset.
+func (a *PIVAlgorithm) checkAndSetDefaults() error {
+	switch *a {
+	case "":
+		*a = PIVAlgorithmEC256
+	case PIVAlgorithmEC256, PIVAlgorithmEC384, PIVAlgorithmRSA2048:
+	default:
+		return trace.BadParameter("unsupported PIV algorithm %q", *a)
+	}
+	return nil
+}
+
+// SlotInfo describes a certificate found in a yubiKey PIV slot used by Teleport clients.
+type SlotInfo struct {
+	// SerialNumber is the YubiKey's 8 digit serial number.
+	SerialNumber uint32
+	// SlotKey is the key of the PIV slot holding the certificate.
+	SlotKey uint32
+	// Policy is the private key policy supported by a key in this slot.
+	Policy PrivateKeyPolicy
+	// Fingerprint is the hex-encoded SHA256 fingerprint of the certificate in this slot.
+	Fingerprint string
+	// IsTeleport is true when the slot holds a Teleport Client self-signed certificate,
+	// and false when the slot holds a foreign certificate.
+	IsTeleport bool
+}
+
+// ListYubiKeyTeleportKeys lists the keys present in the PIV slots used by Teleport
+// clients, including foreign certificates found in those slots. If serialNumber is
+// non-zero, the YubiKey with that serial number is used. Otherwise, the first
+// YubiKey found is used.
+func ListYubiKeyTeleportKeys(serialNumber uint32) ([]SlotInfo, error) {
+	infos, err := listYubiKeyTeleportKeys(serialNumber)
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to list YubiKey keys")
+	}
+	return infos, nil
+}
+
+// DeleteYubiKeyKey deletes the Teleport key and self-signed certificate stored in
+// the given PIV slot of a YubiKey. Slots holding non-Teleport certificates are left
+// untouched. If serialNumber is non-zero, the YubiKey with that serial number is
+// used. Otherwise, the first YubiKey found is used.
+func DeleteYubiKeyKey(serialNumber uint32, slotKey uint32) error {
+	if err := deleteYubiKeyKey(serialNumber, slotKey); err != nil {
+		return trace.Wrap(err, "failed to delete YubiKey key")
+	}
+	return nil
+}
+
+// MigrateYubiKeyRetiredSlotKeys migrates Teleport keys found in the retired key
+// management slots of a YubiKey into the canonical slot matching their touch
+// policy, clearing the retired slot afterwards. The confirm callback is invoked
+// before each migration and may decline it; a nil callback migrates every key.
+// Since private keys cannot be moved between PIV slots, migration generates a
+// fresh key in the canonical slot. The migrated keys are returned with their
+// new slot information. If serialNumber is non-zero, the YubiKey with that
+// serial number is used. Otherwise, the first YubiKey found is used.
+func MigrateYubiKeyRetiredSlotKeys(serialNumber uint32, confirm func(info SlotInfo) (bool, error)) ([]SlotInfo, error) {
+	migrated, err := migrateYubiKeyRetiredSlotKeys(serialNumber, confirm)
+	if err != nil {
+		return migrated, trace.Wrap(err, "failed to migrate YubiKey keys")
+	}
+	return migrated, nil
+}
+
+// CheckYubiKeyAvailable checks whether a usable YubiKey is connected, without
+// generating keys or reading any PIV slots. If serialNumber is non-zero, the
+// YubiKey with that serial number is checked. Otherwise, the first YubiKey
+// found is checked. It returns a trace.NotFound error if no matching YubiKey
+// is connected, a trace.ConnectionProblem error if the device could not be
+// connected to, and nil if the device is usable.
+func CheckYubiKeyAvailable(ctx context.Context, serialNumber uint32) error {
+	return trace.Wrap(checkYubiKeyAvailable(ctx, serialNumber))
+}
+
+// CloseAll closes any cached YubiKey PIV connections held by this process,
+// releasing the PIV module for other applications. Keys remain usable;
+// subsequent operations transparently reopen a connection.
+func CloseAll() error {
+	if err := closeAllYubiKeys(); err != nil {
+		return trace.Wrap(err, "failed to close YubiKey connections")
+	}
+	return nil
+}
+
+// GetOrGenerateYubiKeyPrivateKey gets an existing YubiKey private key matching the
+// given hardware private key policy, or generates a new one with the given algorithm.
+// If serialNumber is non-zero, the YubiKey with that serial number is used. Otherwise,
+// the first YubiKey found is used.
+func GetOrGenerateYubiKeyPrivateKey(policy PrivateKeyPolicy, algorithm PIVAlgorithm, serialNumber uint32) (*PrivateKey, error) {
+	priv, err := getOrGenerateYubiKeyPrivateKey(policy, algorithm, serialNumber, nil)
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to get a YubiKey private key")
+	}
+	return priv, nil
+}
+
+// GetOrGenerateYubiKeyPrivateKeyWithManagementKey is like GetOrGenerateYubiKeyPrivateKey,
+// but authenticates slot mutations with the given management key instead of the default
+// PIV management key. It should be used with YubiKeys whose management key was rotated
+// per security policy.
+func GetOrGenerateYubiKeyPrivateKeyWithManagementKey(policy PrivateKeyPolicy, algorithm PIVAlgorithm, serialNumber uint32, managementKey [24]byte) (*PrivateKey, error) {
+	priv, err := getOrGenerateYubiKeyPrivateKey(policy, algorithm, serialNumber, &managementKey)
 	if err != nil {
 		return nil, trace.Wrap(err, "failed to get a YubiKey private key")
 	}
@@ -16,6 +16,7 @@ limitations under the License.
 package keys
 
 import (
+	"context"
 	"crypto"
 	"errors"
 
@@ -24,10 +25,31 @@ import (
 
 var errPIVUnavailable = errors.New("PIV is unavailable in current build")
 
-func getOrGenerateYubiKeyPrivateKey(touchRequired bool) (*PrivateKey, error) {
+func getOrGenerateYubiKeyPrivateKey(policy PrivateKeyPolicy, algorithm PIVAlgorithm, serialNumber uint32, managementKey *[24]byte) (*PrivateKey, error) {
 	return nil, trace.Wrap(errPIVUnavailable)
 }
 
 func parseYubiKeyPrivateKeyData(keyDataBytes []byte) (crypto.Signer, error) {
 	return nil, trace.Wrap(errPIVUnavailable)
 }
+
+func listYubiKeyTeleportKeys(serialNumber uint32) ([]SlotInfo, error) {
+	return nil, trace.Wrap(errPIVUnavailable)
+}
+
+func migrateYubiKeyRetiredSlotKeys(serialNumber uint32, confirm func(info SlotInfo) (bool, error)) ([]SlotInfo, error) {
+	return nil, trace.Wrap(errPIVUnavailable)
+}
+
+func deleteYubiKeyKey(serialNumber uint32, slotKey uint32) error {
+	return trace.Wrap(errPIVUnavailable)
+}
+
+func checkYubiKeyAvailable(ctx context.Context, serialNumber uint32) error {
+	return trace.Wrap(errPIVUnavailable)
+}
+
+func closeAllYubiKeys() error {
+	// Without PIV support there are no connections to close.
+	return nil
+}
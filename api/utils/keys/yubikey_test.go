@@ -17,9 +17,19 @@ package keys
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/go-piv/piv-go/piv"
+	"github.com/gravitational/trace"
 	"github.com/stretchr/testify/require"
 )
 
@@ -35,7 +45,7 @@ func TestGetOrGenerateYubiKeyPrivateKey(t *testing.T) {
 	resetYubikey(ctx, t)
 
 	// Generate a new YubiKeyPrivateKey.
-	priv, err := GetOrGenerateYubiKeyPrivateKey(false)
+	priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
 	require.NoError(t, err)
 
 	// Test creating a self signed certificate with the key.
@@ -43,7 +53,7 @@ func TestGetOrGenerateYubiKeyPrivateKey(t *testing.T) {
 	require.NoError(t, err)
 
 	// Another call to GetOrGenerateYubiKeyPrivateKey should retrieve the previously generated key.
-	retrievePriv, err := GetOrGenerateYubiKeyPrivateKey(false)
+	retrievePriv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
 	require.NoError(t, err)
 	require.Equal(t, priv, retrievePriv)
 
@@ -53,6 +63,740 @@ func TestGetOrGenerateYubiKeyPrivateKey(t *testing.T) {
 	require.Equal(t, priv, retrieveKey)
 }
 
+// TestYubiKeyPrivateKeyAlgorithms tests generating YubiKey private keys with each
+// supported PIV algorithm and round-tripping them through their key PEM.
+func TestYubiKeyPrivateKeyAlgorithms(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestYubiKeyPrivateKeyAlgorithms because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+
+	for _, algorithm := range []PIVAlgorithm{PIVAlgorithmEC256, PIVAlgorithmEC384, PIVAlgorithmRSA2048} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			resetYubikey(ctx, t)
+
+			priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, algorithm, 0)
+			require.NoError(t, err)
+
+			// Parsing the key's private key PEM should produce the same key.
+			retrieveKey, err := ParsePrivateKey(priv.PrivateKeyPEM())
+			require.NoError(t, err)
+			require.Equal(t, priv, retrieveKey)
+		})
+	}
+}
+
+// TestParseYubiKeyPrivateKeyPublicKeyFallback tests that a key PEM can still
+// be parsed from its embedded public key when the slot certificate is unreadable.
+func TestParseYubiKeyPrivateKeyPublicKeyFallback(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestParseYubiKeyPrivateKeyPublicKeyFallback because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+
+	priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+	yubiKeyPriv := priv.Signer.(*YubiKeyPrivateKey)
+
+	// With the slot certificate intact, the key parses through the cert path.
+	retrieveKey, err := ParsePrivateKey(priv.PrivateKeyPEM())
+	require.NoError(t, err)
+	require.Equal(t, priv, retrieveKey)
+
+	// Overwrite the slot certificate with a non-Teleport certificate to make
+	// the cert path fail, then check that parsing falls back to the public
+	// key embedded in the key PEM.
+	foreignKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	foreignCert, err := selfSignedCertificate(foreignKey, foreignKey.Public(), "not-teleport")
+	require.NoError(t, err)
+	err = yubiKeyPriv.withConnection(func(yk *piv.YubiKey) error {
+		return yk.SetCertificate(piv.DefaultManagementKey, yubiKeyPriv.pivSlot, foreignCert)
+	})
+	require.NoError(t, err)
+
+	retrieveKey, err = ParsePrivateKey(priv.PrivateKeyPEM())
+	require.NoError(t, err)
+	require.Equal(t, priv.Public(), retrieveKey.Public())
+
+	// The fallback key should still sign with the hardware private key.
+	digest := sha256.Sum256([]byte("data"))
+	_, err = retrieveKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+}
+
+// TestTouchPrompt tests that the touch prompt callback fires for touch keys
+// and not for no-touch keys.
+func TestTouchPrompt(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestTouchPrompt because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+	digest := sha256.Sum256([]byte("data"))
+
+	// Signing with a no-touch key should not invoke the touch prompt.
+	priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+
+	var prompted atomic.Bool
+	priv.Signer.(*YubiKeyPrivateKey).SetTouchPrompt(func() { prompted.Store(true) })
+	_, err = priv.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	require.False(t, prompted.Load())
+
+	// Signing with a touch key should invoke the touch prompt while the
+	// signature blocks on touch.
+	touchPriv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKeyTouch, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+
+	touchPriv.Signer.(*YubiKeyPrivateKey).SetTouchPrompt(func() { prompted.Store(true) })
+	_, err = touchPriv.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	require.True(t, prompted.Load())
+}
+
+// TestGetYubiKeyPrivateKeyBySerialNumber tests selecting a YubiKey by serial number.
+func TestGetYubiKeyPrivateKeyBySerialNumber(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestGetYubiKeyPrivateKeyBySerialNumber because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+
+	y, err := findYubiKey(0)
+	require.NoError(t, err)
+
+	// Requesting the key by the connected YubiKey's serial number should use that YubiKey.
+	priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, y.serialNumber)
+	require.NoError(t, err)
+	require.Equal(t, y.serialNumber, priv.Signer.(*YubiKeyPrivateKey).serialNumber)
+
+	// Requesting a serial number that isn't connected should fail.
+	_, err = GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, y.serialNumber+1)
+	require.Error(t, err)
+}
+
+// TestFindYubiKeySelection tests YubiKey selection by serial number against
+// fake cards, without a connected device.
+func TestFindYubiKeySelection(t *testing.T) {
+	origCards, origNew := cardsFunc, newYubiKeyFunc
+	t.Cleanup(func() {
+		cardsFunc, newYubiKeyFunc = origCards, origNew
+	})
+
+	const (
+		firstCard    = "Yubico YubiKey OTP+FIDO+CCID 00 00"
+		secondCard   = "Yubico YubiKey OTP+FIDO+CCID 01 00"
+		firstSerial  = uint32(11111111)
+		secondSerial = uint32(22222222)
+	)
+	serials := map[string]uint32{
+		firstCard:  firstSerial,
+		secondCard: secondSerial,
+	}
+
+	// Include a non-YubiKey reader to check that it is filtered out rather
+	// than connected to.
+	cardsFunc = func() ([]string, error) {
+		return []string{"Generic Smart Card Reader 00 00", firstCard, secondCard}, nil
+	}
+	newYubiKeyFunc = func(card string) (*yubiKey, error) {
+		serialNumber, ok := serials[card]
+		if !ok {
+			return nil, trace.BadParameter("unexpected card %q", card)
+		}
+		return &yubiKey{card: card, serialNumber: serialNumber}, nil
+	}
+
+	// Without a serial number, the first YubiKey card is selected.
+	y, err := findYubiKey(0)
+	require.NoError(t, err)
+	require.Equal(t, firstCard, y.card)
+	require.Equal(t, firstSerial, y.serialNumber)
+
+	// With a serial number, the matching card is selected.
+	y, err = findYubiKey(secondSerial)
+	require.NoError(t, err)
+	require.Equal(t, secondCard, y.card)
+	require.Equal(t, secondSerial, y.serialNumber)
+
+	// An unknown serial number should surface ErrNoYubiKey.
+	_, err = findYubiKey(33333333)
+	require.ErrorIs(t, err, ErrNoYubiKey)
+
+	// With no cards connected at all, ErrNoYubiKey is surfaced as well.
+	cardsFunc = func() ([]string, error) { return nil, nil }
+	_, err = findYubiKey(0)
+	require.ErrorIs(t, err, ErrNoYubiKey)
+}
+
+// TestGetPrivateKeyWithPublicKey tests recovering a YubiKey private key from a
+// public key known to the caller, without reading the slot certificate.
+func TestGetPrivateKeyWithPublicKey(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestGetPrivateKeyWithPublicKey because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+
+	priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+
+	y, err := findYubiKey(0)
+	require.NoError(t, err)
+
+	// The matching public key should recover the private key.
+	recovered, err := y.getPrivateKeyWithPublicKey(pivSlotNoTouch, priv.Public())
+	require.NoError(t, err)
+	require.Equal(t, priv.Public(), recovered.Public())
+
+	// A mismatching public key should fail the test signature.
+	wrongKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = y.getPrivateKeyWithPublicKey(pivSlotNoTouch, wrongKey.Public())
+	require.True(t, trace.IsCompareFailed(err), "expected compare failed error, got %v", err)
+}
+
+// TestListYubiKeyTeleportKeys tests listing the Teleport keys present on a yubiKey.
+func TestListYubiKeyTeleportKeys(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestListYubiKeyTeleportKeys because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+
+	// A reset yubiKey should list no Teleport keys.
+	infos, err := ListYubiKeyTeleportKeys(0)
+	require.NoError(t, err)
+	require.Empty(t, infos)
+
+	// Generate keys on both the no-touch and touch slots and list them.
+	_, err = GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+	_, err = GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKeyTouch, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+
+	infos, err = ListYubiKeyTeleportKeys(0)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	require.Equal(t, PrivateKeyPolicyHardwareKey, infos[0].Policy)
+	require.Equal(t, PrivateKeyPolicyHardwareKeyTouch, infos[1].Policy)
+	for _, info := range infos {
+		require.True(t, info.IsTeleport)
+		require.NotEmpty(t, info.Fingerprint)
+	}
+}
+
+// TestDeleteYubiKeyKey tests deleting a Teleport key from a yubiKey PIV slot.
+func TestDeleteYubiKeyKey(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestDeleteYubiKeyKey because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+
+	// Deleting from an empty slot should fail.
+	err := DeleteYubiKeyKey(0, pivSlotNoTouch.Key)
+	require.True(t, trace.IsNotFound(err))
+
+	// Generate a key and delete it.
+	_, err = GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+	require.NoError(t, DeleteYubiKeyKey(0, pivSlotNoTouch.Key))
+
+	// The slot no longer holds a Teleport key, so a second delete should be refused.
+	err = DeleteYubiKeyKey(0, pivSlotNoTouch.Key)
+	require.True(t, trace.IsBadParameter(err))
+}
+
+// TestMigrateYubiKeyRetiredSlotKeys tests migrating a Teleport key from a
+// retired PIV slot into the canonical slot for its touch policy.
+func TestMigrateYubiKeyRetiredSlotKeys(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestMigrateYubiKeyRetiredSlotKeys because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+
+	y, err := findYubiKey(0)
+	require.NoError(t, err)
+
+	// Seed a no-touch Teleport key in a retired slot.
+	retiredSlot, ok := piv.RetiredKeyManagementSlot(0x82)
+	require.True(t, ok)
+	err = y.withConnection(func(yk *piv.YubiKey) error {
+		pub, err := yk.GenerateKey(piv.DefaultManagementKey, retiredSlot, piv.Key{
+			Algorithm:   piv.AlgorithmEC256,
+			PINPolicy:   piv.PINPolicyNever,
+			TouchPolicy: piv.TouchPolicyNever,
+		})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		priv, err := yk.PrivateKey(retiredSlot, pub, piv.KeyAuth{})
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		cert, err := selfSignedTeleportClientCertificate(priv, pub)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		return trace.Wrap(yk.SetCertificate(piv.DefaultManagementKey, retiredSlot, cert))
+	})
+	require.NoError(t, err)
+
+	// A declining confirmation callback should leave the key in place.
+	migrated, err := MigrateYubiKeyRetiredSlotKeys(0, func(info SlotInfo) (bool, error) {
+		return false, nil
+	})
+	require.NoError(t, err)
+	require.Empty(t, migrated)
+	_, err = y.getPrivateKey(retiredSlot)
+	require.NoError(t, err)
+
+	// Migrating should move the key into the no-touch slot and clear the retired one.
+	var confirmed []SlotInfo
+	migrated, err = MigrateYubiKeyRetiredSlotKeys(0, func(info SlotInfo) (bool, error) {
+		confirmed = append(confirmed, info)
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, confirmed, 1)
+	require.Equal(t, retiredSlot.Key, confirmed[0].SlotKey)
+	require.Len(t, migrated, 1)
+	require.Equal(t, pivSlotNoTouch.Key, migrated[0].SlotKey)
+	require.Equal(t, PrivateKeyPolicyHardwareKey, migrated[0].Policy)
+
+	// The canonical slot holds a Teleport key and the retired slot does not.
+	_, err = y.getPrivateKey(pivSlotNoTouch)
+	require.NoError(t, err)
+	infos, err := ListYubiKeyTeleportKeys(0)
+	require.NoError(t, err)
+	for _, info := range infos {
+		if info.SlotKey == retiredSlot.Key {
+			require.False(t, info.IsTeleport)
+		}
+	}
+
+	// A second migration pass should find nothing left to migrate.
+	migrated, err = MigrateYubiKeyRetiredSlotKeys(0, nil)
+	require.NoError(t, err)
+	require.Empty(t, migrated)
+}
+
+// TestYubiKeyManagementKey tests generating keys with default and custom PIV management keys.
+func TestYubiKeyManagementKey(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestYubiKeyManagementKey because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+	// Reset the yubiKey again on exit to restore the default management key.
+	t.Cleanup(func() { resetYubikey(ctx, t) })
+
+	// Generating with the default management key should succeed.
+	_, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+
+	// Rotate the management key away from the default.
+	var customKey [24]byte
+	for i := range customKey {
+		customKey[i] = byte(i)
+	}
+
+	y, err := findYubiKey(0)
+	require.NoError(t, err)
+	yk, err := y.open()
+	require.NoError(t, err)
+	require.NoError(t, yk.SetManagementKey(piv.DefaultManagementKey, customKey))
+	require.NoError(t, yk.Close())
+
+	// Generating with the default management key should now fail, while the
+	// custom management key should succeed.
+	_, err = GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKeyTouch, PIVAlgorithmEC256, 0)
+	require.Error(t, err)
+	_, err = GetOrGenerateYubiKeyPrivateKeyWithManagementKey(PrivateKeyPolicyHardwareKeyTouch, PIVAlgorithmEC256, 0, customKey)
+	require.NoError(t, err)
+}
+
+// TestAttestationCertCache tests that the device-wide attestation certificate
+// is only fetched once across multiple attestations.
+func TestAttestationCertCache(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestAttestationCertCache because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+
+	priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+	yubiKeyPriv := priv.Signer.(*YubiKeyPrivateKey)
+
+	_, err = yubiKeyPriv.GetAttestationStatement()
+	require.NoError(t, err)
+	cachedCert := yubiKeyPriv.attestationCert
+	require.NotNil(t, cachedCert)
+
+	// Subsequent attestations should reuse the cached certificate.
+	_, err = yubiKeyPriv.GetAttestationStatement()
+	require.NoError(t, err)
+	require.Same(t, cachedCert, yubiKeyPriv.attestationCert)
+}
+
+// TestYubiKeyClose tests proactively releasing the shared PIV connection and
+// transparently reopening it on the next operation.
+func TestYubiKeyClose(t *testing.T) {
+	// This test expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping TestYubiKeyClose because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	ctx := context.Background()
+	resetYubikey(ctx, t)
+
+	priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(t, err)
+	yubiKeyPriv := priv.Signer.(*YubiKeyPrivateKey)
+
+	// The key generation above leaves a cached connection behind.
+	require.NotNil(t, yubiKeyPriv.conn)
+
+	// Close should release the cached connection and be idempotent.
+	require.NoError(t, yubiKeyPriv.Close())
+	require.Nil(t, yubiKeyPriv.conn)
+	require.NoError(t, yubiKeyPriv.Close())
+
+	// A subsequent Sign should transparently reopen the connection.
+	digest := sha256.Sum256([]byte("test"))
+	_, err = yubiKeyPriv.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	require.NotNil(t, yubiKeyPriv.conn)
+
+	// CloseAll should release every cached connection.
+	require.NoError(t, CloseAll())
+	require.Nil(t, yubiKeyPriv.conn)
+}
+
+// TestPIVOpenRetry tests that the PIV open retry loop honors the configured
+// retry parameters using a fake opener.
+func TestPIVOpenRetry(t *testing.T) {
+	retryErr := errors.New("connecting to smart card: the smart card cannot be accessed because of other connections outstanding")
+
+	attempts := 0
+	y := &yubiKey{
+		card: "fake",
+		retry: pivRetryConfig{
+			first:   time.Millisecond,
+			step:    time.Millisecond,
+			max:     time.Millisecond * 5,
+			timeout: time.Millisecond * 100,
+		},
+		openFunc: func(card string) (*piv.YubiKey, error) {
+			attempts++
+			return nil, retryErr
+		},
+	}
+
+	// A retryable error should be retried until the configured timeout elapses.
+	_, err := y.open()
+	require.True(t, trace.IsLimitExceeded(err))
+	require.Greater(t, attempts, 1)
+
+	// A non-retryable error should fail immediately without retrying.
+	attempts = 0
+	y.openFunc = func(card string) (*piv.YubiKey, error) {
+		attempts++
+		return nil, errors.New("no such smart card")
+	}
+	_, err = y.open()
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+}
+
+// TestMatchPIVCardType tests the reader-name filter with mixed card names and
+// additional configured card types.
+func TestMatchPIVCardType(t *testing.T) {
+	t.Cleanup(func() { SetAdditionalPIVCardTypes(nil) })
+
+	// By default only YubiKeys are matched.
+	require.True(t, matchPIVCardType("Yubico YubiKey OTP+FIDO+CCID"))
+	require.False(t, matchPIVCardType("Nitrokey 3 [CCID/ICCD Interface]"))
+	require.False(t, matchPIVCardType("SoloKeys Solo 2"))
+
+	// Configured card types should be matched case-insensitively, in addition
+	// to the default.
+	SetAdditionalPIVCardTypes([]string{"nitrokey", "SoloKeys"})
+	require.True(t, matchPIVCardType("Yubico YubiKey OTP+FIDO+CCID"))
+	require.True(t, matchPIVCardType("Nitrokey 3 [CCID/ICCD Interface]"))
+	require.True(t, matchPIVCardType("SoloKeys Solo 2"))
+	require.False(t, matchPIVCardType("Generic Smart Card Reader"))
+
+	// Clearing the configuration should restore the default filter.
+	SetAdditionalPIVCardTypes(nil)
+	require.False(t, matchPIVCardType("Nitrokey 3 [CCID/ICCD Interface]"))
+}
+
+// TestYubiKeyErrorTypes tests that the exported sentinel errors are matched by
+// errors.Is while preserving the existing trace error semantics.
+func TestYubiKeyErrorTypes(t *testing.T) {
+	// A busy PIV module should surface ErrYubiKeyBusy once retries are exhausted.
+	y := &yubiKey{
+		card: "fake",
+		retry: pivRetryConfig{
+			first:   time.Millisecond,
+			step:    time.Millisecond,
+			max:     time.Millisecond * 5,
+			timeout: time.Millisecond * 100,
+		},
+		openFunc: func(card string) (*piv.YubiKey, error) {
+			return nil, errors.New("connecting to smart card: the smart card cannot be accessed because of other connections outstanding")
+		},
+	}
+	_, err := y.open()
+	require.ErrorIs(t, err, ErrYubiKeyBusy)
+	require.True(t, trace.IsLimitExceeded(err))
+
+	// A slot holding a foreign certificate should surface ErrSlotInUse.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert, err := selfSignedTeleportClientCertificate(key, key.Public())
+	require.NoError(t, err)
+	err = nonTeleportCertificateError(12345678, pivSlotNoTouch, cert)
+	require.ErrorIs(t, err, ErrSlotInUse)
+	require.True(t, trace.IsNotFound(err))
+
+	// The remaining scenario requires a connected YubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping hardware checks in TestYubiKeyErrorTypes because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	// A serial number that isn't connected should surface ErrNoYubiKey.
+	connected, err := findYubiKey(0)
+	require.NoError(t, err)
+	_, err = findYubiKey(connected.serialNumber + 1)
+	require.ErrorIs(t, err, ErrNoYubiKey)
+	require.True(t, trace.IsConnectionProblem(err))
+}
+
+// TestGenerationLock tests that the per-device generation lock only admits
+// one concurrent holder.
+func TestGenerationLock(t *testing.T) {
+	y := &yubiKey{serialNumber: 12345678}
+
+	// Race two lock holders. The loser's timeout is shorter than how long the
+	// winner holds the lock, so exactly one should succeed.
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			unlock, err := y.lockForGeneration(time.Millisecond * 100)
+			if err != nil {
+				results <- err
+				return
+			}
+			time.Sleep(time.Millisecond * 300)
+			results <- unlock()
+		}()
+	}
+
+	err1, err2 := <-results, <-results
+	if err1 != nil {
+		err1, err2 = err2, err1
+	}
+	require.NoError(t, err1)
+	require.True(t, trace.IsCompareFailed(err2), "expected compare failed error, got %v", err2)
+
+	// Once released, the lock should be immediately acquirable again.
+	unlock, err := y.lockForGeneration(time.Millisecond * 100)
+	require.NoError(t, err)
+	require.NoError(t, unlock())
+}
+
+// TestCheckYubiKeyAvailable tests the YubiKey availability check against both
+// a fake PIV module and, when available, a connected YubiKey.
+func TestCheckYubiKeyAvailable(t *testing.T) {
+	ctx := context.Background()
+
+	// A busy reader should result in a connection problem error after retries.
+	y := &yubiKey{
+		card: "fake",
+		retry: pivRetryConfig{
+			first:   time.Millisecond,
+			step:    time.Millisecond,
+			max:     time.Millisecond * 5,
+			timeout: time.Millisecond * 100,
+		},
+		openFunc: func(card string) (*piv.YubiKey, error) {
+			return nil, errors.New("connecting to smart card: the smart card cannot be accessed because of other connections outstanding")
+		},
+	}
+	err := y.checkAvailable(ctx)
+	require.True(t, trace.IsConnectionProblem(err))
+
+	// A permanent open error should also result in a connection problem error.
+	y.openFunc = func(card string) (*piv.YubiKey, error) {
+		return nil, errors.New("no such smart card")
+	}
+	err = y.checkAvailable(ctx)
+	require.True(t, trace.IsConnectionProblem(err))
+
+	// The remaining outcomes require a connected YubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		t.Skipf("Skipping hardware checks in TestCheckYubiKeyAvailable because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	// A connected YubiKey should pass the check.
+	require.NoError(t, CheckYubiKeyAvailable(ctx, 0))
+
+	// A serial number that isn't connected should result in a not found error.
+	connected, err := findYubiKey(0)
+	require.NoError(t, err)
+	err = CheckYubiKeyAvailable(ctx, connected.serialNumber+1)
+	require.True(t, trace.IsNotFound(err))
+}
+
+// TestSlotPrivateKeyPolicy tests the PIV slot to private key policy mapping.
+func TestSlotPrivateKeyPolicy(t *testing.T) {
+	for slot, expectPolicy := range map[piv.Slot]PrivateKeyPolicy{
+		pivSlotNoTouch:             PrivateKeyPolicyHardwareKey,
+		pivSlotWithTouch:           PrivateKeyPolicyHardwareKeyTouch,
+		pivSlotWithPIN:             PrivateKeyPolicyHardwareKeyPIN,
+		piv.SlotCardAuthentication: PrivateKeyPolicyNone,
+	} {
+		require.Equal(t, expectPolicy, slotPrivateKeyPolicy(slot))
+	}
+}
+
+// TestSatisfiesPolicy tests the full satisfaction matrix between the policy
+// of a stored key's slot and a required private key policy.
+func TestSatisfiesPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		slot      piv.Slot
+		satisfies map[PrivateKeyPolicy]bool
+	}{
+		{
+			slot: pivSlotNoTouch,
+			satisfies: map[PrivateKeyPolicy]bool{
+				PrivateKeyPolicyNone:             true,
+				PrivateKeyPolicyHardwareKey:      true,
+				PrivateKeyPolicyHardwareKeyTouch: false,
+				PrivateKeyPolicyHardwareKeyPIN:   false,
+			},
+		},
+		{
+			slot: pivSlotWithTouch,
+			satisfies: map[PrivateKeyPolicy]bool{
+				PrivateKeyPolicyNone:             true,
+				PrivateKeyPolicyHardwareKey:      true,
+				PrivateKeyPolicyHardwareKeyTouch: true,
+				PrivateKeyPolicyHardwareKeyPIN:   false,
+			},
+		},
+		{
+			slot: pivSlotWithPIN,
+			satisfies: map[PrivateKeyPolicy]bool{
+				PrivateKeyPolicyNone:             true,
+				PrivateKeyPolicyHardwareKey:      true,
+				PrivateKeyPolicyHardwareKeyTouch: false,
+				PrivateKeyPolicyHardwareKeyPIN:   true,
+			},
+		},
+	} {
+		key := &YubiKeyPrivateKey{yubiKey: &yubiKey{}, pivSlot: tt.slot}
+		for required, expect := range tt.satisfies {
+			require.Equal(t, expect, key.SatisfiesPolicy(required),
+				"slot 0x%x, required policy %q", tt.slot.Key, required)
+		}
+	}
+}
+
+// TestValidatePIVSlot tests that only the PIV slots Teleport stores keys in
+// pass validation when parsing a key PEM.
+func TestValidatePIVSlot(t *testing.T) {
+	validSlots := map[uint32]bool{
+		piv.SlotAuthentication.Key: true,
+		piv.SlotSignature.Key:      true,
+		piv.SlotKeyManagement.Key:  true,
+	}
+
+	// Every parsable slot key, including the card authentication slot and
+	// the retired key management slots (0x82-0x95).
+	slotKeys := []uint32{
+		piv.SlotAuthentication.Key,
+		piv.SlotSignature.Key,
+		piv.SlotKeyManagement.Key,
+		piv.SlotCardAuthentication.Key,
+	}
+	for slotKey := uint32(0x82); slotKey <= 0x95; slotKey++ {
+		slotKeys = append(slotKeys, slotKey)
+	}
+
+	for _, slotKey := range slotKeys {
+		slot, err := parsePIVSlot(slotKey)
+		require.NoError(t, err)
+
+		err = validatePIVSlot(slot)
+		if validSlots[slotKey] {
+			require.NoError(t, err, "expected slot 0x%x to pass validation", slotKey)
+		} else {
+			require.True(t, trace.IsBadParameter(err), "expected slot 0x%x to fail validation, got %v", slotKey, err)
+		}
+	}
+}
+
+// BenchmarkYubiKeyPrivateKeySign benchmarks repeated signatures over the shared
+// PIV connection, which previously opened a fresh connection per signature.
+func BenchmarkYubiKeyPrivateKeySign(b *testing.B) {
+	// This benchmark expects a yubiKey to be connected with default PIV
+	// settings and will overwrite any PIV data on the yubiKey.
+	if os.Getenv("TELEPORT_TEST_YUBIKEY_PIV") == "" {
+		b.Skipf("Skipping BenchmarkYubiKeyPrivateKeySign because TELEPORT_TEST_YUBIKEY_PIV is not set")
+	}
+
+	priv, err := GetOrGenerateYubiKeyPrivateKey(PrivateKeyPolicyHardwareKey, PIVAlgorithmEC256, 0)
+	require.NoError(b, err)
+
+	digest := sha256.Sum256([]byte("teleport"))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := priv.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(b, err)
+	}
+}
+
 // resetYubikey connects to the first yubiKey and resets it to defaults.
 func resetYubikey(ctx context.Context, t *testing.T) {
 	t.Helper()
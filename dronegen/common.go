@@ -18,8 +18,10 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -93,19 +95,47 @@ var buildboxVersion value
 var goRuntime value
 
 func init() {
-	v, err := exec.Command("make", "-s", "-C", "build.assets", "print-go-version").Output()
+	buildAssetsPath, err := findBuildAssets()
+	if err != nil {
+		log.Fatalf("could not find build.assets: %v", err)
+	}
+
+	v, err := exec.Command("make", "-s", "-C", buildAssetsPath, "print-go-version").Output()
 	if err != nil {
 		log.Fatalf("could not get Go version: %v", err)
 	}
 	goRuntime = value{raw: string(bytes.TrimSpace(v))}
 
-	v, err = exec.Command("make", "-s", "-C", "build.assets", "print-buildbox-version").Output()
+	v, err = exec.Command("make", "-s", "-C", buildAssetsPath, "print-buildbox-version").Output()
 	if err != nil {
 		log.Fatalf("could not get buildbox version: %v", err)
 	}
 	buildboxVersion = value{raw: string(bytes.TrimSpace(v))}
 }
 
+// findBuildAssets locates the build.assets directory by walking up from the
+// working directory. `make dronegen` runs from the repo root while `go test`
+// runs from the package directory; this handles both.
+func findBuildAssets() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		candidate := filepath.Join(dir, "build.assets")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no build.assets directory found in any parent of the working directory")
+		}
+		dir = parent
+	}
+}
+
 func pushTriggerForBranch(branches ...string) trigger {
 	t := trigger{
 		Event: triggerRef{Include: []string{"push"}},
@@ -290,14 +320,28 @@ func waitForDockerStep() step {
 	}
 }
 
-// waitForDockerStep returns a step which checks that the Docker registry is ready
+// Bounds for the docker registry readiness retry loop. Registry startup is
+// occasionally slow or flaky, so the check is retried rather than failing the
+// whole pipeline on the first registry-not-ready error.
+const (
+	registryWaitAttempts     = 10
+	registryWaitSleepSeconds = 5
+)
+
+// waitForDockerRegistryStep returns a step which checks that the Docker registry is ready
 func waitForDockerRegistryStep() step {
+	// The check is read-only so retrying it is always safe.
+	checkCommand := fmt.Sprintf(`[ "$(curl -s -o /dev/null -w %%{http_code} http://%s/)" = "200" ]`, LocalRegistrySocket)
+
 	return step{
 		Name:  "Wait for docker registry",
 		Image: "alpine",
 		Commands: []string{
 			"apk add curl",
-			fmt.Sprintf(`timeout 30s /bin/sh -c 'while [ "$(curl -s -o /dev/null -w %%{http_code} http://%s/)" != "200" ]; do sleep 1; done'`, LocalRegistrySocket),
+			fmt.Sprintf("for attempt in $(seq 1 %d); do %s && break; echo \"Registry not ready yet (attempt $attempt of %d), waiting %d seconds...\"; sleep %d; done",
+				registryWaitAttempts, checkCommand, registryWaitAttempts, registryWaitSleepSeconds, registryWaitSleepSeconds),
+			fmt.Sprintf("%s || (echo 'Docker registry failed to become ready after %d attempts' && exit 1)",
+				checkCommand, registryWaitAttempts),
 		},
 	}
 }
@@ -0,0 +1,34 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForDockerRegistryStepRetries(t *testing.T) {
+	registryWaitStep := waitForDockerRegistryStep()
+	commands := strings.Join(registryWaitStep.Commands, "\n")
+
+	// The readiness check should be retried a bounded number of times with a
+	// sleep between attempts, then fail the pipeline if still not ready.
+	require.Contains(t, commands, fmt.Sprintf("seq 1 %d", registryWaitAttempts))
+	require.Contains(t, commands, fmt.Sprintf("sleep %d", registryWaitSleepSeconds))
+	require.Contains(t, commands, fmt.Sprintf("failed to become ready after %d attempts", registryWaitAttempts))
+}
@@ -30,11 +30,37 @@ const (
 // Describes a Teleport/repo release version. All product releases are tied to Teleport's release cycle
 // via this struct.
 type ReleaseVersion struct {
-	MajorVersion        string // This is the major version of a given build. `SearchVersion` should match this when evaluated.
-	ShellVersion        string // This value will be evaluated by the shell in the context of a Drone step
-	ShellIsPrerelease   string // This value will be evaluated in a shell context to determine if a release version is a prerelease. Must be POSIX compliant and not rely on other external utilities.
-	RelativeVersionName string // The set of values for this should not change between major releases
-	SetupSteps          []step // Version-specific steps that must be ran before executing build and push steps
+	MajorVersion        string               // This is the major version of a given build. `SearchVersion` should match this when evaluated.
+	ShellVersion        string               // This value will be evaluated by the shell in the context of a Drone step
+	ShellIsPrerelease   string               // This value will be evaluated in a shell context to determine if a release version is a prerelease. Must be POSIX compliant and not rely on other external utilities.
+	RelativeVersionName string               // The set of values for this should not change between major releases
+	SetupSteps          []step               // Version-specific steps that must be ran before executing build and push steps
+	ProductConstructors []productConstructor // Constructors for the products built for this version. Defaults to defaultProductConstructors when empty.
+	VarDirectory        string               // Directory that cut semvers are written to. Defaults to varDirectory. Pipelines sharing a workspace must use distinct values.
+}
+
+// getVarDirectory returns the directory that cut semvers are written to,
+// applying the default when the field is unset.
+func (rv *ReleaseVersion) getVarDirectory() string {
+	if rv.VarDirectory != "" {
+		return rv.VarDirectory
+	}
+	return varDirectory
+}
+
+// productConstructor builds a product for a given release version. The cloned
+// repo path is provided for products that are built from the Teleport repo
+// itself rather than from downloaded artifacts.
+type productConstructor func(rv *ReleaseVersion, clonedRepoPath string) *Product
+
+// defaultProductConstructors lists the constructors for every product released
+// on Teleport's release cycle. New container images should be added here so
+// that each release version picks them up while sharing the semver setup steps.
+var defaultProductConstructors = []productConstructor{
+	func(rv *ReleaseVersion, _ string) *Product { return NewTeleportProduct(false, false, rv) }, // OSS
+	func(rv *ReleaseVersion, _ string) *Product { return NewTeleportProduct(true, false, rv) },  // Enterprise
+	func(rv *ReleaseVersion, _ string) *Product { return NewTeleportProduct(true, true, rv) },   // Enterprise/FIPS
+	func(_ *ReleaseVersion, clonedRepoPath string) *Product { return NewTeleportOperatorProduct(clonedRepoPath) },
 }
 
 func (rv *ReleaseVersion) buildVersionPipeline(triggerSetupSteps []step, flags *TriggerFlags) pipeline {
@@ -156,13 +182,13 @@ func (rv *ReleaseVersion) GetSemvers() []*Semver {
 	return []*Semver{
 		{
 			Name:        "major",
-			FilePath:    path.Join(varDirectory, "major-version"),
+			FilePath:    path.Join(rv.getVarDirectory(), "major-version"),
 			FieldCount:  1,
 			IsImmutable: false,
 		},
 		{
 			Name:        "minor",
-			FilePath:    path.Join(varDirectory, "minor-version"),
+			FilePath:    path.Join(rv.getVarDirectory(), "minor-version"),
 			FieldCount:  2,
 			IsImmutable: false,
 		},
@@ -177,7 +203,7 @@ func (rv *ReleaseVersion) GetFullSemver() *Semver {
 		// This is done to keep prereleases pushed to staging
 		//  from overwriting release versions.
 		Name:        "full",
-		FilePath:    path.Join(varDirectory, "full-version"),
+		FilePath:    path.Join(rv.getVarDirectory(), "full-version"),
 		IsImmutable: true,
 		IsFull:      true,
 	}
@@ -246,17 +272,15 @@ func (rv *ReleaseVersion) buildSplitSemverSteps(onlyBuildFullSemver bool) step {
 }
 
 func (rv *ReleaseVersion) getProducts(clonedRepoPath string) []*Product {
-	teleportProducts := []*Product{
-		NewTeleportProduct(false, false, rv), // OSS
-		NewTeleportProduct(true, false, rv),  // Enterprise
-		NewTeleportProduct(true, true, rv),   // Enterprise/FIPS
+	constructors := rv.ProductConstructors
+	if len(constructors) == 0 {
+		constructors = defaultProductConstructors
 	}
 
-	teleportOperatorProduct := NewTeleportOperatorProduct(clonedRepoPath)
-
-	products := make([]*Product, 0, len(teleportProducts)+1)
-	products = append(products, teleportProducts...)
-	products = append(products, teleportOperatorProduct)
+	products := make([]*Product, 0, len(constructors))
+	for _, constructor := range constructors {
+		products = append(products, constructor(rv, clonedRepoPath))
+	}
 
 	return products
 }
@@ -172,12 +172,31 @@ func (cr *ContainerRepo) buildSteps(buildStepDetails []*buildStepOutput, flags *
 
 	steps := make([]step, 0)
 
-	// Tag and push, collecting the names of the tag/push steps and the images pushed.
 	imageTags := cr.BuildImageTags(sourceBuildStep.Version, flags)
+
+	// Fail fast if an immutable tag would be overwritten in the registry.
+	// Mutable tags (major/minor) are allowed to move between builds, so they
+	// get no guard.
+	guardStepNames := make([]string, 0, len(imageTags))
+	for _, imageTag := range imageTags {
+		if !imageTag.IsImmutable {
+			continue
+		}
+
+		guardTag := *imageTag
+		guardTag.Arch = ""
+		guardImage := sourceBuildStep.Product.ImageBuilder(cr, &guardTag)
+		guardStep := cr.immutableTagGuardStep(guardImage)
+		guardStepNames = append(guardStepNames, guardStep.Name)
+		steps = append(steps, guardStep)
+	}
+
+	// Tag and push, collecting the names of the tag/push steps and the images pushed.
 	pushedImages := make(map[*ImageTag][]*Image, len(imageTags))
 	pushStepNames := make([]string, 0, len(buildStepDetails))
 	for _, buildStepDetail := range buildStepDetails {
 		pushStep, pushedArchImages := cr.tagAndPushStep(buildStepDetail, imageTags)
+		pushStep.DependsOn = append(pushStep.DependsOn, guardStepNames...)
 		pushStepNames = append(pushStepNames, pushStep.Name)
 		for _, imageTag := range imageTags {
 			pushedImages[imageTag] = append(pushedImages[imageTag], pushedArchImages[imageTag])
@@ -312,6 +331,25 @@ func (cr *ContainerRepo) tagAndPushStep(buildStepDetails *buildStepOutput, image
 	return step, archImageMap
 }
 
+// Generates a step that fails the pipeline if the given immutable tag already
+// exists in the registry. The push steps themselves skip existing immutable
+// tags, but skipping silently hides an attempted overwrite of a released
+// artifact; this makes it loud instead.
+func (cr *ContainerRepo) immutableTagGuardStep(guardImage *Image) step {
+	commands := cr.buildCommandsWithLogin([]string{
+		fmt.Sprintf("! docker manifest inspect %s > /dev/null 2>&1 || (echo 'Immutable tag %s already exists, refusing to overwrite it' && exit 1)",
+			guardImage.GetShellName(), guardImage.GetDisplayName()),
+	})
+
+	return step{
+		Name:        fmt.Sprintf("Check that immutable tag %q does not exist in %s", guardImage.GetDisplayName(), cr.Name),
+		Image:       "docker",
+		Volumes:     dockerVolumeRefs(volumeRefAwsConfig),
+		Environment: cr.EnvironmentVars,
+		Commands:    commands,
+	}
+}
+
 func (cr *ContainerRepo) createAndPushManifestStep(manifestImage *Image, pushStepNames []string, pushedImages []*Image) step {
 	if len(pushStepNames) == 0 {
 		return step{}
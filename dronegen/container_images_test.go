@@ -0,0 +1,158 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testReleaseVersion() *ReleaseVersion {
+	return &ReleaseVersion{
+		MajorVersion:        "v12",
+		ShellVersion:        "$DRONE_TAG",
+		RelativeVersionName: "branch",
+	}
+}
+
+func newFakeProduct(name string) *Product {
+	return &Product{
+		Name:             name,
+		DockerfilePath:   "/go/build/Dockerfile-" + name,
+		WorkingDirectory: "/go/build",
+		SupportedArchs:   []string{"amd64"},
+		ImageBuilder: func(repo *ContainerRepo, tag *ImageTag) *Image {
+			return &Image{Repo: repo, Name: name, Tag: tag}
+		},
+	}
+}
+
+func TestGetProductsConfigurableConstructors(t *testing.T) {
+	rv := testReleaseVersion()
+	rv.ProductConstructors = []productConstructor{
+		func(rv *ReleaseVersion, _ string) *Product { return newFakeProduct("fake-one") },
+		func(rv *ReleaseVersion, _ string) *Product { return newFakeProduct("fake-two") },
+	}
+
+	pipeline := rv.buildVersionPipeline(nil, &TriggerFlags{
+		ShouldBuildNewImages:        true,
+		ShouldOnlyPublishFullSemver: true,
+	})
+
+	stepsByName := make(map[string]step, len(pipeline.Steps))
+	for _, pipelineStep := range pipeline.Steps {
+		stepsByName[pipelineStep.Name] = pipelineStep
+	}
+
+	// Both products' build steps should be present, and each should depend on
+	// the shared semver setup step.
+	semverStepName := rv.buildSplitSemverSteps(true).Name
+	for _, productName := range []string{"fake-one", "fake-two"} {
+		product := newFakeProduct(productName)
+		buildStepName := product.GetBuildStepName("amd64", rv)
+		buildStep, ok := stepsByName[buildStepName]
+		require.True(t, ok, "expected pipeline to contain step %q", buildStepName)
+		require.Contains(t, buildStep.DependsOn, semverStepName)
+	}
+}
+
+func TestCustomVarDirectory(t *testing.T) {
+	rv := testReleaseVersion()
+	rv.VarDirectory = "/go/var-branch"
+
+	// The cut semvers should be written under the custom directory.
+	semverStep := rv.buildSplitSemverSteps(false)
+	found := false
+	for _, command := range semverStep.Commands {
+		if strings.Contains(command, "/go/var-branch/") {
+			found = true
+		}
+		require.NotContains(t, command, varDirectory+"/")
+	}
+	require.True(t, found, "expected split-semver commands to use the custom var directory")
+
+	// The image tags should read their values from the same directory.
+	for _, imageTag := range rv.getTagsForVersion(false) {
+		require.Contains(t, imageTag.ShellBaseValue, "/go/var-branch/")
+	}
+}
+
+func TestImmutableTagGuardSteps(t *testing.T) {
+	rv := testReleaseVersion()
+	product := newFakeProduct("fake-guard")
+	repo := GetStagingContainerRepo(false)
+	details := []*buildStepOutput{{
+		StepName:   "fake build step",
+		BuiltImage: product.GetLocalRegistryImage("amd64", rv),
+		Version:    rv,
+		Product:    product,
+	}}
+
+	steps := repo.buildSteps(details, &TriggerFlags{})
+
+	var guardSteps []step
+	for _, repoStep := range steps {
+		if strings.HasPrefix(repoStep.Name, "Check that immutable tag") {
+			guardSteps = append(guardSteps, repoStep)
+		}
+	}
+
+	// Only the full semver tag is immutable; the major/minor tags are mutable
+	// and may be overwritten, so they get no guard.
+	require.Len(t, guardSteps, 1)
+	require.Contains(t, guardSteps[0].Name, "full")
+
+	// Push steps should only run once the guard has passed.
+	pushSteps := 0
+	for _, repoStep := range steps {
+		if strings.HasPrefix(repoStep.Name, "Tag and push image") {
+			require.Contains(t, repoStep.DependsOn, guardSteps[0].Name)
+			pushSteps++
+		}
+	}
+	require.NotZero(t, pushSteps)
+}
+
+func TestBuildVersionPipelineArchMatrix(t *testing.T) {
+	rv := testReleaseVersion()
+	pipeline := rv.buildVersionPipeline(nil, &TriggerFlags{
+		ShouldBuildNewImages:        true,
+		ShouldOnlyPublishFullSemver: true,
+	})
+
+	stepNames := make([]string, 0, len(pipeline.Steps))
+	for _, pipelineStep := range pipeline.Steps {
+		stepNames = append(stepNames, pipelineStep.Name)
+	}
+
+	// Each supported arch should get its own build step.
+	operator := NewTeleportOperatorProduct("/go/src/github.com/gravitational/teleport")
+	require.NotEmpty(t, operator.SupportedArchs)
+	for _, arch := range operator.SupportedArchs {
+		require.Contains(t, stepNames, operator.GetBuildStepName(arch, rv))
+	}
+
+	// The arch images should be stitched together by a single manifest push
+	// step for the full semver tag.
+	manifestSteps := 0
+	for _, stepName := range stepNames {
+		if strings.HasPrefix(stepName, "Create manifest and push") && strings.Contains(stepName, "teleport-operator") {
+			manifestSteps++
+		}
+	}
+	require.Equal(t, 1, manifestSteps)
+}
@@ -18,8 +18,10 @@ package auth
 
 import (
 	"context"
+	"time"
 
 	"github.com/gravitational/trace"
+	"golang.org/x/exp/slices"
 
 	"github.com/gravitational/teleport/api/types"
 	apievents "github.com/gravitational/teleport/api/types/events"
@@ -28,6 +30,10 @@ import (
 
 // UpsertRole creates or updates a role and emits a related audit event.
 func (a *Server) UpsertRole(ctx context.Context, role types.Role) error {
+	if err := a.checkRoleRulesConstraint(ctx, role); err != nil {
+		a.emitRoleUpsertBlocked(ctx, role.GetName())
+		return trace.Wrap(err)
+	}
 	if err := a.Services.UpsertRole(ctx, role); err != nil {
 		return trace.Wrap(err)
 	}
@@ -47,8 +53,166 @@ func (a *Server) UpsertRole(ctx context.Context, role types.Role) error {
 	return nil
 }
 
+// UpdateRole updates an existing role and emits a related audit event. Unlike
+// UpsertRole, it returns a NotFound error when the role does not already
+// exist, so an edit against a stale role name does not create it.
+func (a *Server) UpdateRole(ctx context.Context, role types.Role) error {
+	if _, err := a.Services.GetRole(ctx, role.GetName()); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := a.checkRoleRulesConstraint(ctx, role); err != nil {
+		a.emitRoleUpsertBlocked(ctx, role.GetName())
+		return trace.Wrap(err)
+	}
+	if err := a.Services.UpsertRole(ctx, role); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := a.emitter.EmitAuditEvent(a.closeCtx, &apievents.RoleCreate{
+		Metadata: apievents.Metadata{
+			Type: events.RoleUpdatedEvent,
+			Code: events.RoleUpdatedCode,
+		},
+		UserMetadata: ClientUserMetadata(ctx),
+		ResourceMetadata: apievents.ResourceMetadata{
+			Name: role.GetName(),
+		},
+	}); err != nil {
+		log.WithError(err).Warnf("Failed to emit role update event.")
+	}
+	return nil
+}
+
+// CheckRoleUpsert runs the same validation as UpsertRole without persisting
+// the role or emitting audit events, so clients can surface constraint
+// violations before saving.
+func (a *Server) CheckRoleUpsert(ctx context.Context, role types.Role) error {
+	if err := role.CheckAndSetDefaults(); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := a.checkRoleRulesConstraint(ctx, role); err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// checkRoleRulesConstraint verifies that saving the provided role would not
+// leave the cluster in a state where no user can update roles. The check
+// only fails when some user could update roles before the change and none
+// could after it, so bootstrapping clusters without users remain unaffected.
+// By default only local users count toward the determination; the
+// WithSSOUsersInRulesConstraint server option also counts SSO-mapped users.
+func (a *Server) checkRoleRulesConstraint(ctx context.Context, role types.Role) error {
+	users, err := a.Services.GetUsers(false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	existing, err := a.Services.GetRoles(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	roles := make(map[string]types.Role, len(existing))
+	for _, r := range existing {
+		roles[r.GetName()] = r
+	}
+	if !a.usersCanUpdateRoles(users, roles) {
+		return nil
+	}
+	roles[role.GetName()] = role
+	if a.usersCanUpdateRoles(users, roles) {
+		return nil
+	}
+	return trace.BadParameter("rejecting role %v: no local user would be left with permission to update roles", role.GetName())
+}
+
+// usersCanUpdateRoles returns true if at least one user holds a role
+// allowing the update verb on role resources. SSO-mapped users only count
+// when the server was configured with WithSSOUsersInRulesConstraint.
+func (a *Server) usersCanUpdateRoles(users []types.User, roles map[string]types.Role) bool {
+	for _, user := range users {
+		if user.GetCreatedBy().Connector != nil && !a.countSSOUsersInRulesConstraint {
+			continue
+		}
+		for _, name := range user.GetRoles() {
+			role, ok := roles[name]
+			if !ok {
+				continue
+			}
+			if roleAllowsUpdateRoles(role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// roleAllowsUpdateRoles returns true if the role's allow rules include the
+// update verb on role resources.
+func roleAllowsUpdateRoles(role types.Role) bool {
+	for _, rule := range role.GetRules(types.Allow) {
+		if !rule.HasResource(types.KindRole) && !rule.HasResource(types.Wildcard) {
+			continue
+		}
+		if rule.HasVerb(types.VerbUpdate) || rule.HasVerb(types.Wildcard) {
+			return true
+		}
+	}
+	return false
+}
+
 // DeleteRole deletes a role and emits a related audit event.
 func (a *Server) DeleteRole(ctx context.Context, name string) error {
+	if err := a.checkRoleNotInUse(ctx, name); err != nil {
+		a.emitRoleDeleteBlocked(ctx, name)
+		return trace.Wrap(err)
+	}
+
+	if err := a.Services.DeleteRole(ctx, name); err != nil {
+		return trace.Wrap(err)
+	}
+
+	a.emitRoleDeleted(ctx, name)
+	return nil
+}
+
+// DeleteRoles deletes multiple roles with all-or-nothing semantics: every
+// role is first run through the same in-use checks as DeleteRole, and no
+// role is deleted unless all of them pass. When some roles are blocked, an
+// aggregated error listing each blocked role is returned.
+func (a *Server) DeleteRoles(ctx context.Context, names []string) error {
+	var errs []error
+	for _, name := range names {
+		if _, err := a.Services.GetRole(ctx, name); err != nil {
+			errs = append(errs, trace.Wrap(err))
+			continue
+		}
+		if err := a.checkRoleNotInUse(ctx, name); err != nil {
+			a.emitRoleDeleteBlocked(ctx, name)
+			errs = append(errs, trace.BadParameter("role %q: %v", name, err))
+		}
+	}
+	// deleting the whole batch must not leave the cluster without a local
+	// user able to update roles
+	if err := a.checkRolesDeleteRulesConstraint(ctx, names); err != nil {
+		errs = append(errs, trace.Wrap(err))
+	}
+	if len(errs) > 0 {
+		return trace.NewAggregate(errs...)
+	}
+
+	for _, name := range names {
+		if err := a.Services.DeleteRole(ctx, name); err != nil {
+			return trace.Wrap(err)
+		}
+		a.emitRoleDeleted(ctx, name)
+	}
+	return nil
+}
+
+// checkRoleNotInUse returns a masked error if the named role is still
+// referenced by a user, a user cert authority or an SSO connector mapping.
+func (a *Server) checkRoleNotInUse(ctx context.Context, name string) error {
 	// check if this role is used by CA or Users
 	users, err := a.Services.GetUsers(false)
 	if err != nil {
@@ -70,21 +234,56 @@ func (a *Server) DeleteRole(ctx context.Context, name string) error {
 	if err != nil {
 		return trace.Wrap(err)
 	}
-	for _, a := range cas {
-		for _, r := range a.GetRoles() {
+	for _, ca := range cas {
+		for _, r := range ca.GetRoles() {
 			if r == name {
 				// Mask the actual error here as it could be used to enumerate users
 				// within the system.
-				log.Warnf("Failed to delete role: role %v is used by user cert authority %v", name, a.GetClusterName())
+				log.Warnf("Failed to delete role: role %v is used by user cert authority %v", name, ca.GetClusterName())
 				return trace.BadParameter("failed to delete role that still in use by a user. Check system server logs for more details.")
 			}
 		}
 	}
+	// check if it's referenced by SSO connector role mappings, deleting
+	// such a role would break logins for externally mapped identities
+	if err := a.checkRoleNotMappedByConnectors(ctx, name); err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
 
-	if err := a.Services.DeleteRole(ctx, name); err != nil {
+// checkRolesDeleteRulesConstraint verifies that deleting the named roles
+// would not leave the cluster in a state where no local user can update
+// roles, mirroring checkRoleRulesConstraint for upserts.
+func (a *Server) checkRolesDeleteRulesConstraint(ctx context.Context, names []string) error {
+	users, err := a.Services.GetUsers(false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	existing, err := a.Services.GetRoles(ctx)
+	if err != nil {
 		return trace.Wrap(err)
 	}
 
+	roles := make(map[string]types.Role, len(existing))
+	for _, r := range existing {
+		roles[r.GetName()] = r
+	}
+	if !a.usersCanUpdateRoles(users, roles) {
+		return nil
+	}
+	for _, name := range names {
+		delete(roles, name)
+	}
+	if a.usersCanUpdateRoles(users, roles) {
+		return nil
+	}
+	return trace.BadParameter("rejecting deletion: no local user would be left with permission to update roles")
+}
+
+// emitRoleDeleted emits the audit event recording a successful role
+// deletion.
+func (a *Server) emitRoleDeleted(ctx context.Context, name string) {
 	if err := a.emitter.EmitAuditEvent(a.closeCtx, &apievents.RoleDelete{
 		Metadata: apievents.Metadata{
 			Type: events.RoleDeletedEvent,
@@ -97,12 +296,161 @@ func (a *Server) DeleteRole(ctx context.Context, name string) error {
 	}); err != nil {
 		log.WithError(err).Warnf("Failed to emit role delete event.")
 	}
+}
+
+// checkRoleNotMappedByConnectors returns an error if the named role is
+// referenced by any OIDC, SAML or Github connector role mapping.
+func (a *Server) checkRoleNotMappedByConnectors(ctx context.Context, name string) error {
+	oidcConnectors, err := a.Services.GetOIDCConnectors(ctx, false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, connector := range oidcConnectors {
+		for _, mapping := range connector.GetClaimsToRoles() {
+			if slices.Contains(mapping.Roles, name) {
+				// Mask the actual error here as it could be used to enumerate
+				// connectors within the system.
+				log.Warnf("Failed to delete role: role %v is mapped by OIDC connector %v.", name, connector.GetName())
+				return trace.BadParameter("failed to delete role that is still in use by a connector. Check system server logs for more details.")
+			}
+		}
+	}
+	samlConnectors, err := a.Services.GetSAMLConnectors(ctx, false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, connector := range samlConnectors {
+		for _, mapping := range connector.GetAttributesToRoles() {
+			if slices.Contains(mapping.Roles, name) {
+				// Mask the actual error here as it could be used to enumerate
+				// connectors within the system.
+				log.Warnf("Failed to delete role: role %v is mapped by SAML connector %v.", name, connector.GetName())
+				return trace.BadParameter("failed to delete role that is still in use by a connector. Check system server logs for more details.")
+			}
+		}
+	}
+	githubConnectors, err := a.Services.GetGithubConnectors(ctx, false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, connector := range githubConnectors {
+		for _, mapping := range connector.GetTeamsToRoles() {
+			if slices.Contains(mapping.Roles, name) {
+				// Mask the actual error here as it could be used to enumerate
+				// connectors within the system.
+				log.Warnf("Failed to delete role: role %v is mapped by Github connector %v.", name, connector.GetName())
+				return trace.BadParameter("failed to delete role that is still in use by a connector. Check system server logs for more details.")
+			}
+		}
+	}
+	return nil
+}
+
+// SweepExpiredLocks emits a lock expiry audit event for every lock whose
+// expiry time has passed. Locks removed by backend TTL never go through
+// DeleteLock, so without the sweep their disappearance would leave no audit
+// trail. Each expiry is emitted exactly once per lock name and expiry time,
+// so a lock recreated with a new expiry gets a new event.
+func (a *Server) SweepExpiredLocks(ctx context.Context) error {
+	locks, err := a.Services.GetLocks(ctx, false)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	now := a.GetClock().Now()
+	for _, lock := range locks {
+		expires := lock.LockExpiry()
+		if expires == nil || now.Before(*expires) {
+			continue
+		}
+		if !a.markLockExpiryNotified(lock.GetName(), *expires) {
+			continue
+		}
+		if err := a.emitter.EmitAuditEvent(a.closeCtx, &apievents.LockDelete{
+			Metadata: apievents.Metadata{
+				Type: events.LockExpiredEvent,
+				Code: events.LockExpiredCode,
+			},
+			UserMetadata: ClientUserMetadata(ctx),
+			ResourceMetadata: apievents.ResourceMetadata{
+				Name:    lock.GetName(),
+				Expires: *expires,
+			},
+		}); err != nil {
+			log.WithError(err).Warning("Failed to emit lock expiry event.")
+		}
+	}
 	return nil
 }
 
+// markLockExpiryNotified records that an expiry event has been emitted for
+// the given lock, returning false if it already was.
+func (a *Server) markLockExpiryNotified(name string, expires time.Time) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.lockExpiryNotified == nil {
+		a.lockExpiryNotified = make(map[string]time.Time)
+	}
+	if notified, ok := a.lockExpiryNotified[name]; ok && notified.Equal(expires) {
+		return false
+	}
+	a.lockExpiryNotified[name] = expires
+	return true
+}
+
+// emitRoleDeleteBlocked emits an audit event recording a refused role
+// deletion, so operators can see who attempted it. The event carries the
+// requesting user; the detailed reason is masked the same way it is masked
+// in the returned error and stays in the server logs.
+func (a *Server) emitRoleDeleteBlocked(ctx context.Context, name string) {
+	if err := a.emitter.EmitAuditEvent(a.closeCtx, &apievents.RoleDelete{
+		Metadata: apievents.Metadata{
+			Type: events.RoleDeleteBlockedEvent,
+			Code: events.RoleDeleteBlockedCode,
+		},
+		UserMetadata: ClientUserMetadata(ctx),
+		ResourceMetadata: apievents.ResourceMetadata{
+			Name: name,
+		},
+	}); err != nil {
+		log.WithError(err).Warnf("Failed to emit blocked role delete event.")
+	}
+}
+
+// emitRoleUpsertBlocked emits an audit event recording a role create or
+// update refused by the role rules constraint check.
+func (a *Server) emitRoleUpsertBlocked(ctx context.Context, name string) {
+	if err := a.emitter.EmitAuditEvent(a.closeCtx, &apievents.RoleCreate{
+		Metadata: apievents.Metadata{
+			Type: events.RoleUpsertBlockedEvent,
+			Code: events.RoleUpsertBlockedCode,
+		},
+		UserMetadata: ClientUserMetadata(ctx),
+		ResourceMetadata: apievents.ResourceMetadata{
+			Name: name,
+		},
+	}); err != nil {
+		log.WithError(err).Warnf("Failed to emit blocked role upsert event.")
+	}
+}
+
 // UpsertLock upserts a lock and emits a related audit event.
 func (a *Server) UpsertLock(ctx context.Context, lock types.Lock) error {
 	if err := a.Services.UpsertLock(ctx, lock); err != nil {
+		um := ClientUserMetadata(ctx)
+		if emitErr := a.emitter.EmitAuditEvent(a.closeCtx, &apievents.LockCreate{
+			Metadata: apievents.Metadata{
+				Type: events.LockCreateBlockedEvent,
+				Code: events.LockCreateBlockedCode,
+			},
+			UserMetadata: um,
+			ResourceMetadata: apievents.ResourceMetadata{
+				Name:      lock.GetName(),
+				UpdatedBy: um.User,
+			},
+			Target: lock.Target(),
+		}); emitErr != nil {
+			log.WithError(emitErr).Warning("Failed to emit blocked lock create event.")
+		}
 		return trace.Wrap(err)
 	}
 
@@ -127,6 +475,18 @@ func (a *Server) UpsertLock(ctx context.Context, lock types.Lock) error {
 // DeleteLock deletes a lock and emits a related audit event.
 func (a *Server) DeleteLock(ctx context.Context, lockName string) error {
 	if err := a.Services.DeleteLock(ctx, lockName); err != nil {
+		if emitErr := a.emitter.EmitAuditEvent(a.closeCtx, &apievents.LockDelete{
+			Metadata: apievents.Metadata{
+				Type: events.LockDeleteBlockedEvent,
+				Code: events.LockDeleteBlockedCode,
+			},
+			UserMetadata: ClientUserMetadata(ctx),
+			ResourceMetadata: apievents.ResourceMetadata{
+				Name: lockName,
+			},
+		}); emitErr != nil {
+			log.WithError(emitErr).Warning("Failed to emit blocked lock delete event.")
+		}
 		return trace.Wrap(err)
 	}
 
@@ -19,8 +19,10 @@ package auth
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
 	"github.com/stretchr/testify/require"
 
 	"github.com/gravitational/teleport/api/types"
@@ -68,6 +70,356 @@ func TestUpsertDeleteRoleEventsEmitted(t *testing.T) {
 	require.Nil(t, p.mockEmitter.LastEvent())
 }
 
+func TestUpdateRole(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p, err := newTestPack(ctx, t.TempDir())
+	require.NoError(t, err)
+
+	role, err := types.NewRoleV3("test-role", types.RoleSpecV5{
+		Options: types.RoleOptions{},
+		Allow:   types.RoleConditions{},
+	})
+	require.NoError(t, err)
+
+	// Updating a role that does not exist fails and does not create it.
+	err = p.a.UpdateRole(ctx, role)
+	require.True(t, trace.IsNotFound(err))
+	require.Nil(t, p.mockEmitter.LastEvent())
+	_, err = p.a.Services.GetRole(ctx, role.GetName())
+	require.True(t, trace.IsNotFound(err))
+
+	// UpsertRole creates the role.
+	err = p.a.UpsertRole(ctx, role)
+	require.NoError(t, err)
+	require.Equal(t, events.RoleCreatedEvent, p.mockEmitter.LastEvent().GetType())
+	p.mockEmitter.Reset()
+
+	// Updating an existing role succeeds and emits a RoleUpdatedEvent.
+	err = p.a.UpdateRole(ctx, role)
+	require.NoError(t, err)
+	require.Equal(t, events.RoleUpdatedEvent, p.mockEmitter.LastEvent().GetType())
+	require.Equal(t, events.RoleUpdatedCode, p.mockEmitter.LastEvent().GetCode())
+	require.Equal(t, role.GetName(), p.mockEmitter.LastEvent().(*apievents.RoleCreate).Name)
+}
+
+func TestDeleteRoleMappedByConnector(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p, err := newTestPack(ctx, t.TempDir())
+	require.NoError(t, err)
+
+	role, err := types.NewRoleV3("sso-mapped-role", types.RoleSpecV5{
+		Options: types.RoleOptions{},
+		Allow:   types.RoleConditions{},
+	})
+	require.NoError(t, err)
+	err = p.a.UpsertRole(ctx, role)
+	require.NoError(t, err)
+
+	connector, err := types.NewGithubConnector("test-github", types.GithubConnectorSpecV3{
+		ClientID:     "example-client-id",
+		ClientSecret: "example-client-secret",
+		RedirectURL:  "https://localhost:3080/v1/webapi/github/callback",
+		TeamsToRoles: []types.TeamRolesMapping{
+			{
+				Organization: "octocats",
+				Team:         "admins",
+				Roles:        []string{role.GetName()},
+			},
+		},
+	})
+	require.NoError(t, err)
+	err = p.a.Services.UpsertGithubConnector(ctx, connector)
+	require.NoError(t, err)
+
+	// Deleting a role mapped by a connector is refused with a masked error.
+	err = p.a.DeleteRole(ctx, role.GetName())
+	require.True(t, trace.IsBadParameter(err), "expected BadParameter, got %v", err)
+
+	// Once the connector is removed the role can be deleted.
+	err = p.a.Services.DeleteGithubConnector(ctx, connector.GetName())
+	require.NoError(t, err)
+	err = p.a.DeleteRole(ctx, role.GetName())
+	require.NoError(t, err)
+}
+
+func TestLockExpiryEventEmitted(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p, err := newTestPack(ctx, t.TempDir())
+	require.NoError(t, err)
+	clock := clockwork.NewFakeClock()
+	p.a.SetClock(clock)
+
+	expires := clock.Now().Add(time.Minute)
+	lock, err := types.NewLock("ttl-lock", types.LockSpecV2{
+		Target:  types.LockTarget{User: "locked-user"},
+		Expires: &expires,
+	})
+	require.NoError(t, err)
+	err = p.a.UpsertLock(ctx, lock)
+	require.NoError(t, err)
+	p.mockEmitter.Reset()
+
+	// The lock has not expired yet, so the sweep emits nothing.
+	err = p.a.SweepExpiredLocks(ctx)
+	require.NoError(t, err)
+	require.Nil(t, p.mockEmitter.LastEvent())
+
+	// Once the expiry passes, the sweep emits the expiry event exactly once.
+	clock.Advance(2 * time.Minute)
+	err = p.a.SweepExpiredLocks(ctx)
+	require.NoError(t, err)
+	require.Equal(t, events.LockExpiredEvent, p.mockEmitter.LastEvent().GetType())
+	require.Equal(t, events.LockExpiredCode, p.mockEmitter.LastEvent().GetCode())
+	require.Equal(t, lock.GetName(), p.mockEmitter.LastEvent().(*apievents.LockDelete).Name)
+	require.Len(t, p.mockEmitter.Events(), 1)
+
+	err = p.a.SweepExpiredLocks(ctx)
+	require.NoError(t, err)
+	require.Len(t, p.mockEmitter.Events(), 1)
+}
+
+func TestCheckRoleUpsert(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p, err := newTestPack(ctx, t.TempDir())
+	require.NoError(t, err)
+
+	editor, err := types.NewRoleV3("editor", types.RoleSpecV5{
+		Allow: types.RoleConditions{
+			Rules: []types.Rule{
+				{
+					Resources: []string{types.KindRole},
+					Verbs:     []string{types.VerbUpdate},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	err = p.a.UpsertRole(ctx, editor)
+	require.NoError(t, err)
+
+	user, err := types.NewUser("role-editor")
+	require.NoError(t, err)
+	user.SetRoles([]string{editor.GetName()})
+	err = p.a.Services.UpsertUser(user)
+	require.NoError(t, err)
+	p.mockEmitter.Reset()
+
+	// Removing the update-roles rule from the only editing role would lock
+	// everyone out; the dry run catches it without persisting or emitting.
+	lockedOut, err := types.NewRoleV3("editor", types.RoleSpecV5{
+		Options: types.RoleOptions{},
+		Allow:   types.RoleConditions{},
+	})
+	require.NoError(t, err)
+	err = p.a.CheckRoleUpsert(ctx, lockedOut)
+	require.True(t, trace.IsBadParameter(err), "expected BadParameter, got %v", err)
+	require.Nil(t, p.mockEmitter.LastEvent())
+
+	stored, err := p.a.Services.GetRole(ctx, editor.GetName())
+	require.NoError(t, err)
+	require.NotEmpty(t, stored.GetRules(types.Allow))
+
+	// A harmless change passes the dry run and changes nothing.
+	relabeled, err := types.NewRoleV3("editor", types.RoleSpecV5{
+		Allow: types.RoleConditions{
+			Rules: []types.Rule{
+				{
+					Resources: []string{types.KindRole},
+					Verbs:     []string{types.VerbUpdate, types.VerbRead},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	err = p.a.CheckRoleUpsert(ctx, relabeled)
+	require.NoError(t, err)
+	require.Nil(t, p.mockEmitter.LastEvent())
+}
+
+func TestRulesConstraintSSOUsers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	newEditorRole := func(t *testing.T, name string) types.Role {
+		role, err := types.NewRoleV3(name, types.RoleSpecV5{
+			Allow: types.RoleConditions{
+				Rules: []types.Rule{
+					{
+						Resources: []string{types.KindRole},
+						Verbs:     []string{types.VerbUpdate},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		return role
+	}
+	newWeakenedRole := func(t *testing.T, name string) types.Role {
+		role, err := types.NewRoleV3(name, types.RoleSpecV5{
+			Options: types.RoleOptions{},
+			Allow:   types.RoleConditions{},
+		})
+		require.NoError(t, err)
+		return role
+	}
+	upsertUser := func(t *testing.T, p testPack, name, role string, sso bool) {
+		user, err := types.NewUser(name)
+		require.NoError(t, err)
+		user.SetRoles([]string{role})
+		if sso {
+			user.SetCreatedBy(types.CreatedBy{
+				Connector: &types.ConnectorRef{Type: "oidc", ID: "example"},
+			})
+		}
+		err = p.a.Services.UpsertUser(user)
+		require.NoError(t, err)
+	}
+
+	t.Run("sso-only strict default", func(t *testing.T) {
+		p, err := newTestPack(ctx, t.TempDir())
+		require.NoError(t, err)
+		require.NoError(t, p.a.UpsertRole(ctx, newEditorRole(t, "editor")))
+		upsertUser(t, p, "sso-admin", "editor", true)
+
+		// SSO users don't count by default, so the edit is not blocked.
+		err = p.a.UpsertRole(ctx, newWeakenedRole(t, "editor"))
+		require.NoError(t, err)
+	})
+
+	t.Run("sso-only with option", func(t *testing.T) {
+		p, err := newTestPack(ctx, t.TempDir(), WithSSOUsersInRulesConstraint())
+		require.NoError(t, err)
+		require.NoError(t, p.a.UpsertRole(ctx, newEditorRole(t, "editor")))
+		upsertUser(t, p, "sso-admin", "editor", true)
+
+		// The SSO admin counts, so removing their update-roles rule would
+		// lock everyone out.
+		err = p.a.UpsertRole(ctx, newWeakenedRole(t, "editor"))
+		require.True(t, trace.IsBadParameter(err), "expected BadParameter, got %v", err)
+	})
+
+	t.Run("mixed deployment", func(t *testing.T) {
+		p, err := newTestPack(ctx, t.TempDir(), WithSSOUsersInRulesConstraint())
+		require.NoError(t, err)
+		require.NoError(t, p.a.UpsertRole(ctx, newEditorRole(t, "local-editor")))
+		require.NoError(t, p.a.UpsertRole(ctx, newEditorRole(t, "sso-editor")))
+		upsertUser(t, p, "local-admin", "local-editor", false)
+		upsertUser(t, p, "sso-admin", "sso-editor", true)
+
+		// The SSO admin retains the update-roles rule, so weakening the
+		// local editor role is a legitimate edit.
+		err = p.a.UpsertRole(ctx, newWeakenedRole(t, "local-editor"))
+		require.NoError(t, err)
+	})
+
+	t.Run("mixed deployment strict default", func(t *testing.T) {
+		p, err := newTestPack(ctx, t.TempDir())
+		require.NoError(t, err)
+		require.NoError(t, p.a.UpsertRole(ctx, newEditorRole(t, "local-editor")))
+		require.NoError(t, p.a.UpsertRole(ctx, newEditorRole(t, "sso-editor")))
+		upsertUser(t, p, "local-admin", "local-editor", false)
+		upsertUser(t, p, "sso-admin", "sso-editor", true)
+
+		// Only local users count, so weakening the only local editing role
+		// is blocked.
+		err = p.a.UpsertRole(ctx, newWeakenedRole(t, "local-editor"))
+		require.True(t, trace.IsBadParameter(err), "expected BadParameter, got %v", err)
+	})
+}
+
+func TestDeleteRoles(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p, err := newTestPack(ctx, t.TempDir())
+	require.NoError(t, err)
+
+	var names []string
+	for _, name := range []string{"batch-role-1", "batch-role-2", "batch-role-3"} {
+		role, err := types.NewRoleV3(name, types.RoleSpecV5{
+			Options: types.RoleOptions{},
+			Allow:   types.RoleConditions{},
+		})
+		require.NoError(t, err)
+		err = p.a.UpsertRole(ctx, role)
+		require.NoError(t, err)
+		names = append(names, name)
+	}
+	p.mockEmitter.Reset()
+
+	// When one role is blocked, nothing is deleted.
+	user, err := types.NewUser("batch-role-holder")
+	require.NoError(t, err)
+	user.SetRoles([]string{"batch-role-2"})
+	err = p.a.Services.UpsertUser(user)
+	require.NoError(t, err)
+
+	err = p.a.DeleteRoles(ctx, names)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "batch-role-2")
+	for _, name := range names {
+		_, err := p.a.Services.GetRole(ctx, name)
+		require.NoError(t, err, "role %v should not have been deleted", name)
+	}
+
+	// Once the blocking user is removed, the whole batch is deleted and one
+	// delete event is emitted per role.
+	err = p.a.Services.DeleteUser(ctx, user.GetName())
+	require.NoError(t, err)
+	p.mockEmitter.Reset()
+
+	err = p.a.DeleteRoles(ctx, names)
+	require.NoError(t, err)
+	deleted := make(map[string]bool)
+	for _, event := range p.mockEmitter.Events() {
+		require.Equal(t, events.RoleDeletedEvent, event.GetType())
+		deleted[event.(*apievents.RoleDelete).Name] = true
+	}
+	require.Len(t, deleted, len(names))
+	for _, name := range names {
+		_, err := p.a.Services.GetRole(ctx, name)
+		require.True(t, trace.IsNotFound(err))
+	}
+}
+
+func TestRoleDeleteBlockedEventEmitted(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p, err := newTestPack(ctx, t.TempDir())
+	require.NoError(t, err)
+
+	role, err := types.NewRoleV3("in-use-role", types.RoleSpecV5{
+		Options: types.RoleOptions{},
+		Allow:   types.RoleConditions{},
+	})
+	require.NoError(t, err)
+	err = p.a.UpsertRole(ctx, role)
+	require.NoError(t, err)
+	p.mockEmitter.Reset()
+
+	user, err := types.NewUser("role-holder")
+	require.NoError(t, err)
+	user.SetRoles([]string{role.GetName()})
+	err = p.a.Services.UpsertUser(user)
+	require.NoError(t, err)
+
+	// A refused deletion emits a blocked event recording the attempt.
+	err = p.a.DeleteRole(ctx, role.GetName())
+	require.True(t, trace.IsBadParameter(err), "expected BadParameter, got %v", err)
+	require.Equal(t, events.RoleDeleteBlockedEvent, p.mockEmitter.LastEvent().GetType())
+	require.Equal(t, events.RoleDeleteBlockedCode, p.mockEmitter.LastEvent().GetCode())
+	require.Equal(t, role.GetName(), p.mockEmitter.LastEvent().(*apievents.RoleDelete).Name)
+
+	// When deleting a nonexistent role, no blocked event is emitted.
+	p.mockEmitter.Reset()
+	err = p.a.DeleteRole(ctx, "nonexistent-role")
+	require.True(t, trace.IsNotFound(err))
+	require.Nil(t, p.mockEmitter.LastEvent())
+}
+
 func TestUpsertDeleteLockEventsEmitted(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -87,11 +439,13 @@ func TestUpsertDeleteLockEventsEmitted(t *testing.T) {
 	require.Equal(t, lock.Target(), p.mockEmitter.LastEvent().(*apievents.LockCreate).Target)
 	p.mockEmitter.Reset()
 
-	// When a lock update results in an error, no event should be emitted.
+	// When a lock update results in an error, a blocked event should be emitted.
 	lock.SetTarget(types.LockTarget{})
 	err = p.a.UpsertLock(ctx, lock)
 	require.Error(t, err)
-	require.Nil(t, p.mockEmitter.LastEvent())
+	require.Equal(t, events.LockCreateBlockedEvent, p.mockEmitter.LastEvent().GetType())
+	require.Equal(t, events.LockCreateBlockedCode, p.mockEmitter.LastEvent().GetCode())
+	p.mockEmitter.Reset()
 
 	// Updating a lock should emit a LockCreatedEvent.
 	lock.SetTarget(types.LockTarget{Role: "test-role"})
@@ -109,8 +463,10 @@ func TestUpsertDeleteLockEventsEmitted(t *testing.T) {
 	require.Equal(t, lock.GetName(), p.mockEmitter.LastEvent().(*apievents.LockDelete).Name)
 	p.mockEmitter.Reset()
 
-	// When deleting a nonexistent lock, no event should be emitted.
+	// When deleting a nonexistent lock, a blocked event should be emitted.
 	err = p.a.DeleteLock(ctx, lock.GetName())
 	require.True(t, trace.IsNotFound(err))
-	require.Nil(t, p.mockEmitter.LastEvent())
+	require.Equal(t, events.LockDeleteBlockedEvent, p.mockEmitter.LastEvent().GetType())
+	require.Equal(t, events.LockDeleteBlockedCode, p.mockEmitter.LastEvent().GetCode())
+	require.Equal(t, lock.GetName(), p.mockEmitter.LastEvent().(*apievents.LockDelete).Name)
 }
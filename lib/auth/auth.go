@@ -106,6 +106,17 @@ var ErrRequiresEnterprise = services.ErrRequiresEnterprise
 // ServerOption allows setting options as functional arguments to Server
 type ServerOption func(*Server) error
 
+// WithSSOUsersInRulesConstraint is a functional server option that makes the
+// role rules constraint check also count SSO-mapped users toward the "someone
+// can still update roles" determination, so SSO-only clusters are not blocked
+// from legitimate role edits. The default counts local users only.
+func WithSSOUsersInRulesConstraint() ServerOption {
+	return func(s *Server) error {
+		s.countSSOUsersInRulesConstraint = true
+		return nil
+	}
+}
+
 // NewServer creates and configures a new Server instance
 func NewServer(cfg *InitConfig, opts ...ServerOption) (*Server, error) {
 	err := metrics.RegisterPrometheusCollectors(prometheusCollectors...)
@@ -403,6 +414,15 @@ type Server struct {
 	clock         clockwork.Clock
 	bk            backend.Backend
 
+	// lockExpiryNotified keeps track of lock expirations for which an audit
+	// event has already been emitted, keyed by lock name.
+	lockExpiryNotified map[string]time.Time
+
+	// countSSOUsersInRulesConstraint makes the role rules constraint check
+	// count SSO-mapped users toward the "someone can still update roles"
+	// determination. The strict default counts local users only.
+	countSSOUsersInRulesConstraint bool
+
 	closeCtx   context.Context
 	cancelFunc context.CancelFunc
 
@@ -587,6 +607,9 @@ func (a *Server) runPeriodicOperations() {
 					log.Errorf("Failed to perform cert rotation check: %v.", err)
 				}
 			}
+			if err := a.SweepExpiredLocks(ctx); err != nil {
+				log.Errorf("Failed to sweep expired locks: %v.", err)
+			}
 		case <-heartbeatCheckTicker.Next():
 			nodes, err := a.GetNodes(ctx, apidefaults.Namespace)
 			if err != nil {
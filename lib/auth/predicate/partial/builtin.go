@@ -0,0 +1,182 @@
+/*
+Copyright 2023 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package partial
+
+import (
+	"go/ast"
+	"strings"
+
+	"github.com/aclements/go-z3/z3"
+	"github.com/gravitational/trace"
+)
+
+// builtin describes a predicate function the solver can lower calls to.
+// declare creates the z3 function declaration, created once per
+// lowering pass, and axiomatize pins its interpretation down over the
+// solver's interned string universe once lowering is complete. A
+// builtin with its own lowering rule sets lower instead, bypassing the
+// declaration machinery.
+type builtin struct {
+	arity      int
+	declare    func(c *ctx) z3.FuncDecl
+	axiomatize func(c *ctx, decl z3.FuncDecl)
+	lower      func(c *ctx, node *ast.CallExpr) (z3.Value, error)
+}
+
+// builtins registers the predicate functions known to the solver;
+// adding one is a single entry here. The map is populated in init to
+// break the initialization cycle through the lowering functions.
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		"strings.upper":     {arity: 1, declare: declareUpper, axiomatize: axiomatizeUpper},
+		"strings.lower":     {arity: 1, declare: declareLower, axiomatize: axiomatizeLower},
+		"strings.hasPrefix": {arity: 2, declare: declareHasPrefix, axiomatize: axiomatizeHasPrefix},
+		"strings.hasSuffix": {arity: 2, declare: declareHasSuffix, axiomatize: axiomatizeHasSuffix},
+		"contains":          {arity: 2, lower: lowerContains},
+		"len":               {arity: 1, declare: declareLength, axiomatize: axiomatizeLength},
+	}
+}
+
+// lowerContains lowers contains(list, x). When the resolver supplies
+// the list's elements, the call becomes a disjunction of equalities
+// over them; membership in a list the resolver does not know stays
+// symbolic, modeled as an uninterpreted predicate on the element.
+func lowerContains(c *ctx, node *ast.CallExpr) (z3.Value, error) {
+	name, err := evaluateSelector(node.Args[0])
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	hint := c.s.strSort
+	elem, err := c.lowerExpr(node.Args[1], &hint)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	ue, ok := elem.(z3.Uninterpreted)
+	if !ok {
+		return nil, trace.BadParameter("contains requires a string element, got %v", elem.Sort())
+	}
+	val, known := c.resolver(name)
+	if !known {
+		membership := c.def.FuncDecl("contains!"+name, []z3.Sort{c.s.strSort}, c.def.BoolSort())
+		return membership.Apply(ue), nil
+	}
+	members, ok := val.([]string)
+	if !ok {
+		return nil, trace.BadParameter("identifier %q is not a list", name)
+	}
+	if len(members) == 0 {
+		return c.def.FromBool(false), nil
+	}
+	eqs := make([]z3.Bool, 0, len(members))
+	for _, member := range members {
+		eqs = append(eqs, ue.Eq(c.s.intern(member).(z3.Uninterpreted)))
+	}
+	return eqs[0].Or(eqs[1:]...), nil
+}
+
+// declareUpper declares strings.upper as an uninterpreted function over
+// the solver's string sort.
+func declareUpper(c *ctx) z3.FuncDecl {
+	return c.def.FuncDecl("strings.upper", []z3.Sort{c.s.strSort}, c.s.strSort)
+}
+
+func axiomatizeUpper(c *ctx, decl z3.FuncDecl) {
+	axiomatizeStringMap(c, decl, strings.ToUpper)
+}
+
+// declareLower declares strings.lower, the lowercasing companion of
+// strings.upper.
+func declareLower(c *ctx) z3.FuncDecl {
+	return c.def.FuncDecl("strings.lower", []z3.Sort{c.s.strSort}, c.s.strSort)
+}
+
+func axiomatizeLower(c *ctx, decl z3.FuncDecl) {
+	axiomatizeStringMap(c, decl, strings.ToLower)
+}
+
+// declareHasPrefix declares strings.hasPrefix as an uninterpreted
+// relation over the solver's string sort; like Go's strings.HasPrefix,
+// the string comes first and the prefix second.
+func declareHasPrefix(c *ctx) z3.FuncDecl {
+	return c.def.FuncDecl("strings.hasPrefix", []z3.Sort{c.s.strSort, c.s.strSort}, c.def.BoolSort())
+}
+
+func axiomatizeHasPrefix(c *ctx, decl z3.FuncDecl) {
+	axiomatizeStringRelation(c, decl, strings.HasPrefix)
+}
+
+// declareHasSuffix declares strings.hasSuffix, mirroring
+// strings.HasSuffix's argument order.
+func declareHasSuffix(c *ctx) z3.FuncDecl {
+	return c.def.FuncDecl("strings.hasSuffix", []z3.Sort{c.s.strSort, c.s.strSort}, c.def.BoolSort())
+}
+
+func axiomatizeHasSuffix(c *ctx, decl z3.FuncDecl) {
+	axiomatizeStringRelation(c, decl, strings.HasSuffix)
+}
+
+// declareLength declares len over the solver's string sort, producing
+// an integer that can participate in arithmetic and comparisons.
+func declareLength(c *ctx) z3.FuncDecl {
+	return c.def.FuncDecl("len", []z3.Sort{c.s.strSort}, c.def.IntSort())
+}
+
+// axiomatizeLength pins len down to the byte length of every interned
+// string, matching Go's len. Applied to a symbolic string, len stays an
+// unconstrained integer.
+func axiomatizeLength(c *ctx, decl z3.FuncDecl) {
+	for _, str := range c.s.internedStrings() {
+		length := c.def.FromInt(int64(len(str)), c.def.IntSort()).(z3.Int)
+		c.solver.Assert(decl.Apply(c.s.interned[str]).(z3.Int).Eq(length))
+	}
+}
+
+// axiomatizeStringRelation asserts that decl agrees with the Go string
+// relation fn on every pair of interned strings.
+func axiomatizeStringRelation(c *ctx, decl z3.FuncDecl, fn func(s, arg string) bool) {
+	for _, a := range c.s.internedStrings() {
+		for _, b := range c.s.internedStrings() {
+			eq := decl.Apply(c.s.interned[a], c.s.interned[b]).(z3.Bool).Eq(c.def.FromBool(fn(a, b)))
+			c.solver.Assert(eq)
+		}
+	}
+}
+
+// axiomatizeStringMap asserts that decl agrees with the Go string
+// function fn on every interned string. The binding has no string
+// theory to express per-character transformations, so the function is
+// only pinned down over the interned universe; applying fn may intern
+// its image, so the universe is iterated until it stops growing.
+func axiomatizeStringMap(c *ctx, decl z3.FuncDecl, fn func(string) string) {
+	done := make(map[string]bool)
+	for {
+		strs := c.s.internedStrings()
+		if len(done) == len(strs) {
+			return
+		}
+		for _, str := range strs {
+			if done[str] {
+				continue
+			}
+			done[str] = true
+			image := c.s.intern(fn(str)).(z3.Uninterpreted)
+			c.solver.Assert(decl.Apply(c.s.interned[str]).(z3.Uninterpreted).Eq(image))
+		}
+	}
+}
@@ -0,0 +1,808 @@
+/*
+Copyright 2023 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package partial implements a partial predicate solver. Given a
+// predicate over role and user attributes and a resolver supplying the
+// attributes that are known, it enumerates the values of a single
+// remaining identifier that satisfy the predicate.
+package partial
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aclements/go-z3/z3"
+	"github.com/gravitational/trace"
+)
+
+// Resolver supplies concrete values for the identifiers a predicate
+// references. Dotted selectors such as user.traits are looked up under
+// their full path. A resolver may return a scalar (string, bool or
+// integer), a []string candidate set constraining the identifier to one
+// of its members, or a map with string or integer keys for identifiers
+// that are indexed. Returning false leaves the identifier symbolic.
+type Resolver func(name string) (interface{}, bool)
+
+// Solver lowers predicate expressions into z3 terms and enumerates the
+// values of a queried identifier that satisfy them. A Solver owns a
+// single z3 context; a mutex serializes solves over it, so a Solver is
+// safe to share between goroutines.
+//
+// The z3 binding in use has no native string theory, so the solver
+// models predicate strings as distinct constants of an uninterpreted
+// sort: every string literal and resolver-provided string is interned
+// once per Solver, and solutions of string kind are returned as the
+// interned constants, which StringValue maps back to Go strings.
+type Solver struct {
+	// mu guards the z3 context and solver along with the interning
+	// tables and solve results below.
+	mu     sync.Mutex
+	def    *z3.Context
+	solver *z3.Solver
+
+	// strSort is the uninterpreted sort standing in for strings.
+	strSort z3.Sort
+	// interned maps Go strings to their interned constants and
+	// internedNames maps the printed form of interned constants back
+	// to the Go string; z3 values themselves are not comparable.
+	interned      map[string]z3.Value
+	internedNames map[string]string
+
+	// lastSymbolic records the identifiers of the most recent solve
+	// that the resolver could not provide values for.
+	lastSymbolic []string
+}
+
+// NewSolver returns a Solver backed by a fresh z3 context.
+func NewSolver() *Solver {
+	def := z3.NewContext(z3.NewContextConfig())
+	return &Solver{
+		def:           def,
+		solver:        z3.NewSolver(def),
+		strSort:       def.UninterpretedSort("String"),
+		interned:      make(map[string]z3.Value),
+		internedNames: make(map[string]string),
+	}
+}
+
+// PartialSolveForAll enumerates the values of the identifier querying
+// that satisfy the given predicate. Identifiers known to the resolver
+// are lowered to their concrete values and all others are left
+// symbolic. The to kind selects the sort solved for, where
+// z3.KindUninterpreted selects the solver's string sort. maxResults
+// bounds the enumeration, with 0 meaning unlimited; the returned bool
+// reports whether enumeration stopped at the cap rather than running
+// out of solutions. Enumeration is aborted through a z3 interrupt once
+// timeout elapses. On timeout, no solutions are returned; use
+// PartialSolveForAllBestEffort to keep the solutions found so far
+// instead.
+func (s *Solver) PartialSolveForAll(predicate string, resolver Resolver, querying string, to z3.Kind, maxResults int, timeout time.Duration) ([]z3.Value, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.partialSolveForAllImpl(predicate, resolver, querying, to, maxResults, timeout, false)
+}
+
+// PartialSolveForAllBestEffort behaves like PartialSolveForAll except
+// that, when the timeout interrupts enumeration, the solutions
+// collected before the interrupt are returned with the truncation bool
+// set instead of being discarded.
+func (s *Solver) PartialSolveForAllBestEffort(predicate string, resolver Resolver, querying string, to z3.Kind, maxResults int, timeout time.Duration) ([]z3.Value, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.partialSolveForAllImpl(predicate, resolver, querying, to, maxResults, timeout, true)
+}
+
+// PartialSolveAny returns one value of the identifier querying that
+// satisfies the predicate, if any, without enumerating further
+// solutions. It shares PartialSolveForAll's lowering and interrupt
+// based timeout and is the cheaper choice when only satisfiability and
+// a single witness are needed.
+func (s *Solver) PartialSolveAny(predicate string, resolver Resolver, querying string, to z3.Kind, timeout time.Duration) (z3.Value, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, q, err := s.lower(predicate, resolver, querying, to)
+	if err != nil {
+		return nil, false, trace.Wrap(err)
+	}
+
+	timer := time.AfterFunc(timeout, s.def.Interrupt)
+	defer timer.Stop()
+
+	sat, err := s.solver.Check()
+	if err != nil {
+		return nil, false, trace.Wrap(err)
+	}
+	if !sat {
+		return nil, false, nil
+	}
+	val, _, _ := c.solution(s.solver.Model(), q)
+	return val, true, nil
+}
+
+// lower parses the predicate, lowers it over a fresh pass context and
+// asserts the resulting constraints on the solver, returning the pass
+// and the value solved for.
+func (s *Solver) lower(predicate string, resolver Resolver, querying string, to z3.Kind) (*ctx, z3.Value, error) {
+	node, err := parser.ParseExpr(predicate)
+	if err != nil {
+		return nil, nil, trace.BadParameter("failed to parse predicate: %v", err)
+	}
+	querySort, err := s.sortFor(to)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+
+	c := &ctx{
+		def:      s.def,
+		solver:   s.solver,
+		s:        s,
+		resolver: resolver,
+		consts:   make(map[string]z3.Value),
+		symbolic: make(map[string]struct{}),
+		funcs:    make(map[string]z3.FuncDecl),
+	}
+	q, err := c.resolve(querying, &querySort)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	if q.Sort().Kind() != querySort.Kind() {
+		return nil, nil, trace.BadParameter("resolver binds %q to a %v, cannot solve for a %v", querying, q.Sort(), querySort)
+	}
+
+	cond, err := c.lowerExpr(node, nil)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	pred, ok := cond.(z3.Bool)
+	if !ok {
+		return nil, nil, trace.BadParameter("predicate must lower to a boolean, got %v", cond.Sort())
+	}
+
+	s.solver.Reset()
+	s.solver.Assert(pred)
+	c.finalize()
+
+	s.lastSymbolic = s.lastSymbolic[:0]
+	for name := range c.symbolic {
+		if name != querying {
+			s.lastSymbolic = append(s.lastSymbolic, name)
+		}
+	}
+	sort.Strings(s.lastSymbolic)
+	return c, q, nil
+}
+
+func (s *Solver) partialSolveForAllImpl(predicate string, resolver Resolver, querying string, to z3.Kind, maxResults int, timeout time.Duration, keepPartial bool) ([]z3.Value, bool, error) {
+	c, q, err := s.lower(predicate, resolver, querying, to)
+	if err != nil {
+		return nil, false, trace.Wrap(err)
+	}
+
+	timer := time.AfterFunc(timeout, s.def.Interrupt)
+	defer timer.Stop()
+
+	out, truncated, err := c.enumerate(q, maxResults)
+	if err != nil {
+		var unknown *z3.ErrSatUnknown
+		if keepPartial && (errors.As(err, &unknown) || errors.As(err, new(*errInterrupted))) {
+			return out, true, nil
+		}
+		return nil, false, trace.Wrap(err)
+	}
+	return out, truncated, nil
+}
+
+// errInterrupted reports a z3 interrupt that landed outside of Check,
+// recovered from the panic the binding raises for it.
+type errInterrupted struct {
+	reason interface{}
+}
+
+func (e *errInterrupted) Error() string {
+	return fmt.Sprintf("solve interrupted: %v", e.reason)
+}
+
+// enumerate walks the models of the asserted predicate, excluding every
+// extracted value in turn. out is also populated on error so that
+// best-effort callers keep the solutions collected before an interrupt;
+// interrupts landing in model extraction rather than Check unwind as
+// panics from the z3 binding and are converted to errInterrupted here.
+func (c *ctx) enumerate(q z3.Value, maxResults int) (out []z3.Value, truncated bool, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		// The binding panics with the z3 error message; anything other
+		// than a cancellation is a genuine programming error.
+		if msg, ok := r.(string); ok && strings.Contains(msg, "canceled") {
+			err = &errInterrupted{reason: r}
+			return
+		}
+		panic(r)
+	}()
+	for {
+		if maxResults > 0 && len(out) == maxResults {
+			return out, true, nil
+		}
+		sat, err := c.solver.Check()
+		if err != nil {
+			return out, false, trace.Wrap(err)
+		}
+		if !sat {
+			break
+		}
+		val, exclusion, more := c.solution(c.solver.Model(), q)
+		out = append(out, val)
+		if !more {
+			break
+		}
+		c.solver.Assert(exclusion)
+	}
+	return out, false, nil
+}
+
+// SymbolicIdentifiers returns the identifiers referenced by the most
+// recently solved predicate that the resolver could not provide values
+// for, excluding the queried identifier itself. Such identifiers are
+// left unconstrained, which is useful for explaining why a solve
+// returned broad results.
+func (s *Solver) SymbolicIdentifiers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSymbolic
+}
+
+// StringValue maps a string-sorted solution value back to the Go string
+// it stands for. It returns false for values outside the solver's
+// interned universe, such as symbolic strings invented by a model.
+func (s *Solver) StringValue(v z3.Value) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	str, ok := s.internedNames[v.String()]
+	return str, ok
+}
+
+// sortFor maps a solve kind to the corresponding sort.
+func (s *Solver) sortFor(kind z3.Kind) (z3.Sort, error) {
+	switch kind {
+	case z3.KindBool:
+		return s.def.BoolSort(), nil
+	case z3.KindInt:
+		return s.def.IntSort(), nil
+	case z3.KindReal:
+		return s.def.RealSort(), nil
+	case z3.KindUninterpreted:
+		return s.strSort, nil
+	}
+	return z3.Sort{}, trace.BadParameter("cannot solve for values of kind %v", kind)
+}
+
+// intern returns the distinct constant standing for the given string,
+// creating it on first use.
+func (s *Solver) intern(val string) z3.Value {
+	if v, ok := s.interned[val]; ok {
+		return v
+	}
+	v := s.def.Const(fmt.Sprintf("str!%q", val), s.strSort)
+	s.interned[val] = v
+	s.internedNames[v.String()] = val
+	return v
+}
+
+// internedStrings returns the interned strings in a stable order.
+func (s *Solver) internedStrings() []string {
+	out := make([]string, 0, len(s.interned))
+	for str := range s.interned {
+		out = append(out, str)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ctx carries the state of a single lowering pass.
+type ctx struct {
+	def      *z3.Context
+	solver   *z3.Solver
+	s        *Solver
+	resolver Resolver
+
+	// consts caches the z3 value of every identifier resolved so far.
+	consts map[string]z3.Value
+	// symbolic records the identifiers the resolver did not know, for
+	// which fresh symbolic constants were created.
+	symbolic map[string]struct{}
+	// domains holds candidate set constraints accumulated while
+	// resolving identifiers, asserted by finalize.
+	domains []z3.Bool
+	// funcs caches builtin declarations created during this pass and
+	// usedFuncs records which of them finalize must axiomatize.
+	funcs     map[string]z3.FuncDecl
+	usedFuncs []string
+}
+
+// errUntypedIdent reports an identifier that neither the resolver nor
+// the surrounding expression could assign a sort to.
+type errUntypedIdent struct {
+	name string
+}
+
+func (e *errUntypedIdent) Error() string {
+	return fmt.Sprintf("cannot determine the type of identifier %q", e.name)
+}
+
+// lowerExpr lowers a parsed predicate node into a z3 term. hint, when
+// set, is the sort given to identifiers the resolver does not know;
+// without it such identifiers surface errUntypedIdent so the caller can
+// retry once the sort of the opposite operand is known.
+func (c *ctx) lowerExpr(node ast.Expr, hint *z3.Sort) (z3.Value, error) {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return c.lowerExpr(n.X, hint)
+	case *ast.Ident:
+		return c.lowerIdent(n, hint)
+	case *ast.SelectorExpr:
+		name, err := evaluateSelector(n)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		return c.resolve(name, hint)
+	case *ast.BasicLit:
+		return c.lowerBasicLit(n)
+	case *ast.BinaryExpr:
+		return c.lowerBinary(n)
+	case *ast.UnaryExpr:
+		return c.lowerUnary(n)
+	case *ast.IndexExpr:
+		return c.lowerIndexExpr(n)
+	case *ast.CallExpr:
+		return c.lowerCallExpr(n)
+	}
+	return nil, trace.BadParameter("predicate nodes of type %T are not supported", node)
+}
+
+func (c *ctx) lowerIdent(node *ast.Ident, hint *z3.Sort) (z3.Value, error) {
+	switch node.Name {
+	case "true":
+		return c.def.FromBool(true), nil
+	case "false":
+		return c.def.FromBool(false), nil
+	}
+	return c.resolve(node.Name, hint)
+}
+
+func (c *ctx) lowerBasicLit(node *ast.BasicLit) (z3.Value, error) {
+	switch node.Kind {
+	case token.INT:
+		i, err := strconv.ParseInt(node.Value, 0, 64)
+		if err != nil {
+			return nil, trace.BadParameter("failed to parse integer literal %q: %v", node.Value, err)
+		}
+		return c.def.FromInt(i, c.def.IntSort()), nil
+	case token.FLOAT:
+		rat, ok := new(big.Rat).SetString(node.Value)
+		if !ok {
+			return nil, trace.BadParameter("failed to parse float literal %q", node.Value)
+		}
+		return c.def.FromBigRat(rat), nil
+	case token.STRING:
+		str, err := strconv.Unquote(node.Value)
+		if err != nil {
+			return nil, trace.BadParameter("failed to parse string literal %s: %v", node.Value, err)
+		}
+		return c.s.intern(str), nil
+	}
+	return nil, trace.BadParameter("literals of kind %v are not supported", node.Kind)
+}
+
+func (c *ctx) lowerBinary(node *ast.BinaryExpr) (z3.Value, error) {
+	if node.Op == token.LAND || node.Op == token.LOR {
+		hint := c.def.BoolSort()
+		x, err := c.lowerExpr(node.X, &hint)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		y, err := c.lowerExpr(node.Y, &hint)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		xb, xok := x.(z3.Bool)
+		yb, yok := y.(z3.Bool)
+		if !xok || !yok {
+			return nil, trace.BadParameter("operands of %v must be booleans", node.Op)
+		}
+		if node.Op == token.LAND {
+			return xb.And(yb), nil
+		}
+		return xb.Or(yb), nil
+	}
+
+	x, y, err := c.lowerOperands(node)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	kind, err := pickType(node.Op, x, y)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	switch node.Op {
+	case token.EQL:
+		switch kind {
+		case z3.KindInt:
+			return x.(z3.Int).Eq(y.(z3.Int)), nil
+		case z3.KindReal:
+			return x.(z3.Real).Eq(y.(z3.Real)), nil
+		case z3.KindBool:
+			return x.(z3.Bool).Eq(y.(z3.Bool)), nil
+		case z3.KindUninterpreted:
+			return x.(z3.Uninterpreted).Eq(y.(z3.Uninterpreted)), nil
+		}
+		return nil, trace.BadParameter("cannot compare values of type %v", x.Sort())
+	case token.NEQ:
+		switch kind {
+		case z3.KindInt:
+			return x.(z3.Int).Eq(y.(z3.Int)).Not(), nil
+		case z3.KindReal:
+			return x.(z3.Real).Eq(y.(z3.Real)).Not(), nil
+		case z3.KindBool:
+			return x.(z3.Bool).Eq(y.(z3.Bool)).Not(), nil
+		case z3.KindUninterpreted:
+			return x.(z3.Uninterpreted).Eq(y.(z3.Uninterpreted)).Not(), nil
+		}
+		return nil, trace.BadParameter("cannot compare values of type %v", x.Sort())
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		switch kind {
+		case z3.KindInt:
+			xi, yi := x.(z3.Int), y.(z3.Int)
+			switch node.Op {
+			case token.LSS:
+				return xi.LT(yi), nil
+			case token.LEQ:
+				return xi.LE(yi), nil
+			case token.GTR:
+				return xi.GT(yi), nil
+			}
+			return xi.GE(yi), nil
+		case z3.KindReal:
+			xr, yr := x.(z3.Real), y.(z3.Real)
+			switch node.Op {
+			case token.LSS:
+				return xr.LT(yr), nil
+			case token.LEQ:
+				return xr.LE(yr), nil
+			case token.GTR:
+				return xr.GT(yr), nil
+			}
+			return xr.GE(yr), nil
+		}
+		return nil, trace.BadParameter("ordering op %v requires numeric operands, got %v", node.Op, x.Sort())
+	case token.ADD, token.SUB, token.MUL, token.QUO:
+		if kind != z3.KindInt {
+			return nil, trace.BadParameter("arithmetic op %v requires integer operands, got %v", node.Op, x.Sort())
+		}
+		xi, yi := x.(z3.Int), y.(z3.Int)
+		switch node.Op {
+		case token.ADD:
+			return xi.Add(yi), nil
+		case token.SUB:
+			return xi.Sub(yi), nil
+		case token.MUL:
+			return xi.Mul(yi), nil
+		}
+		return xi.Div(yi), nil
+	}
+	return nil, trace.BadParameter("binary op %v is not supported", node.Op)
+}
+
+// lowerOperands lowers both operands of a comparison, using the sort of
+// whichever side lowers first to type a symbolic opposite side.
+func (c *ctx) lowerOperands(node *ast.BinaryExpr) (z3.Value, z3.Value, error) {
+	x, xerr := c.lowerExpr(node.X, nil)
+	if xerr == nil {
+		xsort := x.Sort()
+		y, err := c.lowerExpr(node.Y, &xsort)
+		if err != nil {
+			return nil, nil, trace.Wrap(err)
+		}
+		return x, y, nil
+	}
+	var untyped *errUntypedIdent
+	if !errors.As(xerr, &untyped) {
+		return nil, nil, trace.Wrap(xerr)
+	}
+	y, err := c.lowerExpr(node.Y, nil)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	ysort := y.Sort()
+	x, err = c.lowerExpr(node.X, &ysort)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+	return x, y, nil
+}
+
+func (c *ctx) lowerUnary(node *ast.UnaryExpr) (z3.Value, error) {
+	if node.Op == token.NOT {
+		hint := c.def.BoolSort()
+		x, err := c.lowerExpr(node.X, &hint)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		b, ok := x.(z3.Bool)
+		if !ok {
+			return nil, trace.BadParameter("operand of %v must be a boolean, got %v", node.Op, x.Sort())
+		}
+		return b.Not(), nil
+	}
+	return nil, trace.BadParameter("unary op %v is not supported", node.Op)
+}
+
+// lowerIndexExpr lowers an index expression such as user.traits["team"]
+// by resolving its base to a resolver-provided map and selecting the
+// lowered key from the resulting array.
+func (c *ctx) lowerIndexExpr(node *ast.IndexExpr) (z3.Value, error) {
+	name, err := evaluateSelector(node.X)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	base, err := c.resolve(name, nil)
+	if err != nil {
+		var untyped *errUntypedIdent
+		if errors.As(err, &untyped) {
+			return nil, trace.BadParameter("cannot index identifier %q not known to the resolver", name)
+		}
+		return nil, trace.Wrap(err)
+	}
+	arr, ok := base.(z3.Array)
+	if !ok {
+		return nil, trace.BadParameter("identifier %q is not a map", name)
+	}
+	domain, _ := arr.Sort().DomainAndRange()
+	key, err := c.lowerExpr(node.Index, &domain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if key.Sort().Kind() != domain.Kind() {
+		return nil, trace.BadParameter("map %q cannot be indexed with a %v key", name, key.Sort())
+	}
+	return arr.Select(key), nil
+}
+
+// lowerCallExpr lowers a call to a registered builtin by applying its
+// declaration to the lowered arguments.
+func (c *ctx) lowerCallExpr(node *ast.CallExpr) (z3.Value, error) {
+	name, err := evaluateSelector(node.Fun)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	spec, ok := builtins[name]
+	if !ok {
+		return nil, trace.BadParameter("fn %q is not supported", name)
+	}
+	if len(node.Args) != spec.arity {
+		return nil, trace.BadParameter("fn %q takes %d arguments, got %d", name, spec.arity, len(node.Args))
+	}
+	if spec.lower != nil {
+		return spec.lower(c, node)
+	}
+	decl := c.builtinDecl(name, spec)
+	args := make([]z3.Value, 0, len(node.Args))
+	for _, arg := range node.Args {
+		hint := c.s.strSort
+		val, err := c.lowerExpr(arg, &hint)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if val.Sort().Kind() != z3.KindUninterpreted {
+			return nil, trace.BadParameter("fn %q requires string arguments, got %v", name, val.Sort())
+		}
+		args = append(args, val)
+	}
+	return decl.Apply(args...), nil
+}
+
+// builtinDecl returns the declaration of the named builtin, creating it
+// on first use and recording it for axiomatization in finalize.
+func (c *ctx) builtinDecl(name string, spec builtin) z3.FuncDecl {
+	if decl, ok := c.funcs[name]; ok {
+		return decl
+	}
+	decl := spec.declare(c)
+	c.funcs[name] = decl
+	c.usedFuncs = append(c.usedFuncs, name)
+	return decl
+}
+
+// resolve returns the z3 value standing for the named identifier. Names
+// known to the resolver are lowered from their concrete value; unknown
+// names become fresh symbolic constants of the hinted sort.
+func (c *ctx) resolve(name string, hint *z3.Sort) (z3.Value, error) {
+	if v, ok := c.consts[name]; ok {
+		return v, nil
+	}
+	if val, ok := c.resolver(name); ok {
+		v, err := c.lowerValue(name, val)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		c.consts[name] = v
+		return v, nil
+	}
+	if hint == nil {
+		return nil, &errUntypedIdent{name: name}
+	}
+	c.symbolic[name] = struct{}{}
+	v := c.def.Const(name, *hint)
+	c.consts[name] = v
+	return v, nil
+}
+
+// lowerValue lowers a concrete resolver-provided value.
+func (c *ctx) lowerValue(name string, val interface{}) (z3.Value, error) {
+	if v, err := c.lowerScalar(val); err == nil {
+		return v, nil
+	}
+	switch val := val.(type) {
+	case []string:
+		if len(val) == 0 {
+			return nil, trace.BadParameter("empty candidate set for %q", name)
+		}
+		v := c.def.Const(name, c.s.strSort).(z3.Uninterpreted)
+		members := make([]z3.Bool, 0, len(val))
+		for _, member := range val {
+			members = append(members, v.Eq(c.s.intern(member).(z3.Uninterpreted)))
+		}
+		c.domains = append(c.domains, members[0].Or(members[1:]...))
+		return v, nil
+	}
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Map {
+		return c.lowerMapValue(name, rv)
+	}
+	return nil, trace.BadParameter("resolver values of type %T for %q are not supported", val, name)
+}
+
+// lowerMapValue lowers a resolver-provided Go map into a z3 array so
+// that index expressions can select from it. String and integer keys
+// are supported; keys absent from the map select a fresh symbolic
+// default.
+func (c *ctx) lowerMapValue(name string, rv reflect.Value) (z3.Value, error) {
+	keys := rv.MapKeys()
+	if len(keys) == 0 {
+		return nil, trace.BadParameter("empty map for %q", name)
+	}
+	var domain z3.Sort
+	switch keys[0].Kind() {
+	case reflect.String:
+		domain = c.s.strSort
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		domain = c.def.IntSort()
+	default:
+		return nil, trace.BadParameter("map keys of type %v for %q are not supported", rv.Type().Key(), name)
+	}
+
+	var arr z3.Array
+	for i, key := range keys {
+		kv, err := c.lowerScalar(key.Interface())
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		ev, err := c.lowerScalar(rv.MapIndex(key).Interface())
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if i == 0 {
+			arr = c.def.ConstArray(domain, c.def.FreshConst(name+"!default", ev.Sort()))
+		}
+		arr = arr.Store(kv, ev)
+	}
+	return arr, nil
+}
+
+// lowerScalar lowers a concrete Go scalar into a z3 value.
+func (c *ctx) lowerScalar(val interface{}) (z3.Value, error) {
+	switch val := val.(type) {
+	case bool:
+		return c.def.FromBool(val), nil
+	case int:
+		return c.def.FromInt(int64(val), c.def.IntSort()), nil
+	case int64:
+		return c.def.FromInt(val, c.def.IntSort()), nil
+	case float64:
+		return c.def.FromBigRat(new(big.Rat).SetFloat64(val)), nil
+	case string:
+		return c.s.intern(val), nil
+	}
+	return nil, trace.BadParameter("values of type %T are not supported", val)
+}
+
+// finalize asserts the constraints accumulated during lowering: the
+// axioms of every builtin applied, the candidate domains of
+// resolver-provided values, and the distinctness of the interned string
+// universe.
+func (c *ctx) finalize() {
+	for _, name := range c.usedFuncs {
+		builtins[name].axiomatize(c, c.funcs[name])
+	}
+	for _, domain := range c.domains {
+		c.solver.Assert(domain)
+	}
+	if len(c.s.interned) > 1 {
+		vals := make([]z3.Value, 0, len(c.s.interned))
+		for _, str := range c.s.internedStrings() {
+			vals = append(vals, c.s.interned[str])
+		}
+		c.solver.Assert(c.def.Distinct(vals...))
+	}
+}
+
+// solution extracts the value of q from model, preferring an interned
+// constant when q ranges over the string sort so that callers can map
+// it back through StringValue. The returned exclusion clause rules the
+// value out of subsequent models; more is false when no such clause can
+// be built, in which case enumeration stops.
+func (c *ctx) solution(model *z3.Model, q z3.Value) (val z3.Value, exclusion z3.Bool, more bool) {
+	if q.Sort().Kind() == z3.KindUninterpreted {
+		uq := q.(z3.Uninterpreted)
+		for _, str := range c.s.internedStrings() {
+			cand := c.s.interned[str].(z3.Uninterpreted)
+			if isTrue, _ := model.Eval(uq.Eq(cand), true).(z3.Bool).AsBool(); isTrue {
+				return cand, uq.Eq(cand).Not(), true
+			}
+		}
+		// The model invented a string outside the interned universe;
+		// report it as is, there is nothing left to enumerate.
+		return model.Eval(q, true), exclusion, false
+	}
+	val = model.Eval(q, true)
+	return val, c.def.Distinct(q, val), true
+}
+
+// pickType checks that the operands of op share a kind the solver can
+// operate on and returns it.
+func pickType(op token.Token, x, y z3.Value) (z3.Kind, error) {
+	xk, yk := x.Sort().Kind(), y.Sort().Kind()
+	if xk != yk {
+		return 0, trace.BadParameter("mismatched operand types %v and %v for %v", x.Sort(), y.Sort(), op)
+	}
+	return xk, nil
+}
+
+// evaluateSelector flattens an identifier or a dotted selector chain
+// such as user.traits into its full name.
+func evaluateSelector(node ast.Expr) (string, error) {
+	switch n := node.(type) {
+	case *ast.Ident:
+		return n.Name, nil
+	case *ast.SelectorExpr:
+		prefix, err := evaluateSelector(n.X)
+		if err != nil {
+			return "", trace.Wrap(err)
+		}
+		return prefix + "." + n.Sel.Name, nil
+	}
+	return "", trace.BadParameter("selectors of type %T are not supported", node)
+}
@@ -0,0 +1,371 @@
+/*
+Copyright 2023 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package partial
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aclements/go-z3/z3"
+	"github.com/stretchr/testify/require"
+)
+
+// stringSolutions decodes string-sorted solutions back to Go strings.
+func stringSolutions(t *testing.T, s *Solver, vals []z3.Value) []string {
+	t.Helper()
+	out := make([]string, 0, len(vals))
+	for _, val := range vals {
+		str, ok := s.StringValue(val)
+		require.True(t, ok, "solution %v is not an interned string", val)
+		out = append(out, str)
+	}
+	return out
+}
+
+// intSolutions decodes integer-sorted solutions back to Go integers.
+func intSolutions(t *testing.T, vals []z3.Value) []int64 {
+	t.Helper()
+	out := make([]int64, 0, len(vals))
+	for _, val := range vals {
+		i, isLiteral, ok := val.(z3.Int).AsInt64()
+		require.True(t, isLiteral && ok, "solution %v is not an integer literal", val)
+		out = append(out, i)
+	}
+	return out
+}
+
+// emptyResolver leaves every identifier symbolic.
+func emptyResolver(name string) (interface{}, bool) {
+	return nil, false
+}
+
+func TestSolveBoolLiterals(t *testing.T) {
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`x == false`, emptyResolver, "x", z3.KindBool, 0, time.Second)
+	require.NoError(t, err)
+	require.Len(t, solutions, 1)
+	val, isLiteral := solutions[0].(z3.Bool).AsBool()
+	require.True(t, isLiteral)
+	require.False(t, val)
+
+	// A contradiction must not yield any solutions.
+	solutions, _, err = s.PartialSolveForAll(`false && x`, emptyResolver, "x", z3.KindBool, 0, time.Second)
+	require.NoError(t, err)
+	require.Empty(t, solutions)
+}
+
+func TestSolveTraitMapIndex(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		switch name {
+		case "user.traits":
+			return map[string]string{"team": "dev", "env": "staging"}, true
+		case "x":
+			return []string{"dev", "ops", "staging"}, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`x == user.traits["team"]`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dev"}, stringSolutions(t, s, solutions))
+}
+
+func TestSolveIntKeyMapIndex(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "levels" {
+			return map[int]int64{1: 1, 2: 5}, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`levels[2] > x && x > 0`, resolver, "x", z3.KindInt, 0, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int64{1, 2, 3, 4}, intSolutions(t, solutions))
+}
+
+func TestSolveArithmetic(t *testing.T) {
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`level + 1 > 3 && level < 6`, emptyResolver, "level", z3.KindInt, 0, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int64{3, 4, 5}, intSolutions(t, solutions))
+
+	solutions, _, err = s.PartialSolveForAll(`x * 2 - 1 == 5`, emptyResolver, "x", z3.KindInt, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []int64{3}, intSolutions(t, solutions))
+
+	solutions, _, err = s.PartialSolveForAll(`x / 2 == 2 && x > 3 && x < 6`, emptyResolver, "x", z3.KindInt, 0, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int64{4, 5}, intSolutions(t, solutions))
+
+	_, _, err = s.PartialSolveForAll(`x + "admin" == "admin"`, emptyResolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.ErrorContains(t, err, "arithmetic op + requires integer operands")
+}
+
+func TestSolveNotEqual(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "x" {
+			return []string{"admin", "dev", "ops"}, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`x != "admin"`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"dev", "ops"}, stringSolutions(t, s, solutions))
+
+	// Operands of mismatched types must still be rejected.
+	_, _, err = s.PartialSolveForAll(`x != 1`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.ErrorContains(t, err, "mismatched operand types")
+}
+
+func TestPartialSolveAny(t *testing.T) {
+	s := NewSolver()
+	all, _, err := s.PartialSolveForAll(`x * 2 == 6`, emptyResolver, "x", z3.KindInt, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []int64{3}, intSolutions(t, all))
+
+	val, found, err := s.PartialSolveAny(`x * 2 == 6`, emptyResolver, "x", z3.KindInt, time.Second)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, intSolutions(t, all), intSolutions(t, []z3.Value{val}))
+
+	_, found, err = s.PartialSolveAny(`x > 1 && x < 1`, emptyResolver, "x", z3.KindInt, time.Second)
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestSolveResultCap(t *testing.T) {
+	s := NewSolver()
+	solutions, truncated, err := s.PartialSolveForAll(`x > 0 && x < 100`, emptyResolver, "x", z3.KindInt, 5, time.Second)
+	require.NoError(t, err)
+	require.Len(t, solutions, 5)
+	require.True(t, truncated)
+
+	solutions, truncated, err = s.PartialSolveForAll(`x > 0 && x < 4`, emptyResolver, "x", z3.KindInt, 5, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int64{1, 2, 3}, intSolutions(t, solutions))
+	require.False(t, truncated)
+
+	solutions, truncated, err = s.PartialSolveForAll(`x > 0 && x < 4`, emptyResolver, "x", z3.KindInt, 0, time.Second)
+	require.NoError(t, err)
+	require.Len(t, solutions, 3)
+	require.False(t, truncated)
+}
+
+func TestSolveStringsUpper(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "role" {
+			return []string{"admin", "Admin", "root"}, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`strings.upper(role) == "ADMIN"`, resolver, "role", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"admin", "Admin"}, stringSolutions(t, s, solutions))
+
+	_, _, err = s.PartialSolveForAll(`strings.reverse(role) == "nimda"`, resolver, "role", z3.KindUninterpreted, 0, time.Second)
+	require.ErrorContains(t, err, `fn "strings.reverse" is not supported`)
+
+	_, _, err = s.PartialSolveForAll(`strings.upper(role, role) == "ADMIN"`, resolver, "role", z3.KindUninterpreted, 0, time.Second)
+	require.ErrorContains(t, err, `fn "strings.upper" takes 1 arguments, got 2`)
+}
+
+func TestSolveStringsLower(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "role" {
+			return []string{"ADMIN", "Admin", "admin", "dev"}, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`strings.lower(role) == "admin"`, resolver, "role", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"ADMIN", "Admin", "admin"}, stringSolutions(t, s, solutions))
+}
+
+func TestSolveLength(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "x" {
+			return []string{"dev", "ops", "admin", "root"}, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`len(x) == 4`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []string{"root"}, stringSolutions(t, s, solutions))
+
+	// The length of a symbolic string is unconstrained, so requiring
+	// one does not make the predicate unsatisfiable.
+	solutions, _, err = s.PartialSolveForAll(`x == "dev" && len(unknown) == 3`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dev"}, stringSolutions(t, s, solutions))
+}
+
+func TestSolvePrefixSuffix(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "email" {
+			return []string{"team-dev", "team-ops", "admin"}, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`strings.hasPrefix(email, "team-")`, resolver, "email", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"team-dev", "team-ops"}, stringSolutions(t, s, solutions))
+
+	solutions, _, err = s.PartialSolveForAll(`strings.hasSuffix(email, "-ops")`, resolver, "email", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []string{"team-ops"}, stringSolutions(t, s, solutions))
+}
+
+func TestSolveBestEffortTimeout(t *testing.T) {
+	// Enumerating x > 0 never completes, so the timeout always fires
+	// mid-loop.
+	s := NewSolver()
+	solutions, truncated, err := s.PartialSolveForAllBestEffort(`x > 0`, emptyResolver, "x", z3.KindInt, 0, 200*time.Millisecond)
+	require.NoError(t, err)
+	require.NotEmpty(t, solutions)
+	require.True(t, truncated)
+
+	// The strict variant keeps discarding everything on timeout.
+	_, _, err = s.PartialSolveForAll(`x > 0`, emptyResolver, "x", z3.KindInt, 0, 200*time.Millisecond)
+	require.Error(t, err)
+}
+
+func TestSolveReals(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "score" {
+			return 0.75, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`x == (score > 0.5)`, resolver, "x", z3.KindBool, 0, time.Second)
+	require.NoError(t, err)
+	require.Len(t, solutions, 1)
+	val, isLiteral := solutions[0].(z3.Bool).AsBool()
+	require.True(t, isLiteral)
+	require.True(t, val)
+
+	witness, found, err := s.PartialSolveAny(`x > 0.5 && x < 0.75`, resolver, "x", z3.KindReal, time.Second)
+	require.NoError(t, err)
+	require.True(t, found)
+	rat, ok := witness.(z3.Real).AsBigRat()
+	require.True(t, ok)
+	require.Equal(t, -1, big.NewRat(1, 2).Cmp(rat))
+	require.Equal(t, 1, big.NewRat(3, 4).Cmp(rat))
+
+	// Mixed int/real comparisons must keep failing loudly.
+	_, _, err = s.PartialSolveForAll(`score > 1`, resolver, "x", z3.KindReal, 0, time.Second)
+	require.ErrorContains(t, err, "mismatched operand types")
+}
+
+func TestSolveConcurrently(t *testing.T) {
+	s := NewSolver()
+	results := make([][]int64, 8)
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			predicate := fmt.Sprintf(`x > %d && x < %d`, i, i+4)
+			solutions, _, err := s.PartialSolveForAll(predicate, emptyResolver, "x", z3.KindInt, 0, 10*time.Second)
+			if err != nil {
+				t.Errorf("solving %q: %v", predicate, err)
+				return
+			}
+			results[i] = intSolutions(t, solutions)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		require.ElementsMatch(t, []int64{int64(i) + 1, int64(i) + 2, int64(i) + 3}, result, "goroutine %d", i)
+	}
+}
+
+func TestSymbolicIdentifiers(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "role" {
+			return "admin", true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	_, _, err := s.PartialSolveForAll(`x == role && y == role && level > 0`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []string{"level", "y"}, s.SymbolicIdentifiers())
+
+	// A fully resolved predicate leaves nothing symbolic.
+	_, _, err = s.PartialSolveForAll(`x == role`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.Empty(t, s.SymbolicIdentifiers())
+}
+
+func TestSolveContains(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "groups" {
+			return []string{"dev", "ops", "admin"}, true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	solutions, _, err := s.PartialSolveForAll(`contains(groups, x)`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"dev", "ops", "admin"}, stringSolutions(t, s, solutions))
+
+	// Membership in a list the resolver does not know stays symbolic,
+	// so a conjunction pinning the element down remains satisfiable.
+	solutions, _, err = s.PartialSolveForAll(`contains(unknown, x) && x == "dev"`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dev"}, stringSolutions(t, s, solutions))
+
+	_, _, err = s.PartialSolveForAll(`contains(groups, 1)`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.ErrorContains(t, err, "contains requires a string element")
+}
+
+func TestSolveIndexErrors(t *testing.T) {
+	resolver := func(name string) (interface{}, bool) {
+		if name == "role" {
+			return "admin", true
+		}
+		return nil, false
+	}
+
+	s := NewSolver()
+	_, _, err := s.PartialSolveForAll(`x == unknown["team"]`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.ErrorContains(t, err, `cannot index identifier "unknown"`)
+
+	_, _, err = s.PartialSolveForAll(`x == role["team"]`, resolver, "x", z3.KindUninterpreted, 0, time.Second)
+	require.ErrorContains(t, err, `identifier "role" is not a map`)
+}
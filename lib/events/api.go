@@ -344,8 +344,16 @@ const (
 
 	// RoleCreatedEvent fires when role is created/updated.
 	RoleCreatedEvent = "role.created"
+	// RoleUpdatedEvent fires when an existing role is updated.
+	RoleUpdatedEvent = "role.updated"
 	// RoleDeletedEvent fires when role is deleted.
 	RoleDeletedEvent = "role.deleted"
+	// RoleDeleteBlockedEvent fires when a role deletion is refused because
+	// the role is still in use.
+	RoleDeleteBlockedEvent = "role.delete.blocked"
+	// RoleUpsertBlockedEvent fires when a role create/update is refused by
+	// the role rules constraint check.
+	RoleUpsertBlockedEvent = "role.upsert.blocked"
 
 	// TrustedClusterCreateEvent is the event for creating a trusted cluster.
 	TrustedClusterCreateEvent = "trusted_cluster.create"
@@ -536,6 +544,13 @@ const (
 	LockCreatedEvent = "lock.created"
 	// LockDeletedEvent fires when a lock is deleted.
 	LockDeletedEvent = "lock.deleted"
+	// LockExpiredEvent fires when a lock expires on its own TTL rather
+	// than being explicitly deleted.
+	LockExpiredEvent = "lock.expired"
+	// LockCreateBlockedEvent fires when a lock create/update fails.
+	LockCreateBlockedEvent = "lock.create.blocked"
+	// LockDeleteBlockedEvent fires when a lock delete fails.
+	LockDeleteBlockedEvent = "lock.delete.blocked"
 
 	// RecoveryCodeGeneratedEvent is an event type for generating a user's recovery tokens.
 	RecoveryCodeGeneratedEvent = "recovery_code.generated"
@@ -357,11 +357,23 @@ const (
 	RoleCreatedCode = "T9000I"
 	// RoleDeletedCode is the role deleted event code.
 	RoleDeletedCode = "T9001I"
+	// RoleUpdatedCode is the role updated event code.
+	RoleUpdatedCode = "T9002I"
+	// RoleDeleteBlockedCode is the blocked role delete event code.
+	RoleDeleteBlockedCode = "T9003W"
+	// RoleUpsertBlockedCode is the blocked role upsert event code.
+	RoleUpsertBlockedCode = "T9004W"
 
 	// LockCreatedCode is the lock created event code.
 	LockCreatedCode = "TLK00I"
 	// LockDeletedCode is the lock deleted event code.
 	LockDeletedCode = "TLK01I"
+	// LockCreateBlockedCode is the blocked lock create event code.
+	LockCreateBlockedCode = "TLK02W"
+	// LockDeleteBlockedCode is the blocked lock delete event code.
+	LockDeleteBlockedCode = "TLK03W"
+	// LockExpiredCode is the lock expired event code.
+	LockExpiredCode = "TLK04I"
 
 	// CertificateCreateCode is the certificate issuance event code.
 	CertificateCreateCode = "TC000I"
@@ -121,8 +121,14 @@ func FromEventFields(fields EventFields) (events.AuditEvent, error) {
 		e = &events.SessionNetwork{}
 	case RoleCreatedEvent:
 		e = &events.RoleCreate{}
+	case RoleUpdatedEvent:
+		e = &events.RoleCreate{}
+	case RoleUpsertBlockedEvent:
+		e = &events.RoleCreate{}
 	case RoleDeletedEvent:
 		e = &events.RoleDelete{}
+	case RoleDeleteBlockedEvent:
+		e = &events.RoleDelete{}
 	case TrustedClusterCreateEvent:
 		e = &events.TrustedClusterCreate{}
 	case TrustedClusterDeleteEvent:
@@ -225,8 +231,14 @@ func FromEventFields(fields EventFields) (events.AuditEvent, error) {
 		e = &events.MFADeviceDelete{}
 	case LockCreatedEvent:
 		e = &events.LockCreate{}
+	case LockCreateBlockedEvent:
+		e = &events.LockCreate{}
 	case LockDeletedEvent:
 		e = &events.LockDelete{}
+	case LockDeleteBlockedEvent:
+		e = &events.LockDelete{}
+	case LockExpiredEvent:
+		e = &events.LockDelete{}
 	case RecoveryCodeGeneratedEvent:
 		e = &events.RecoveryCodeGenerate{}
 	case RecoveryCodeUsedEvent:
@@ -68,11 +68,30 @@ func (u *UsageLogger) reportAuditEvent(ctx context.Context, event apievents.Audi
 			ConnectorType: e.Method,
 		}))
 	case *apievents.SessionStart:
-		// Note: session.start is only SSH.
+		// session.start is emitted for both SSH and Kubernetes sessions; kube
+		// sessions can be distinguished by their cluster metadata.
+		if e.KubernetesCluster != "" {
+			return trace.Wrap(u.report(&services.UsageKubeSessionStart{
+				UserName: e.User,
+			}))
+		}
+
 		return trace.Wrap(u.report(&services.UsageSessionStart{
 			UserName:    e.User,
 			SessionType: string(types.SSHSessionKind),
 		}))
+	case *apievents.DatabaseSessionStart:
+		return trace.Wrap(u.report(&services.UsageDatabaseSessionStart{
+			UserName: e.User,
+		}))
+	case *apievents.AppSessionStart:
+		return trace.Wrap(u.report(&services.UsageAppSessionStart{
+			UserName: e.User,
+		}))
+	case *apievents.WindowsDesktopSessionStart:
+		return trace.Wrap(u.report(&services.UsageWindowsDesktopSessionStart{
+			UserName: e.User,
+		}))
 	case *apievents.GithubConnectorCreate:
 		return trace.Wrap(u.report(&services.UsageSSOCreate{
 			ConnectorType: types.KindGithubConnector,
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package usageevents
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gravitational/teleport/api/types"
+	apievents "github.com/gravitational/teleport/api/types/events"
+	"github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/teleport/lib/utils"
+)
+
+// fakeUsageReporter records the events it receives.
+type fakeUsageReporter struct {
+	events []services.UsageAnonymizable
+}
+
+func (f *fakeUsageReporter) SubmitAnonymizedUsageEvents(events ...services.UsageAnonymizable) error {
+	f.events = append(f.events, events...)
+	return nil
+}
+
+// TestSessionStartConversion verifies that session start audit events of all
+// protocols are converted into the expected usage events, and that user names
+// are anonymized.
+func TestSessionStartConversion(t *testing.T) {
+	const userName = "alice"
+
+	anonymizer, err := utils.NewHMACAnonymizer("cluster-id")
+	require.NoError(t, err)
+
+	tts := []struct {
+		event       apievents.AuditEvent
+		sessionType types.SessionKind
+		desc        string
+	}{
+		{
+			event: &apievents.SessionStart{
+				UserMetadata: apievents.UserMetadata{User: userName},
+			},
+			sessionType: types.SSHSessionKind,
+			desc:        "ssh session",
+		},
+		{
+			event: &apievents.SessionStart{
+				UserMetadata: apievents.UserMetadata{User: userName},
+				KubernetesClusterMetadata: apievents.KubernetesClusterMetadata{
+					KubernetesCluster: "kube",
+				},
+			},
+			sessionType: types.KubernetesSessionKind,
+			desc:        "kube session",
+		},
+		{
+			event: &apievents.DatabaseSessionStart{
+				UserMetadata: apievents.UserMetadata{User: userName},
+			},
+			sessionType: types.DatabaseSessionKind,
+			desc:        "database session",
+		},
+		{
+			event: &apievents.AppSessionStart{
+				UserMetadata: apievents.UserMetadata{User: userName},
+			},
+			sessionType: types.AppSessionKind,
+			desc:        "app session",
+		},
+		{
+			event: &apievents.WindowsDesktopSessionStart{
+				UserMetadata: apievents.UserMetadata{User: userName},
+			},
+			sessionType: types.WindowsDesktopSessionKind,
+			desc:        "desktop session",
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.desc, func(t *testing.T) {
+			reporter := &fakeUsageReporter{}
+			logger, err := New(reporter, nil, nil)
+			require.NoError(t, err)
+
+			require.NoError(t, logger.EmitAuditEvent(context.Background(), tt.event))
+			require.Len(t, reporter.events, 1)
+
+			anonymized := reporter.events[0].Anonymize(anonymizer)
+			sessionStart := anonymized.GetSessionStart()
+			require.NotNil(t, sessionStart)
+			require.Equal(t, string(tt.sessionType), sessionStart.SessionType)
+			require.Equal(t, anonymizer.AnonymizeString(userName), sessionStart.UserName)
+		})
+	}
+}
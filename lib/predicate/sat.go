@@ -0,0 +1,555 @@
+/*
+Copyright 2023 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package predicate contains a small SAT solver for boolean predicate
+// formulas, used to reason about the satisfiability of access control
+// expressions.
+package predicate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// node is a boolean formula: an identifier, a negation, a conjunction
+// or a disjunction.
+type node interface{}
+
+// nodeIdent is a boolean variable.
+type nodeIdent string
+
+// nodeNot negates a subformula.
+type nodeNot struct {
+	n node
+}
+
+// nodeAnd is the conjunction of two subformulas.
+type nodeAnd struct {
+	left, right node
+}
+
+// nodeOr is the disjunction of two subformulas.
+type nodeOr struct {
+	left, right node
+}
+
+// literal is an identifier or its negation, the building block of CNF
+// clauses.
+type literal struct {
+	name    string
+	negated bool
+}
+
+// dpll clause evaluation statuses.
+const (
+	dpllUnknown = iota
+	dpllSatisfied
+	dpllUnsatisfied
+)
+
+// state tracks the clause database and the current assignment while
+// solving.
+type state struct {
+	clauses     []node
+	lits        [][]literal
+	assignments map[string]bool
+	// watched maps a variable to the clauses watching one of its
+	// literals; watches holds the two watched literal positions of
+	// each clause.
+	watched map[string][]int
+	watches [][2]int
+	// trail records assignments in order so they can be undone, and
+	// decisions counts branching choices for benchmarks.
+	trail     []string
+	decisions int
+}
+
+// newState converts the formula to CNF by distribution and prepares
+// the solving state.
+func newState(n node) *state {
+	return newClauseState(toCNF(n))
+}
+
+// newClauseState prepares the solving state for a clause database.
+func newClauseState(clauses []node) *state {
+	s := &state{
+		assignments: make(map[string]bool),
+		watched:     make(map[string][]int),
+	}
+	for _, clause := range clauses {
+		s.addClause(clause)
+	}
+	return s
+}
+
+// addClause appends a clause and starts watching its first and last
+// literals; a unit clause watches its only literal once.
+func (s *state) addClause(clause node) {
+	lits := literals(clause)
+	ci := len(s.clauses)
+	s.clauses = append(s.clauses, clause)
+	s.lits = append(s.lits, lits)
+	last := len(lits) - 1
+	s.watches = append(s.watches, [2]int{0, last})
+	s.watch(lits[0].name, ci)
+	if last != 0 {
+		s.watch(lits[last].name, ci)
+	}
+}
+
+func (s *state) watch(name string, ci int) {
+	s.watched[name] = append(s.watched[name], ci)
+}
+
+func (s *state) unwatch(name string, ci int) {
+	clauses := s.watched[name]
+	for i, c := range clauses {
+		if c == ci {
+			s.watched[name] = append(clauses[:i], clauses[i+1:]...)
+			return
+		}
+	}
+}
+
+// assign records a variable assignment on the trail.
+func (s *state) assign(name string, value bool) {
+	s.assignments[name] = value
+	s.trail = append(s.trail, name)
+}
+
+// backtrackAdjust undoes every assignment made after the trail mark.
+// Watches need no undoing: a moved watch points at a literal that is
+// not false, and popping assignments can only make literals less false.
+func (s *state) backtrackAdjust(mark int) {
+	for _, name := range s.trail[mark:] {
+		delete(s.assignments, name)
+	}
+	s.trail = s.trail[:mark]
+}
+
+// uprop performs two-watched-literal unit propagation starting from
+// the freshly assigned variables in queue, assigning forced literals
+// until a fixpoint. It returns false when a conflict is found.
+func (s *state) uprop(queue []string) bool {
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		// enforce rewires s.watched[name], so iterate over a copy.
+		for _, ci := range append([]int(nil), s.watched[name]...) {
+			forced, status := s.enforce(ci, name)
+			switch status {
+			case dpllUnsatisfied:
+				return false
+			case dpllUnknown:
+				if _, assigned := s.assignments[forced.name]; !assigned {
+					s.assign(forced.name, !forced.negated)
+					queue = append(queue, forced.name)
+				}
+			}
+		}
+	}
+	return true
+}
+
+// enforce re-establishes the watch invariant for clause ci after the
+// variable name was assigned: a clause watches two literals not known
+// to be false. When the invariant cannot be restored the clause is
+// either unit — the remaining watched literal is returned with
+// dpllUnknown so the caller can propagate it — or a conflict,
+// reported as dpllUnsatisfied.
+func (s *state) enforce(ci int, name string) (literal, int) {
+	lits := s.lits[ci]
+	w := &s.watches[ci]
+	for slot := range w {
+		lit := lits[w[slot]]
+		if lit.name != name || s.litValue(lit) != dpllUnsatisfied {
+			continue
+		}
+		if next, ok := s.findWatch(ci); ok {
+			s.unwatch(name, ci)
+			s.watch(lits[next].name, ci)
+			w[slot] = next
+			continue
+		}
+		if w[0] == w[1] {
+			return literal{}, dpllUnsatisfied
+		}
+		other := lits[w[1-slot]]
+		switch s.litValue(other) {
+		case dpllSatisfied:
+			return literal{}, dpllSatisfied
+		case dpllUnsatisfied:
+			return literal{}, dpllUnsatisfied
+		}
+		return other, dpllUnknown
+	}
+	return literal{}, dpllSatisfied
+}
+
+// findWatch looks for an unwatched literal of clause ci that is not
+// false under the current assignment.
+func (s *state) findWatch(ci int) (int, bool) {
+	w := s.watches[ci]
+	for j, lit := range s.lits[ci] {
+		if j == w[0] || j == w[1] {
+			continue
+		}
+		if s.litValue(lit) != dpllUnsatisfied {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// Solve reports whether the formula is satisfiable and, if so, returns
+// a satisfying assignment of its variables. Variables whose value does
+// not matter may be left out of the assignment.
+func Solve(n node) (map[string]bool, bool) {
+	var s *state
+	if size(n) > tseitinThreshold {
+		s = newClauseState(toCNFTseitin(n))
+	} else {
+		s = newState(n)
+	}
+	// Seed propagation with the formula's unit clauses before
+	// branching at all.
+	for _, lits := range s.lits {
+		if len(lits) != 1 {
+			continue
+		}
+		switch lit := lits[0]; s.litValue(lit) {
+		case dpllUnsatisfied:
+			return nil, false
+		case dpllUnknown:
+			s.assign(lit.name, !lit.negated)
+			if !s.uprop([]string{lit.name}) {
+				return nil, false
+			}
+		}
+	}
+	if !s.dpll() {
+		return nil, false
+	}
+	model := make(map[string]bool, len(s.assignments))
+	for name, value := range s.assignments {
+		if !strings.HasPrefix(name, tseitinPrefix) {
+			model[name] = value
+		}
+	}
+	return model, true
+}
+
+// dpll runs a DPLL backtracking search over the clause database,
+// extending s.assignments until every clause is satisfied or the
+// search space is exhausted. Forced assignments are discovered by
+// unit propagation after each branch decision.
+func (s *state) dpll() bool {
+	switch s.evalClauses() {
+	case dpllSatisfied:
+		return true
+	case dpllUnsatisfied:
+		return false
+	}
+	name := s.pickUnassigned()
+	s.decisions++
+	for _, value := range []bool{true, false} {
+		mark := len(s.trail)
+		s.assign(name, value)
+		if s.uprop([]string{name}) && s.dpll() {
+			return true
+		}
+		s.backtrackAdjust(mark)
+	}
+	return false
+}
+
+// evalClauses evaluates the whole clause database: dpllUnsatisfied as
+// soon as any clause is, dpllSatisfied when every clause is, and
+// dpllUnknown otherwise.
+func (s *state) evalClauses() int {
+	status := dpllSatisfied
+	for _, clause := range s.clauses {
+		switch s.evalClause(clause) {
+		case dpllUnsatisfied:
+			return dpllUnsatisfied
+		case dpllUnknown:
+			status = dpllUnknown
+		}
+	}
+	return status
+}
+
+// pickUnassigned returns the first unassigned variable in clause
+// order. Only called while some clause is still unknown, so an
+// unassigned variable exists.
+func (s *state) pickUnassigned() string {
+	for _, clause := range s.clauses {
+		for _, lit := range literals(clause) {
+			if _, assigned := s.assignments[lit.name]; !assigned {
+				return lit.name
+			}
+		}
+	}
+	panic("no unassigned variable")
+}
+
+// evalClause evaluates a clause against the current assignment:
+// dpllSatisfied when any literal is true, dpllUnsatisfied when every
+// literal is assigned and false, dpllUnknown otherwise.
+func (s *state) evalClause(clause node) int {
+	unknown := false
+	for _, lit := range literals(clause) {
+		switch s.litValue(lit) {
+		case dpllSatisfied:
+			return dpllSatisfied
+		case dpllUnknown:
+			unknown = true
+		}
+	}
+	if unknown {
+		return dpllUnknown
+	}
+	return dpllUnsatisfied
+}
+
+// litValue evaluates a single literal: dpllSatisfied when it is true
+// under the current assignment, dpllUnsatisfied when false, and
+// dpllUnknown when its variable is unassigned.
+func (s *state) litValue(lit literal) int {
+	value, assigned := s.assignments[lit.name]
+	if !assigned {
+		return dpllUnknown
+	}
+	if value != lit.negated {
+		return dpllSatisfied
+	}
+	return dpllUnsatisfied
+}
+
+// toCNF converts a formula to conjunctive normal form: negations are
+// pushed down onto the identifiers and disjunctions are distributed
+// over conjunctions. The result is a flat slice of clauses, each a
+// disjunction of possibly negated identifiers, whose conjunction is
+// equivalent to n.
+func toCNF(n node) []node {
+	return conjuncts(nnf(n))
+}
+
+// nnf rewrites n into negation normal form, pushing nodeNot through
+// conjunctions and disjunctions with De Morgan's laws and eliminating
+// double negations.
+func nnf(n node) node {
+	switch n := n.(type) {
+	case nodeIdent:
+		return n
+	case nodeAnd:
+		return nodeAnd{left: nnf(n.left), right: nnf(n.right)}
+	case nodeOr:
+		return nodeOr{left: nnf(n.left), right: nnf(n.right)}
+	case nodeNot:
+		switch inner := n.n.(type) {
+		case nodeIdent:
+			return n
+		case nodeNot:
+			return nnf(inner.n)
+		case nodeAnd:
+			return nodeOr{left: nnf(nodeNot{n: inner.left}), right: nnf(nodeNot{n: inner.right})}
+		case nodeOr:
+			return nodeAnd{left: nnf(nodeNot{n: inner.left}), right: nnf(nodeNot{n: inner.right})}
+		}
+	}
+	panic(fmt.Sprintf("unexpected node of type %T", n))
+}
+
+// conjuncts returns the CNF clauses of a formula already in negation
+// normal form, distributing disjunctions over conjunctions.
+func conjuncts(n node) []node {
+	switch n := n.(type) {
+	case nodeAnd:
+		return append(conjuncts(n.left), conjuncts(n.right)...)
+	case nodeOr:
+		var out []node
+		for _, left := range conjuncts(n.left) {
+			for _, right := range conjuncts(n.right) {
+				out = append(out, nodeOr{left: left, right: right})
+			}
+		}
+		return out
+	}
+	return []node{n}
+}
+
+// assignment fixes a variable to a value for the duration of a solve.
+type assignment struct {
+	name  string
+	value bool
+}
+
+// Solver answers satisfiability queries over a growing clause database
+// under varying sets of assumptions, reusing the clause and watch
+// structures between solves instead of rebuilding them each time.
+type Solver struct {
+	state *state
+}
+
+// NewSolver returns a solver with an empty clause database.
+func NewSolver() *Solver {
+	return &Solver{state: newClauseState(nil)}
+}
+
+// AddClause conjoins a formula to the clause database.
+func (s *Solver) AddClause(n node) {
+	for _, clause := range toCNF(n) {
+		s.state.addClause(clause)
+	}
+}
+
+// SolveUnder solves the clause database with the assumptions fixed,
+// returning a satisfying assignment that includes them on success.
+// The assumptions are retracted before returning, so the solver can
+// be queried again under a different set.
+func (s *Solver) SolveUnder(assumptions []assignment) (map[string]bool, bool) {
+	st := s.state
+	mark := len(st.trail)
+	defer st.backtrackAdjust(mark)
+	for _, a := range assumptions {
+		if value, assigned := st.assignments[a.name]; assigned {
+			if value != a.value {
+				return nil, false
+			}
+			continue
+		}
+		st.assign(a.name, a.value)
+		if !st.uprop([]string{a.name}) {
+			return nil, false
+		}
+	}
+	if !st.dpll() {
+		return nil, false
+	}
+	model := make(map[string]bool, len(st.assignments))
+	for name, value := range st.assignments {
+		model[name] = value
+	}
+	return model, true
+}
+
+// tseitinPrefix marks the auxiliary variables introduced by the
+// Tseitin transformation; Solve strips them from the returned model.
+const tseitinPrefix = "tseitin!"
+
+// tseitinThreshold is the formula size in connectives above which
+// Solve prefers the Tseitin transformation over distribution.
+const tseitinThreshold = 16
+
+// toCNFTseitin converts a formula to an equisatisfiable CNF by naming
+// every conjunction and disjunction with an auxiliary variable instead
+// of distributing, keeping the clause count linear in the formula size
+// where distribution can be exponential.
+func toCNFTseitin(n node) []node {
+	t := &tseitin{}
+	root := t.lit(nnf(n))
+	t.clauses = append(t.clauses, litNode(root))
+	return t.clauses
+}
+
+// tseitin accumulates the defining clauses of the transformation.
+type tseitin struct {
+	clauses []node
+	next    int
+}
+
+// lit returns a literal equivalent to the NNF formula n, emitting
+// clauses that tie each fresh auxiliary variable to its subformula.
+func (t *tseitin) lit(n node) literal {
+	switch n := n.(type) {
+	case nodeIdent, nodeNot:
+		return literals(n)[0]
+	case nodeAnd:
+		left, right, aux := t.lit(n.left), t.lit(n.right), t.fresh()
+		// aux <-> left && right
+		t.emit(aux.neg(), left)
+		t.emit(aux.neg(), right)
+		t.emit(aux, left.neg(), right.neg())
+		return aux
+	case nodeOr:
+		left, right, aux := t.lit(n.left), t.lit(n.right), t.fresh()
+		// aux <-> left || right
+		t.emit(aux.neg(), left, right)
+		t.emit(aux, left.neg())
+		t.emit(aux, right.neg())
+		return aux
+	}
+	panic(fmt.Sprintf("unexpected node of type %T", n))
+}
+
+func (t *tseitin) fresh() literal {
+	name := fmt.Sprintf("%s%d", tseitinPrefix, t.next)
+	t.next++
+	return literal{name: name}
+}
+
+func (t *tseitin) emit(lits ...literal) {
+	clause := litNode(lits[0])
+	for _, lit := range lits[1:] {
+		clause = nodeOr{left: clause, right: litNode(lit)}
+	}
+	t.clauses = append(t.clauses, clause)
+}
+
+// size counts the connectives of a formula.
+func size(n node) int {
+	switch n := n.(type) {
+	case nodeNot:
+		return 1 + size(n.n)
+	case nodeAnd:
+		return 1 + size(n.left) + size(n.right)
+	case nodeOr:
+		return 1 + size(n.left) + size(n.right)
+	}
+	return 0
+}
+
+// neg returns the literal's negation.
+func (l literal) neg() literal {
+	return literal{name: l.name, negated: !l.negated}
+}
+
+// litNode converts a literal back to node form.
+func litNode(l literal) node {
+	if l.negated {
+		return nodeNot{n: nodeIdent(l.name)}
+	}
+	return nodeIdent(l.name)
+}
+
+// literals flattens a clause into its literals. Clauses produced by
+// toCNF only contain disjunctions of possibly negated identifiers.
+func literals(clause node) []literal {
+	switch n := clause.(type) {
+	case nodeIdent:
+		return []literal{{name: string(n)}}
+	case nodeNot:
+		ident, ok := n.n.(nodeIdent)
+		if !ok {
+			panic(fmt.Sprintf("negation of %T in a clause", n.n))
+		}
+		return []literal{{name: string(ident), negated: true}}
+	case nodeOr:
+		return append(literals(n.left), literals(n.right)...)
+	}
+	panic(fmt.Sprintf("unexpected node of type %T in a clause", clause))
+}
@@ -0,0 +1,488 @@
+/*
+Copyright 2023 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package predicate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// evalFormula evaluates a formula under a full assignment.
+func evalFormula(n node, values map[string]bool) bool {
+	switch n := n.(type) {
+	case nodeIdent:
+		return values[string(n)]
+	case nodeNot:
+		return !evalFormula(n.n, values)
+	case nodeAnd:
+		return evalFormula(n.left, values) && evalFormula(n.right, values)
+	case nodeOr:
+		return evalFormula(n.left, values) || evalFormula(n.right, values)
+	}
+	panic("unexpected node")
+}
+
+// formulaVars returns the identifiers of n in sorted order.
+func formulaVars(n node) []string {
+	seen := make(map[string]bool)
+	var collect func(n node)
+	collect = func(n node) {
+		switch n := n.(type) {
+		case nodeIdent:
+			seen[string(n)] = true
+		case nodeNot:
+			collect(n.n)
+		case nodeAnd:
+			collect(n.left)
+			collect(n.right)
+		case nodeOr:
+			collect(n.left)
+			collect(n.right)
+		}
+	}
+	collect(n)
+	vars := make([]string, 0, len(seen))
+	for name := range seen {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// requireEquivalent brute-forces every assignment of the formula's
+// variables and checks that the conjunction of clauses agrees with the
+// original formula.
+func requireEquivalent(t *testing.T, formula node, clauses []node) {
+	t.Helper()
+	vars := formulaVars(formula)
+	for bits := 0; bits < 1<<len(vars); bits++ {
+		values := make(map[string]bool)
+		for i, name := range vars {
+			values[name] = bits&(1<<i) != 0
+		}
+		want := evalFormula(formula, values)
+		got := true
+		for _, clause := range clauses {
+			got = got && evalFormula(clause, values)
+		}
+		require.Equal(t, want, got, "assignment %v", values)
+	}
+}
+
+func TestToCNF(t *testing.T) {
+	t.Parallel()
+
+	a, b, c, d := nodeIdent("a"), nodeIdent("b"), nodeIdent("c"), nodeIdent("d")
+	tests := []struct {
+		name    string
+		formula node
+		clauses int
+	}{
+		{
+			name:    "single identifier",
+			formula: a,
+			clauses: 1,
+		},
+		{
+			name:    "negated identifier",
+			formula: nodeNot{n: a},
+			clauses: 1,
+		},
+		{
+			name:    "double negation",
+			formula: nodeNot{n: nodeNot{n: a}},
+			clauses: 1,
+		},
+		{
+			name:    "de morgan over and",
+			formula: nodeNot{n: nodeAnd{left: a, right: b}},
+			clauses: 1,
+		},
+		{
+			name:    "de morgan over or",
+			formula: nodeNot{n: nodeOr{left: a, right: b}},
+			clauses: 2,
+		},
+		{
+			name:    "or distributed over and",
+			formula: nodeOr{left: nodeAnd{left: a, right: b}, right: c},
+			clauses: 2,
+		},
+		{
+			name:    "or of two conjunctions",
+			formula: nodeOr{left: nodeAnd{left: a, right: b}, right: nodeAnd{left: c, right: d}},
+			clauses: 4,
+		},
+		{
+			name:    "nested negation",
+			formula: nodeNot{n: nodeOr{left: a, right: nodeAnd{left: b, right: nodeNot{n: c}}}},
+			clauses: 2,
+		},
+		{
+			name:    "already in cnf",
+			formula: nodeAnd{left: nodeOr{left: a, right: nodeNot{n: b}}, right: nodeOr{left: c, right: d}},
+			clauses: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			clauses := toCNF(tt.formula)
+			require.Len(t, clauses, tt.clauses)
+			for _, clause := range clauses {
+				require.NotEmpty(t, literals(clause))
+			}
+			requireEquivalent(t, tt.formula, clauses)
+		})
+	}
+}
+
+// conj and disj fold formulas into right-leaning trees.
+func conj(ns ...node) node {
+	out := ns[len(ns)-1]
+	for i := len(ns) - 2; i >= 0; i-- {
+		out = nodeAnd{left: ns[i], right: out}
+	}
+	return out
+}
+
+func disj(ns ...node) node {
+	out := ns[len(ns)-1]
+	for i := len(ns) - 2; i >= 0; i-- {
+		out = nodeOr{left: ns[i], right: out}
+	}
+	return out
+}
+
+// pigeonhole builds the pigeonhole principle formula: every pigeon is
+// in some hole and no two pigeons share one. Unsatisfiable whenever
+// pigeons > holes, and famously hard for plain backtracking.
+func pigeonhole(pigeons, holes int) node {
+	ident := func(pigeon, hole int) node {
+		return nodeIdent(fmt.Sprintf("p%d_%d", pigeon, hole))
+	}
+	var clauses []node
+	for p := 0; p < pigeons; p++ {
+		var somewhere []node
+		for h := 0; h < holes; h++ {
+			somewhere = append(somewhere, ident(p, h))
+		}
+		clauses = append(clauses, disj(somewhere...))
+	}
+	for h := 0; h < holes; h++ {
+		for p1 := 0; p1 < pigeons; p1++ {
+			for p2 := p1 + 1; p2 < pigeons; p2++ {
+				clauses = append(clauses, disj(nodeNot{n: ident(p1, h)}, nodeNot{n: ident(p2, h)}))
+			}
+		}
+	}
+	return conj(clauses...)
+}
+
+// naiveDPLL is the plain backtracking search without unit propagation,
+// kept as a baseline for the decision-count comparison.
+func naiveDPLL(s *state, decisions *int) bool {
+	switch s.evalClauses() {
+	case dpllSatisfied:
+		return true
+	case dpllUnsatisfied:
+		return false
+	}
+	name := s.pickUnassigned()
+	*decisions++
+	for _, value := range []bool{true, false} {
+		s.assignments[name] = value
+		if naiveDPLL(s, decisions) {
+			return true
+		}
+	}
+	delete(s.assignments, name)
+	return false
+}
+
+func TestSolveUnder(t *testing.T) {
+	t.Parallel()
+
+	a, b, c := nodeIdent("a"), nodeIdent("b"), nodeIdent("c")
+	s := NewSolver()
+	s.AddClause(nodeOr{left: a, right: b})
+	s.AddClause(nodeOr{left: nodeNot{n: a}, right: c})
+
+	tests := []struct {
+		name        string
+		assumptions []assignment
+		sat         bool
+	}{
+		{
+			name:        "no assumptions",
+			assumptions: nil,
+			sat:         true,
+		},
+		{
+			name:        "a forces c",
+			assumptions: []assignment{{name: "a", value: true}},
+			sat:         true,
+		},
+		{
+			name:        "a without c conflicts",
+			assumptions: []assignment{{name: "a", value: true}, {name: "c", value: false}},
+			sat:         false,
+		},
+		{
+			name:        "no b forces a and c",
+			assumptions: []assignment{{name: "b", value: false}},
+			sat:         true,
+		},
+		{
+			name:        "contradictory assumptions",
+			assumptions: []assignment{{name: "b", value: false}, {name: "a", value: false}},
+			sat:         false,
+		},
+	}
+
+	// The sets run in order against the same solver; each solve must
+	// leave the state clean for the next one.
+	formula := nodeAnd{left: nodeOr{left: a, right: b}, right: nodeOr{left: nodeNot{n: a}, right: c}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, ok := s.SolveUnder(tt.assumptions)
+			require.Equal(t, tt.sat, ok)
+			if !tt.sat {
+				require.Nil(t, model)
+				return
+			}
+			for _, a := range tt.assumptions {
+				require.Equal(t, a.value, model[a.name])
+			}
+			require.True(t, evalFormula(formula, model))
+		})
+	}
+}
+
+func TestToCNFTseitin(t *testing.T) {
+	t.Parallel()
+
+	// A disjunction of n conjunctions explodes to 2^n clauses under
+	// distribution; Tseitin stays linear in the connective count.
+	const n = 12
+	var terms []node
+	for i := 0; i < n; i++ {
+		terms = append(terms, nodeAnd{left: nodeIdent(fmt.Sprintf("a%d", i)), right: nodeIdent(fmt.Sprintf("b%d", i))})
+	}
+	formula := disj(terms...)
+
+	require.Len(t, toCNF(formula), 1<<n)
+	clauses := toCNFTseitin(formula)
+	require.LessOrEqual(t, len(clauses), 3*size(formula)+1)
+
+	// The formula is over the threshold, so Solve takes the Tseitin
+	// path; the model must satisfy the input and contain no
+	// auxiliary variables.
+	require.Greater(t, size(formula), tseitinThreshold)
+	model, ok := Solve(formula)
+	require.True(t, ok)
+	for name := range model {
+		require.False(t, strings.HasPrefix(name, tseitinPrefix), "auxiliary variable %q in model", name)
+	}
+	require.True(t, evalFormula(formula, model))
+
+	// Unsatisfiability is preserved over the threshold too.
+	unsat := pigeonhole(4, 3)
+	require.Greater(t, size(unsat), tseitinThreshold)
+	_, ok = Solve(unsat)
+	require.False(t, ok)
+}
+
+func TestUnitPropagationCutsDecisions(t *testing.T) {
+	t.Parallel()
+
+	formula := pigeonhole(4, 3)
+
+	propagating := newState(formula)
+	require.False(t, propagating.dpll())
+
+	naive := newState(formula)
+	naiveDecisions := 0
+	require.False(t, naiveDPLL(naive, &naiveDecisions))
+
+	require.Less(t, propagating.decisions, naiveDecisions)
+}
+
+func BenchmarkSolvePigeonhole(b *testing.B) {
+	formula := pigeonhole(4, 3)
+	b.Run("propagation", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s := newState(formula)
+			if s.dpll() {
+				b.Fatal("pigeonhole formula is unsatisfiable")
+			}
+			b.ReportMetric(float64(s.decisions), "decisions/op")
+		}
+	})
+	b.Run("naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s := newState(formula)
+			decisions := 0
+			if naiveDPLL(s, &decisions) {
+				b.Fatal("pigeonhole formula is unsatisfiable")
+			}
+			b.ReportMetric(float64(decisions), "decisions/op")
+		}
+	})
+}
+
+func TestSolve(t *testing.T) {
+	t.Parallel()
+
+	a, b, c := nodeIdent("a"), nodeIdent("b"), nodeIdent("c")
+	tests := []struct {
+		name    string
+		formula node
+		sat     bool
+	}{
+		{
+			name:    "single identifier",
+			formula: a,
+			sat:     true,
+		},
+		{
+			name:    "contradiction",
+			formula: nodeAnd{left: a, right: nodeNot{n: a}},
+			sat:     false,
+		},
+		{
+			name:    "forced chain",
+			formula: nodeAnd{left: nodeAnd{left: a, right: nodeOr{left: nodeNot{n: a}, right: b}}, right: nodeOr{left: nodeNot{n: b}, right: c}},
+			sat:     true,
+		},
+		{
+			name: "unsat clause set",
+			formula: nodeAnd{
+				left:  nodeAnd{left: nodeOr{left: a, right: b}, right: nodeOr{left: nodeNot{n: a}, right: b}},
+				right: nodeNot{n: b},
+			},
+			sat: false,
+		},
+		{
+			name:    "negated disjunction",
+			formula: nodeNot{n: nodeOr{left: a, right: nodeAnd{left: b, right: nodeNot{n: c}}}},
+			sat:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			model, ok := Solve(tt.formula)
+			require.Equal(t, tt.sat, ok)
+			if !tt.sat {
+				require.Nil(t, model)
+				return
+			}
+			// Unassigned variables default to false; any extension of
+			// the partial model satisfies the formula.
+			require.True(t, evalFormula(tt.formula, model))
+		})
+	}
+}
+
+func TestEvalClause(t *testing.T) {
+	t.Parallel()
+
+	a, b := nodeIdent("a"), nodeIdent("b")
+	tests := []struct {
+		name        string
+		clause      node
+		assignments map[string]bool
+		want        int
+	}{
+		{
+			name:        "unassigned identifier",
+			clause:      a,
+			assignments: map[string]bool{},
+			want:        dpllUnknown,
+		},
+		{
+			name:        "true identifier",
+			clause:      a,
+			assignments: map[string]bool{"a": true},
+			want:        dpllSatisfied,
+		},
+		{
+			name:        "false identifier",
+			clause:      a,
+			assignments: map[string]bool{"a": false},
+			want:        dpllUnsatisfied,
+		},
+		{
+			name:        "negation of false identifier",
+			clause:      nodeNot{n: a},
+			assignments: map[string]bool{"a": false},
+			want:        dpllSatisfied,
+		},
+		{
+			name:        "negation of true identifier",
+			clause:      nodeNot{n: a},
+			assignments: map[string]bool{"a": true},
+			want:        dpllUnsatisfied,
+		},
+		{
+			name:        "one true literal satisfies",
+			clause:      nodeOr{left: a, right: nodeNot{n: b}},
+			assignments: map[string]bool{"b": false},
+			want:        dpllSatisfied,
+		},
+		{
+			name:        "partial assignment stays unknown",
+			clause:      nodeOr{left: a, right: b},
+			assignments: map[string]bool{"a": false},
+			want:        dpllUnknown,
+		},
+		{
+			name:        "all literals false",
+			clause:      nodeOr{left: a, right: nodeNot{n: b}},
+			assignments: map[string]bool{"a": false, "b": true},
+			want:        dpllUnsatisfied,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := &state{assignments: tt.assignments}
+			require.Equal(t, tt.want, s.evalClause(tt.clause))
+		})
+	}
+}
+
+func TestNewState(t *testing.T) {
+	t.Parallel()
+
+	formula := nodeOr{left: nodeAnd{left: nodeIdent("a"), right: nodeIdent("b")}, right: nodeNot{n: nodeIdent("c")}}
+	s := newState(formula)
+	require.Len(t, s.clauses, 2)
+	require.Empty(t, s.assignments)
+	requireEquivalent(t, formula, s.clauses)
+}
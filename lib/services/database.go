@@ -622,6 +622,61 @@ func NewDatabaseFromRedshiftCluster(cluster *redshift.Cluster) (types.Database,
 		})
 }
 
+// NewDatabaseFromRedshiftServerlessWorkgroup creates a database resource from
+// a Redshift Serverless workgroup.
+func NewDatabaseFromRedshiftServerlessWorkgroup(workgroup *redshiftserverless.Workgroup, tags []*redshiftserverless.Tag) (types.Database, error) {
+	// Endpoint can be nil while the workgroup is being created. Return an
+	// error until the endpoint is available.
+	if workgroup.Endpoint == nil {
+		return nil, trace.BadParameter("missing endpoint in Redshift Serverless workgroup %v", aws.StringValue(workgroup.WorkgroupName))
+	}
+
+	metadata, err := MetadataFromRedshiftServerlessWorkgroup(workgroup)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return types.NewDatabaseV3(
+		setDBName(types.Metadata{
+			Description: fmt.Sprintf("Redshift Serverless workgroup in %v", metadata.Region),
+			Labels:      labelsFromRedshiftServerlessWorkgroup(workgroup, metadata, tags),
+		}, metadata.RedshiftServerless.WorkgroupName),
+		types.DatabaseSpecV3{
+			Protocol: defaults.ProtocolPostgres,
+			URI:      fmt.Sprintf("%v:%v", aws.StringValue(workgroup.Endpoint.Address), aws.Int64Value(workgroup.Endpoint.Port)),
+			AWS:      *metadata,
+		})
+}
+
+// NewDatabaseFromRedshiftServerlessVPCEndpoint creates a database resource
+// from a Redshift Serverless VPC endpoint.
+func NewDatabaseFromRedshiftServerlessVPCEndpoint(endpoint *redshiftserverless.EndpointAccess, workgroup *redshiftserverless.Workgroup, tags []*redshiftserverless.Tag) (types.Database, error) {
+	if workgroup.Endpoint == nil {
+		return nil, trace.BadParameter("missing endpoint in Redshift Serverless workgroup %v", aws.StringValue(workgroup.WorkgroupName))
+	}
+
+	metadata, err := MetadataFromRedshiftServerlessVPCEndpoint(endpoint, workgroup)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return types.NewDatabaseV3(
+		setDBName(types.Metadata{
+			Description: fmt.Sprintf("Redshift Serverless endpoint in %v", metadata.Region),
+			Labels:      labelsFromRedshiftServerlessVPCEndpoint(endpoint, workgroup, metadata, tags),
+		}, metadata.RedshiftServerless.WorkgroupName, metadata.RedshiftServerless.EndpointName),
+		types.DatabaseSpecV3{
+			Protocol: defaults.ProtocolPostgres,
+			URI:      fmt.Sprintf("%v:%v", aws.StringValue(endpoint.Address), aws.Int64Value(endpoint.Port)),
+			AWS:      *metadata,
+
+			// Use workgroup's default address as the server name.
+			TLS: types.DatabaseTLS{
+				ServerName: aws.StringValue(workgroup.Endpoint.Address),
+			},
+		})
+}
+
 // NewDatabaseFromElastiCacheConfigurationEndpoint creates a database resource
 // from ElastiCache configuration endpoint.
 func NewDatabaseFromElastiCacheConfigurationEndpoint(cluster *elasticache.ReplicationGroup, extraLabels map[string]string) (types.Database, error) {
@@ -1084,6 +1139,46 @@ func labelsFromRedshiftCluster(cluster *redshift.Cluster, meta *types.AWS) map[s
 	return labels
 }
 
+// labelsFromRedshiftServerlessWorkgroup creates database labels for the
+// provided Redshift Serverless workgroup.
+func labelsFromRedshiftServerlessWorkgroup(workgroup *redshiftserverless.Workgroup, meta *types.AWS, tags []*redshiftserverless.Tag) map[string]string {
+	labels := labelsFromRedshiftServerlessTags(tags)
+	labels[types.OriginLabel] = types.OriginCloud
+	labels[labelAccountID] = meta.AccountID
+	labels[labelRegion] = meta.Region
+	labels[labelEndpointType] = RedshiftServerlessWorkgroupEndpoint
+	labels[labelNamespace] = aws.StringValue(workgroup.NamespaceName)
+	return labels
+}
+
+// labelsFromRedshiftServerlessVPCEndpoint creates database labels for the
+// provided Redshift Serverless VPC endpoint.
+func labelsFromRedshiftServerlessVPCEndpoint(endpoint *redshiftserverless.EndpointAccess, workgroup *redshiftserverless.Workgroup, meta *types.AWS, tags []*redshiftserverless.Tag) map[string]string {
+	labels := labelsFromRedshiftServerlessTags(tags)
+	labels[types.OriginLabel] = types.OriginCloud
+	labels[labelAccountID] = meta.AccountID
+	labels[labelRegion] = meta.Region
+	labels[labelEndpointType] = RedshiftServerlessVPCEndpoint
+	labels[labelWorkgroup] = aws.StringValue(endpoint.WorkgroupName)
+	labels[labelNamespace] = aws.StringValue(workgroup.NamespaceName)
+	return labels
+}
+
+// labelsFromRedshiftServerlessTags converts Redshift Serverless resource tags
+// to a labels map.
+func labelsFromRedshiftServerlessTags(tags []*redshiftserverless.Tag) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range tags {
+		key := aws.StringValue(tag.Key)
+		if types.IsValidLabelKey(key) {
+			labels[key] = aws.StringValue(tag.Value)
+		} else {
+			log.Debugf("Skipping Redshift Serverless tag %q, not a valid label key.", key)
+		}
+	}
+	return labels
+}
+
 // labelsFromMetaAndEndpointType creates database labels from provided AWS meta and endpoint type.
 func labelsFromMetaAndEndpointType(meta *types.AWS, endpointType string, extraLabels map[string]string) map[string]string {
 	labels := make(map[string]string)
@@ -1287,6 +1382,44 @@ func IsRedshiftClusterAvailable(cluster *redshift.Cluster) bool {
 	}
 }
 
+// IsRedshiftServerlessWorkgroupAvailable checks if the Redshift Serverless
+// workgroup is available.
+func IsRedshiftServerlessWorkgroupAvailable(workgroup *redshiftserverless.Workgroup) bool {
+	switch aws.StringValue(workgroup.Status) {
+	case redshiftserverless.WorkgroupStatusAvailable, redshiftserverless.WorkgroupStatusModifying:
+		return true
+
+	case redshiftserverless.WorkgroupStatusCreating, redshiftserverless.WorkgroupStatusDeleting:
+		return false
+
+	default:
+		log.Warnf("Unknown status type: %q. Assuming Redshift Serverless workgroup %q is available.",
+			aws.StringValue(workgroup.Status),
+			aws.StringValue(workgroup.WorkgroupName),
+		)
+		return true
+	}
+}
+
+// IsRedshiftServerlessEndpointAvailable checks if the Redshift Serverless
+// VPC endpoint is available.
+func IsRedshiftServerlessEndpointAvailable(endpoint *redshiftserverless.EndpointAccess) bool {
+	switch strings.ToLower(aws.StringValue(endpoint.EndpointStatus)) {
+	case "active", "available", "modifying":
+		return true
+
+	case "creating", "deleting":
+		return false
+
+	default:
+		log.Warnf("Unknown status type: %q. Assuming Redshift Serverless endpoint %q is available.",
+			aws.StringValue(endpoint.EndpointStatus),
+			aws.StringValue(endpoint.EndpointName),
+		)
+		return true
+	}
+}
+
 // IsElastiCacheClusterAvailable checks if the ElastiCache cluster is
 // available.
 func IsElastiCacheClusterAvailable(cluster *elasticache.ReplicationGroup) bool {
@@ -1407,6 +1540,12 @@ const (
 	labelEndpointType = "endpoint-type"
 	// labelVPCID is the label key containing the VPC ID.
 	labelVPCID = "vpc-id"
+	// labelNamespace is the label key containing the Redshift Serverless
+	// namespace name.
+	labelNamespace = "namespace"
+	// labelWorkgroup is the label key containing the Redshift Serverless
+	// workgroup name.
+	labelWorkgroup = "workgroup"
 	// labelTeleportDBName is the label key containing the database name override.
 	labelTeleportDBName = types.TeleportNamespace + "/database_name"
 	// labelTeleportDBNameAzure is the label key containing the database name
@@ -1415,6 +1554,15 @@ const (
 	labelTeleportDBNameAzure = "TeleportDatabaseName"
 )
 
+const (
+	// RedshiftServerlessWorkgroupEndpoint is the endpoint type label value
+	// for Redshift Serverless workgroup endpoints.
+	RedshiftServerlessWorkgroupEndpoint = "workgroup"
+	// RedshiftServerlessVPCEndpoint is the endpoint type label value for
+	// Redshift Serverless VPC endpoints.
+	RedshiftServerlessVPCEndpoint = "vpc-endpoint"
+)
+
 const (
 	// RDSEngineMySQL is RDS engine name for MySQL instances.
 	RDSEngineMySQL = "mysql"
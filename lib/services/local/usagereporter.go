@@ -21,6 +21,9 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/bufbuild/connect-go"
@@ -28,10 +31,12 @@ import (
 	"github.com/jonboulle/clockwork"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/gravitational/teleport"
 	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/api/utils/retryutils"
 	"github.com/gravitational/teleport/lib/defaults"
 	"github.com/gravitational/teleport/lib/observability/metrics"
 	prehogapi "github.com/gravitational/teleport/lib/prehog/gen/prehog/v1alpha"
@@ -67,6 +72,26 @@ const (
 	// usageReporterRetryAttempts is the max number of attempts that
 	// should be made to submit a particular event before it's dropped
 	usageReporterRetryAttempts = 5
+
+	// usageReporterBackoffStep is the amount by which the submission delay
+	// grows for each consecutive failed submission.
+	usageReporterBackoffStep = time.Second * 10
+
+	// usageReporterBackoffMax caps the additional delay applied to
+	// submissions after repeated failures.
+	usageReporterBackoffMax = time.Minute * 2
+
+	// usageReporterDeadLetterFileName is the name of the file that discarded
+	// events are appended to in the dead-letter directory.
+	usageReporterDeadLetterFileName = "usage-events.jsonl"
+
+	// usageReporterDeadLetterMaxSize is the size at which the dead-letter
+	// file is rotated. A single previous file is kept.
+	usageReporterDeadLetterMaxSize = 1024 * 1024 * 10
+
+	// usageReporterDedupCacheSize bounds the number of recently-seen dedup
+	// keys kept in memory.
+	usageReporterDedupCacheSize = 1000
 )
 
 var (
@@ -112,10 +137,22 @@ var (
 		Help:      "a count of events dropped due to repeated errors or submission buffer overflow",
 	})
 
+	usageEventsBuffered = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: teleport.MetricNamespace,
+		Name:      teleport.MetricUsageEventsBuffered,
+		Help:      "the current number of events waiting in the batching buffer",
+	})
+
+	usageBatchesQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: teleport.MetricNamespace,
+		Name:      teleport.MetricUsageBatchesQueued,
+		Help:      "the current number of batches waiting in the submission queue",
+	})
+
 	usagePrometheusCollectors = []prometheus.Collector{
 		usageEventsSubmitted, usageBatchesTotal, usageEventsRequeuedTotal,
 		usageBatchSubmissionDuration, usageBatchesSubmitted, usageBatchesFailed,
-		usageEventsDropped,
+		usageEventsDropped, usageEventsBuffered, usageBatchesQueued,
 	}
 )
 
@@ -135,6 +172,104 @@ func NewDiscardUsageReporter() *DiscardUsageReporter {
 // submitFunc is a func that submits a batch of usage events.
 type UsageSubmitFunc func(reporter *UsageReporter, batch []*SubmittedEvent) ([]*SubmittedEvent, error)
 
+// UsageReporterConfig provides tunables for a UsageReporter's batching
+// behavior, letting operators trade memory use against submission latency.
+// The zero value of each field selects its default.
+type UsageReporterConfig struct {
+	// MinBatchSize is the batch size at which a batch is sent regardless of
+	// elapsed time.
+	MinBatchSize int
+
+	// MaxBatchSize is the largest batch size that will be sent to the server;
+	// batches larger than this will be split into multiple requests.
+	MaxBatchSize int
+
+	// MaxBatchAge is the maximum age a batch may reach before being flushed,
+	// regardless of the batch size.
+	MaxBatchAge time.Duration
+
+	// MaxBufferSize is the maximum size to which the event buffer may grow.
+	// Events submitted once this limit is reached will be discarded.
+	MaxBufferSize int
+
+	// SubmitDelay is a mandatory delay added to each batch submission to
+	// avoid spamming the prehog instance.
+	SubmitDelay time.Duration
+
+	// RetryAttempts is the max number of attempts that should be made to
+	// submit a particular event before it's dropped.
+	RetryAttempts int
+
+	// DeadLetterDir, if set, is a directory where discarded events (buffer
+	// overflow, max retries exceeded) are persisted as JSON lines so they can
+	// be audited or replayed. When unset, discarded events are lost.
+	DeadLetterDir string
+
+	// DedupWindow, if set, enables deduplication of events carrying the same
+	// idempotency key (see services.UsageDeduplicable): an event whose key
+	// was already seen within the window is dropped before it is buffered.
+	// Zero disables deduplication.
+	DedupWindow time.Duration
+
+	// OnSubmitSuccess, if set, is called with the batch size each time a batch
+	// of events is submitted successfully. It is invoked synchronously from the
+	// reporter's goroutines and must return quickly.
+	OnSubmitSuccess func(n int)
+
+	// OnSubmitError, if set, is called with the batch size and the submission
+	// error each time a batch fails to submit; failed events may still be
+	// retried afterwards. It is invoked synchronously from the reporter's
+	// goroutines and must return quickly.
+	OnSubmitError func(n int, err error)
+
+	// OnDiscard, if set, is called with the number of events discarded each
+	// time events are dropped, whether due to buffer overflow or exhausted
+	// retries. It is invoked synchronously from the reporter's goroutines and
+	// must return quickly.
+	OnDiscard func(n int)
+}
+
+// CheckAndSetDefaults validates the config and applies defaults.
+func (c *UsageReporterConfig) CheckAndSetDefaults() error {
+	if c.MinBatchSize < 0 || c.MaxBatchSize < 0 || c.MaxBufferSize < 0 || c.RetryAttempts < 0 {
+		return trace.BadParameter("usage reporter config sizes and attempts must not be negative")
+	}
+
+	if c.MaxBatchAge < 0 || c.SubmitDelay < 0 || c.DedupWindow < 0 {
+		return trace.BadParameter("usage reporter config durations must not be negative")
+	}
+
+	if c.MinBatchSize == 0 {
+		c.MinBatchSize = usageReporterMinBatchSize
+	}
+
+	if c.MaxBatchSize == 0 {
+		c.MaxBatchSize = usageReporterMaxBatchSize
+	}
+
+	if c.MinBatchSize > c.MaxBatchSize {
+		return trace.BadParameter("usage reporter config parameter 'MinBatchSize' must not exceed 'MaxBatchSize'")
+	}
+
+	if c.MaxBatchAge == 0 {
+		c.MaxBatchAge = usageReporterMaxBatchAge
+	}
+
+	if c.MaxBufferSize == 0 {
+		c.MaxBufferSize = usageReporterMaxBufferSize
+	}
+
+	if c.SubmitDelay == 0 {
+		c.SubmitDelay = usageReporterSubmitDelay
+	}
+
+	if c.RetryAttempts == 0 {
+		c.RetryAttempts = usageReporterRetryAttempts
+	}
+
+	return nil
+}
+
 // SubmittedEvent is an event that has been submitted
 type SubmittedEvent struct {
 	// Event is the Event to attempt to send
@@ -143,6 +278,9 @@ type SubmittedEvent struct {
 	// retriesRemaining is the number of attempts to make submitting this event
 	// before it's discarded
 	retriesRemaining int
+
+	// dedupKey is the event's idempotency key, if the caller provided one.
+	dedupKey string
 }
 
 type UsageReporter struct {
@@ -155,12 +293,20 @@ type UsageReporter struct {
 	// submitClock is the clock used for the submission goroutine
 	submitClock clockwork.Clock
 
+	// anonymizerMu guards anonymizer, which may be swapped at runtime via
+	// SetAnonymizer.
+	anonymizerMu sync.RWMutex
+
 	// anonymizer is the anonymizer used for filtered audit events.
 	anonymizer utils.Anonymizer
 
 	// events receives batches of incoming events from various Teleport components
 	events chan []*SubmittedEvent
 
+	// stop receives graceful stop requests. The run loop replies with any
+	// still-buffered events and shuts down.
+	stop chan chan []*SubmittedEvent
+
 	// buf stores events for batching
 	buf []*SubmittedEvent
 
@@ -196,10 +342,58 @@ type UsageReporter struct {
 	// submit a single event.
 	retryAttempts int
 
+	// submitRetry tracks consecutive submission failures, backing off
+	// subsequent attempts so a struggling backend isn't hammered with
+	// immediate retries. Only accessed from the submission goroutine.
+	submitRetry retryutils.Retry
+
+	// deadLetterDir is the directory discarded events are persisted to, if
+	// any.
+	deadLetterDir string
+
+	// dedupWindow is how long a dedup key is remembered; duplicates seen
+	// within the window are dropped. Zero disables deduplication.
+	dedupWindow time.Duration
+
+	// dedupSeen maps recently-seen dedup keys to when they were last seen.
+	// Only accessed from the run goroutine.
+	dedupSeen map[string]time.Time
+
 	// receiveFunc is a callback for testing that's called when a batch has been
 	// received, but before it's been potentially enqueued, used to ensure sane
 	// sequencing in tests.
 	receiveFunc func()
+
+	// onSubmitSuccess, if set, is called each time a batch is submitted
+	// successfully.
+	onSubmitSuccess func(n int)
+
+	// onSubmitError, if set, is called each time a batch fails to submit.
+	onSubmitError func(n int, err error)
+
+	// onDiscard, if set, is called each time events are discarded.
+	onDiscard func(n int)
+}
+
+// notifySubmitSuccess invokes the submit success hook, if any.
+func (r *UsageReporter) notifySubmitSuccess(n int) {
+	if r.onSubmitSuccess != nil {
+		r.onSubmitSuccess(n)
+	}
+}
+
+// notifySubmitError invokes the submit error hook, if any.
+func (r *UsageReporter) notifySubmitError(n int, err error) {
+	if r.onSubmitError != nil {
+		r.onSubmitError(n, err)
+	}
+}
+
+// notifyDiscard invokes the discard hook, if any.
+func (r *UsageReporter) notifyDiscard(n int) {
+	if r.onDiscard != nil {
+		r.onDiscard(n)
+	}
 }
 
 // runSubmit starts the submission thread. It should be run as a background
@@ -210,50 +404,71 @@ func (r *UsageReporter) runSubmit(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case batch := <-r.submissionQueue:
+			usageBatchesQueued.Dec()
 			t0 := time.Now()
 
-			if failed, err := r.submit(r, batch); err != nil {
+			failed, err := r.submit(r, batch)
+			if err != nil {
 				r.WithField("batch_size", len(batch)).Warnf("failed to submit batch of usage events: %v", err)
 				usageBatchesFailed.Inc()
+				r.notifySubmitError(len(batch), err)
 
-				var resubmit []*SubmittedEvent
+				var resubmit, dropped []*SubmittedEvent
 				for _, e := range failed {
 					e.retriesRemaining--
 
 					if e.retriesRemaining > 0 {
 						resubmit = append(resubmit, e)
+					} else {
+						dropped = append(dropped, e)
 					}
 				}
 
-				droppedCount := len(failed) - len(resubmit)
-				if droppedCount > 0 {
-					r.WithField("dropped_count", droppedCount).Warnf("dropping events due to error: %+v", err)
-					usageEventsDropped.Add(float64(droppedCount))
+				if len(dropped) > 0 {
+					r.WithField("dropped_count", len(dropped)).Warnf("dropping events due to error: %+v", err)
+					usageEventsDropped.Add(float64(len(dropped)))
+					r.notifyDiscard(len(dropped))
+					r.deadLetter(dropped)
 				}
 
 				// Put the failed events back on the queue.
 				r.resubmitEvents(resubmit)
 			} else {
 				usageBatchesSubmitted.Inc()
+				r.notifySubmitSuccess(len(batch))
 
 				r.WithField("batch_size", len(batch)).Debug("successfully submitted batch of usage events")
 			}
 
 			usageBatchSubmissionDuration.Observe(time.Since(t0).Seconds())
-		}
 
-		// Always sleep a bit to avoid spamming the server. We need a secondary
-		// (possibly fake) clock here for testing to ensure
-		// FakeClock.BlockUntil() doesn't include this sleep call.
-		select {
-		case <-ctx.Done():
-			return
-		case <-r.submitClock.After(r.submitDelay):
-			continue
+			// Always sleep a bit to avoid spamming the server, backing off
+			// further while submissions are failing. We need a secondary
+			// (possibly fake) clock here for testing to ensure
+			// FakeClock.BlockUntil() doesn't include this sleep call.
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.submitClock.After(r.nextSubmitDelay(err != nil)):
+				continue
+			}
 		}
 	}
 }
 
+// nextSubmitDelay returns how long the submission goroutine should wait
+// before picking up the next batch. The delay grows with each consecutive
+// failed submission and resets once a submission succeeds.
+func (r *UsageReporter) nextSubmitDelay(failed bool) time.Duration {
+	if failed {
+		r.submitRetry.Inc()
+	} else {
+		r.submitRetry.Reset()
+	}
+
+	return r.submitDelay + r.submitRetry.Duration()
+}
+
 // enqueueBatch prepares a batch for submission, removing it from the buffer and
 // adding it to the submission queue.
 func (r *UsageReporter) enqueueBatch() {
@@ -282,6 +497,8 @@ func (r *UsageReporter) enqueueBatch() {
 		r.buf = remaining
 
 		usageBatchesTotal.Inc()
+		usageBatchesQueued.Inc()
+		usageEventsBuffered.Set(float64(len(r.buf)))
 
 		r.WithField("batch_size", len(events)).Debug("enqueued batch of usage events")
 	default:
@@ -293,6 +510,9 @@ func (r *UsageReporter) enqueueBatch() {
 
 // Run begins processing incoming usage events. It should be run in a goroutine.
 func (r *UsageReporter) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	timer := r.clock.NewTimer(r.maxBatchAge)
 
 	// Also start the submission goroutine.
@@ -304,28 +524,43 @@ func (r *UsageReporter) Run(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
+		case done := <-r.stop:
+			// Hand any still-buffered events to GracefulStop for a final
+			// submission and shut down, canceling the submission goroutine.
+			done <- r.buf
+			r.buf = nil
+			usageEventsBuffered.Set(0)
+			return
 		case <-timer.Chan():
 			// Once the timer triggers, send any non-empty batch.
 			timer.Reset(r.maxBatchAge)
 			r.enqueueBatch()
 		case events := <-r.events:
+			events = r.dedupEvents(events)
+
 			// If the buffer's already full, just warn and discard.
 			if len(r.buf) >= r.maxBufferSize {
 				r.WithField("discarded_count", len(events)).Warn("usage event buffer is full, events will be discarded")
 
 				usageEventsDropped.Add(float64(len(events)))
+				r.notifyDiscard(len(events))
+				r.deadLetter(events)
 				break
 			}
 
 			if len(r.buf)+len(events) > r.maxBufferSize {
 				keep := r.maxBufferSize - len(r.buf)
-				r.WithField("discarded_count", len(events)-keep).Warn("usage event buffer is full, events will be discarded")
+				discarded := events[keep:]
 				events = events[:keep]
+				r.WithField("discarded_count", len(discarded)).Warn("usage event buffer is full, events will be discarded")
 
-				usageEventsDropped.Add(float64(len(events) - keep))
+				usageEventsDropped.Add(float64(len(discarded)))
+				r.notifyDiscard(len(discarded))
+				r.deadLetter(discarded)
 			}
 
 			r.buf = append(r.buf, events...)
+			usageEventsBuffered.Set(float64(len(r.buf)))
 
 			// call the receiver if any
 			if r.receiveFunc != nil {
@@ -342,17 +577,53 @@ func (r *UsageReporter) Run(ctx context.Context) {
 	}
 }
 
+// SetAnonymizer swaps the anonymizer used for new events, supporting
+// anonymization key rotation without recreating the reporter. Events already
+// submitted keep the anonymization they were given; in-flight calls to
+// SubmitAnonymizedUsageEvents finish with the anonymizer they started with.
+func (r *UsageReporter) SetAnonymizer(anonymizer utils.Anonymizer) error {
+	if anonymizer == nil {
+		return trace.BadParameter("missing anonymizer")
+	}
+
+	r.anonymizerMu.Lock()
+	defer r.anonymizerMu.Unlock()
+	r.anonymizer = anonymizer
+
+	return nil
+}
+
+// getAnonymizer returns the current anonymizer. Callers should fetch it once
+// per operation so that all fields of an event are anonymized consistently.
+func (r *UsageReporter) getAnonymizer() utils.Anonymizer {
+	r.anonymizerMu.RLock()
+	defer r.anonymizerMu.RUnlock()
+	return r.anonymizer
+}
+
+// SubmitAnonymizedUsageEvents submits usage events for batching and eventual
+// submission. Events must not be anonymized by the caller; this is the one
+// place each event's Anonymize is invoked.
 func (r *UsageReporter) SubmitAnonymizedUsageEvents(events ...services.UsageAnonymizable) error {
 	var submitted []*SubmittedEvent
 
+	// Snapshot the anonymizer so every event in the call, and its cluster name
+	// field, are anonymized with the same key even if it's rotated mid-call.
+	anonymizer := r.getAnonymizer()
+
 	for _, e := range events {
-		req := e.Anonymize(r.anonymizer)
-		req.ClusterName = r.anonymizer.AnonymizeString(r.clusterName.GetClusterName())
+		req := e.Anonymize(anonymizer)
+		req.ClusterName = anonymizer.AnonymizeString(r.clusterName.GetClusterName())
 		req.Timestamp = timestamppb.New(r.clock.Now())
-		submitted = append(submitted, &SubmittedEvent{
+
+		event := &SubmittedEvent{
 			Event:            &req,
 			retriesRemaining: r.retryAttempts,
-		})
+		}
+		if d, ok := e.(services.UsageDeduplicable); ok {
+			event.dedupKey = d.DedupKey()
+		}
+		submitted = append(submitted, event)
 
 		usageEventsSubmitted.Inc()
 	}
@@ -362,12 +633,171 @@ func (r *UsageReporter) SubmitAnonymizedUsageEvents(events ...services.UsageAnon
 	return nil
 }
 
+// GracefulStop stops the reporter, submitting any events still buffered or
+// queued for submission before returning so that usage data isn't dropped on
+// normal restarts. The final submissions are bounded by the given context;
+// events still unsubmitted when it expires are lost. The run loop stops
+// accepting new events once GracefulStop has been called.
+func (r *UsageReporter) GracefulStop(ctx context.Context) error {
+	done := make(chan []*SubmittedEvent, 1)
+
+	select {
+	case r.stop <- done:
+	case <-ctx.Done():
+		return trace.Wrap(ctx.Err())
+	}
+
+	var remaining []*SubmittedEvent
+	select {
+	case remaining = <-done:
+	case <-ctx.Done():
+		return trace.Wrap(ctx.Err())
+	}
+
+	// Collect any batches that were enqueued but not yet picked up by the
+	// (now stopped) submission goroutine.
+	for {
+		select {
+		case batch := <-r.submissionQueue:
+			usageBatchesQueued.Dec()
+			remaining = append(remaining, batch...)
+			continue
+		default:
+		}
+		break
+	}
+
+	var errors []error
+	for len(remaining) > 0 {
+		if err := ctx.Err(); err != nil {
+			usageEventsDropped.Add(float64(len(remaining)))
+			r.notifyDiscard(len(remaining))
+			r.deadLetter(remaining)
+			return trace.NewAggregate(append(errors, err)...)
+		}
+
+		batch := remaining
+		if len(batch) > r.maxBatchSize {
+			batch = remaining[:r.maxBatchSize]
+		}
+		remaining = remaining[len(batch):]
+
+		if _, err := r.submit(r, batch); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	return trace.NewAggregate(errors...)
+}
+
+// dedupEvents drops events whose dedup key was already seen within the dedup
+// window, remembering the keys of the events it keeps. Events without a key
+// pass through untouched, as does everything when deduplication is disabled.
+func (r *UsageReporter) dedupEvents(events []*SubmittedEvent) []*SubmittedEvent {
+	if r.dedupWindow <= 0 {
+		return events
+	}
+
+	now := r.clock.Now()
+	kept := events[:0]
+	for _, e := range events {
+		if e.dedupKey == "" {
+			kept = append(kept, e)
+			continue
+		}
+
+		if seen, ok := r.dedupSeen[e.dedupKey]; ok && now.Sub(seen) < r.dedupWindow {
+			r.WithField("dedup_key", e.dedupKey).Debug("dropping duplicate usage event")
+			continue
+		}
+
+		r.rememberDedupKey(e.dedupKey, now)
+		kept = append(kept, e)
+	}
+
+	return kept
+}
+
+// rememberDedupKey records a dedup key, evicting old entries to keep the
+// cache bounded.
+func (r *UsageReporter) rememberDedupKey(key string, now time.Time) {
+	if len(r.dedupSeen) >= usageReporterDedupCacheSize {
+		// Evict everything outside the window first; if the cache is still
+		// full, evict the oldest entry.
+		var oldestKey string
+		var oldest time.Time
+		for k, seen := range r.dedupSeen {
+			if now.Sub(seen) >= r.dedupWindow {
+				delete(r.dedupSeen, k)
+				continue
+			}
+
+			if oldestKey == "" || seen.Before(oldest) {
+				oldestKey, oldest = k, seen
+			}
+		}
+
+		if len(r.dedupSeen) >= usageReporterDedupCacheSize && oldestKey != "" {
+			delete(r.dedupSeen, oldestKey)
+		}
+	}
+
+	r.dedupSeen[key] = now
+}
+
+// deadLetter persists discarded events to the configured dead-letter
+// directory, one JSON-encoded event per line, so they can be audited or
+// replayed later. Persistence is best effort: failures are logged, and when no
+// directory is configured the events are simply dropped.
+func (r *UsageReporter) deadLetter(events []*SubmittedEvent) {
+	if r.deadLetterDir == "" || len(events) == 0 {
+		return
+	}
+
+	path := filepath.Join(r.deadLetterDir, usageReporterDeadLetterFileName)
+
+	// Rotate the file by size, keeping a single previous file.
+	if fi, err := os.Stat(path); err == nil && fi.Size() >= usageReporterDeadLetterMaxSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			r.Warnf("failed to rotate usage event dead-letter file: %v", err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, teleport.FileMaskOwnerOnly)
+	if err != nil {
+		r.Warnf("failed to open usage event dead-letter file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	for _, event := range events {
+		line, err := protojson.Marshal(event.Event)
+		if err != nil {
+			r.Warnf("failed to encode usage event for the dead-letter file: %v", err)
+			continue
+		}
+
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			r.Warnf("failed to write to usage event dead-letter file: %v", err)
+			return
+		}
+	}
+}
+
 // resubmitEvents resubmits events that have already been processed (in case of
-// some error during submission).
+// some error during submission). The send is non-blocking: if the run loop
+// can't accept the events right away (e.g. it's busy while the buffer is
+// full), they're dropped rather than deadlocking the submission goroutine.
 func (r *UsageReporter) resubmitEvents(events []*SubmittedEvent) {
-	usageEventsRequeuedTotal.Add(float64(len(events)))
-
-	r.events <- events
+	select {
+	case r.events <- events:
+		usageEventsRequeuedTotal.Add(float64(len(events)))
+	default:
+		r.WithField("dropped_count", len(events)).Warn("unable to requeue failed usage events, events will be discarded")
+		usageEventsDropped.Add(float64(len(events)))
+		r.notifyDiscard(len(events))
+		r.deadLetter(events)
+	}
 }
 
 func NewPrehogSubmitter(ctx context.Context, prehogEndpoint string, clientCert *tls.Certificate, caCertPEM []byte) (UsageSubmitFunc, error) {
@@ -406,38 +836,80 @@ func NewPrehogSubmitter(ctx context.Context, prehogEndpoint string, clientCert *
 	}
 	httpClient.Timeout = 5 * time.Second
 
+	return newPrehogSubmitter(ctx, httpClient, prehogEndpoint), nil
+}
+
+// newPrehogSubmitter builds a submitter that reports events to the prehog
+// instance at the given endpoint using the given HTTP client. Events that
+// failed with a retryable error are returned for requeueing; events rejected
+// with a permanent error are not, since retrying them would just fail again.
+func newPrehogSubmitter(ctx context.Context, httpClient connect.HTTPClient, prehogEndpoint string) UsageSubmitFunc {
 	client := prehogclient.NewTeleportReportingServiceClient(httpClient, prehogEndpoint)
 
 	return func(reporter *UsageReporter, events []*SubmittedEvent) ([]*SubmittedEvent, error) {
 		var failed []*SubmittedEvent
 		var errors []error
 
-		// Note: the backend doesn't support batching at the moment.
+		// Note: the backend doesn't accept batched submissions, so the best we
+		// can do is submit each event in its own request and track failures
+		// individually.
 		for _, event := range events {
-			// Note: this results in retrying the entire batch, which probably
-			// isn't ideal.
 			req := connect.NewRequest(event.Event)
 			if _, err := client.SubmitEvent(ctx, req); err != nil {
+				if isPrehogRetryableError(err) {
+					failed = append(failed, event)
+				}
 				errors = append(errors, err)
 			}
 		}
 
 		return failed, trace.NewAggregate(errors...)
-	}, nil
+	}
+}
+
+// isPrehogRetryableError determines whether a submission failure is worth
+// retrying. Transport-level failures and server-side conditions that may clear
+// up on their own are retryable; errors indicating the request itself was
+// rejected are not.
+func isPrehogRetryableError(err error) bool {
+	switch connect.CodeOf(err) {
+	case connect.CodeInvalidArgument, connect.CodeNotFound, connect.CodeAlreadyExists,
+		connect.CodePermissionDenied, connect.CodeUnauthenticated,
+		connect.CodeFailedPrecondition, connect.CodeUnimplemented:
+		return false
+	default:
+		// Includes CodeUnavailable, CodeDeadlineExceeded, and CodeUnknown,
+		// which connect reports for plain transport errors.
+		return true
+	}
 }
 
 // NewUsageReporter creates a new usage reporter. `Run()` must be executed to
-// process incoming events.
-func NewUsageReporter(ctx context.Context, log logrus.FieldLogger, clusterName types.ClusterName, submitter UsageSubmitFunc) (*UsageReporter, error) {
+// process incoming events. A zero-value config selects the default batching
+// behavior.
+func NewUsageReporter(ctx context.Context, log logrus.FieldLogger, clusterName types.ClusterName, submitter UsageSubmitFunc, cfg UsageReporterConfig) (*UsageReporter, error) {
 	if log == nil {
 		log = logrus.StandardLogger()
 	}
 
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	anonymizer, err := utils.NewHMACAnonymizer(clusterName.GetClusterID())
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
+	submitRetry, err := retryutils.NewLinear(retryutils.LinearConfig{
+		Step:   usageReporterBackoffStep,
+		Max:    usageReporterBackoffMax,
+		Jitter: retryutils.NewSeventhJitter(),
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	err = metrics.RegisterPrometheusCollectors(usagePrometheusCollectors...)
 	if err != nil {
 		return nil, trace.Wrap(err)
@@ -450,16 +922,24 @@ func NewUsageReporter(ctx context.Context, log logrus.FieldLogger, clusterName t
 		),
 		anonymizer:      anonymizer,
 		events:          make(chan []*SubmittedEvent, 1),
+		stop:            make(chan chan []*SubmittedEvent),
 		submissionQueue: make(chan []*SubmittedEvent, 1),
 		submit:          submitter,
 		clock:           clockwork.NewRealClock(),
 		submitClock:     clockwork.NewRealClock(),
 		clusterName:     clusterName,
-		minBatchSize:    usageReporterMinBatchSize,
-		maxBatchSize:    usageReporterMaxBatchSize,
-		maxBatchAge:     usageReporterMaxBatchAge,
-		maxBufferSize:   usageReporterMaxBufferSize,
-		submitDelay:     usageReporterSubmitDelay,
-		retryAttempts:   usageReporterRetryAttempts,
+		minBatchSize:    cfg.MinBatchSize,
+		maxBatchSize:    cfg.MaxBatchSize,
+		maxBatchAge:     cfg.MaxBatchAge,
+		maxBufferSize:   cfg.MaxBufferSize,
+		submitDelay:     cfg.SubmitDelay,
+		retryAttempts:   cfg.RetryAttempts,
+		submitRetry:     submitRetry,
+		deadLetterDir:   cfg.DeadLetterDir,
+		dedupWindow:     cfg.DedupWindow,
+		dedupSeen:       make(map[string]time.Time),
+		onSubmitSuccess: cfg.OnSubmitSuccess,
+		onSubmitError:   cfg.OnSubmitError,
+		onDiscard:       cfg.OnDiscard,
 	}, nil
 }
@@ -19,17 +19,29 @@ package local
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bufbuild/connect-go"
 	"github.com/gravitational/trace"
 	"github.com/jonboulle/clockwork"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/gravitational/teleport"
 	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/api/utils/retryutils"
 	prehogapi "github.com/gravitational/teleport/lib/prehog/gen/prehog/v1alpha"
+	prehogclient "github.com/gravitational/teleport/lib/prehog/gen/prehog/v1alpha/prehogv1alphaconnect"
 	"github.com/gravitational/teleport/lib/services"
 	"github.com/gravitational/teleport/lib/utils"
 )
@@ -42,6 +54,10 @@ const (
 	testMaxBatchSize  = 5
 	testMaxBufferSize = 10
 	testRetryAttempts = 2
+
+	// testBackoffStep is the failure backoff step used in tests. Test retries
+	// are jitter-free so that clock advances are deterministic.
+	testBackoffStep = time.Second * 2
 )
 
 // newTestSubmitter creates a submitter that reports batches to a channel.
@@ -70,7 +86,7 @@ func newFailingSubmitter(size int) (UsageSubmitFunc, chan []*SubmittedEvent) {
 // tests.
 func newTestingUsageReporter(
 	t *testing.T, clock clockwork.FakeClock, submitClock clockwork.FakeClock,
-	submitter UsageSubmitFunc,
+	submitter UsageSubmitFunc, opts ...func(*UsageReporter),
 ) (*UsageReporter, context.CancelFunc, chan struct{}) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -87,6 +103,12 @@ func newTestingUsageReporter(
 	anonymizer, err := utils.NewHMACAnonymizer(clusterName.GetClusterID())
 	require.NoError(t, err)
 
+	submitRetry, err := retryutils.NewLinear(retryutils.LinearConfig{
+		Step: testBackoffStep,
+		Max:  usageReporterBackoffMax,
+	})
+	require.NoError(t, err)
+
 	// Make a receiver callback. We'll use this channel to coordinate event
 	// receipts, since otherwise we'll be racing the clock.
 	receiveChan := make(chan struct{})
@@ -98,6 +120,7 @@ func newTestingUsageReporter(
 		Entry:           l,
 		anonymizer:      anonymizer,
 		events:          make(chan []*SubmittedEvent, 1),
+		stop:            make(chan chan []*SubmittedEvent),
 		submissionQueue: make(chan []*SubmittedEvent, 1),
 		submit:          submitter,
 		clock:           clock,
@@ -110,6 +133,12 @@ func newTestingUsageReporter(
 		submitDelay:     usageReporterSubmitDelay,
 		receiveFunc:     receive,
 		retryAttempts:   testRetryAttempts,
+		submitRetry:     submitRetry,
+		deadLetterDir:   t.TempDir(),
+	}
+
+	for _, opt := range opts {
+		opt(reporter)
 	}
 
 	go reporter.Run(ctx)
@@ -184,6 +213,146 @@ func advanceClocks(dur time.Duration, clocks ...clockwork.FakeClock) {
 	}
 }
 
+// TestUsageReporterConfig verifies that defaults are applied to a zero-value
+// config and that overrides are respected.
+func TestUsageReporterConfig(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	clusterName, err := types.NewClusterName(types.ClusterNameSpecV2{
+		ClusterName: testClusterName,
+		ClusterID:   testClusterID,
+	})
+	require.NoError(t, err)
+
+	submitter, _ := newTestSubmitter(1)
+
+	reporter, err := NewUsageReporter(ctx, nil, clusterName, submitter, UsageReporterConfig{})
+	require.NoError(t, err)
+	require.Equal(t, usageReporterMinBatchSize, reporter.minBatchSize)
+	require.Equal(t, usageReporterMaxBatchSize, reporter.maxBatchSize)
+	require.Equal(t, usageReporterMaxBatchAge, reporter.maxBatchAge)
+	require.Equal(t, usageReporterMaxBufferSize, reporter.maxBufferSize)
+	require.Equal(t, usageReporterSubmitDelay, reporter.submitDelay)
+	require.Equal(t, usageReporterRetryAttempts, reporter.retryAttempts)
+
+	reporter, err = NewUsageReporter(ctx, nil, clusterName, submitter, UsageReporterConfig{
+		MinBatchSize:  10,
+		MaxBatchSize:  50,
+		MaxBatchAge:   time.Minute,
+		MaxBufferSize: 1000,
+		SubmitDelay:   time.Second * 2,
+		RetryAttempts: 3,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 10, reporter.minBatchSize)
+	require.Equal(t, 50, reporter.maxBatchSize)
+	require.Equal(t, time.Minute, reporter.maxBatchAge)
+	require.Equal(t, 1000, reporter.maxBufferSize)
+	require.Equal(t, time.Second*2, reporter.submitDelay)
+	require.Equal(t, 3, reporter.retryAttempts)
+
+	_, err = NewUsageReporter(ctx, nil, clusterName, submitter, UsageReporterConfig{
+		MinBatchSize: 50,
+		MaxBatchSize: 10,
+	})
+	require.True(t, trace.IsBadParameter(err))
+
+	_, err = NewUsageReporter(ctx, nil, clusterName, submitter, UsageReporterConfig{
+		MaxBatchAge: -time.Second,
+	})
+	require.True(t, trace.IsBadParameter(err))
+}
+
+// fakePrehogService records submitted events and can be configured to fail
+// submissions with a given error.
+type fakePrehogService struct {
+	prehogclient.UnimplementedTeleportReportingServiceHandler
+
+	mu        sync.Mutex
+	received  []*prehogapi.SubmitEventRequest
+	submitErr error
+}
+
+func (s *fakePrehogService) SubmitEvent(ctx context.Context, req *connect.Request[prehogapi.SubmitEventRequest]) (*connect.Response[prehogapi.SubmitEventResponse], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.submitErr != nil {
+		return nil, s.submitErr
+	}
+
+	s.received = append(s.received, req.Msg)
+	return connect.NewResponse(&prehogapi.SubmitEventResponse{}), nil
+}
+
+func (s *fakePrehogService) setSubmitErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.submitErr = err
+}
+
+func (s *fakePrehogService) receivedEvents() []*prehogapi.SubmitEventRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*prehogapi.SubmitEventRequest(nil), s.received...)
+}
+
+// TestPrehogSubmitter verifies that the prehog submitter delivers whole
+// batches and distinguishes retryable from permanent failures.
+func TestPrehogSubmitter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	service := &fakePrehogService{}
+	path, handler := prehogclient.NewTeleportReportingServiceHandler(service)
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	submitter := newPrehogSubmitter(ctx, server.Client(), server.URL)
+
+	var batch []*SubmittedEvent
+	for i := 0; i < 3; i++ {
+		batch = append(batch, &SubmittedEvent{
+			Event: &prehogapi.SubmitEventRequest{
+				ClusterName: fmt.Sprintf("cluster-%d", i),
+				Event: &prehogapi.SubmitEventRequest_SsoCreate{
+					SsoCreate: &prehogapi.SSOCreateEvent{
+						ConnectorType: types.KindGithubConnector,
+					},
+				},
+			},
+		})
+	}
+
+	// A healthy server should receive every event in the batch.
+	failed, err := submitter(nil, batch)
+	require.NoError(t, err)
+	require.Empty(t, failed)
+
+	received := service.receivedEvents()
+	require.Len(t, received, len(batch))
+	for i, event := range received {
+		require.Equal(t, batch[i].Event.ClusterName, event.ClusterName)
+	}
+
+	// Retryable failures should be returned for requeueing.
+	service.setSubmitErr(connect.NewError(connect.CodeUnavailable, trace.ConnectionProblem(nil, "server overloaded")))
+	failed, err = submitter(nil, batch)
+	require.Error(t, err)
+	require.Len(t, failed, len(batch))
+
+	// Permanent failures should not be requeued.
+	service.setSubmitErr(connect.NewError(connect.CodeInvalidArgument, trace.BadParameter("malformed event")))
+	failed, err = submitter(nil, batch)
+	require.Error(t, err)
+	require.Empty(t, failed)
+}
+
 // TestUsageReporterTimeSubmit verifies event submission due to elapsed time.
 func TestUsageReporterTimeSubmit(t *testing.T) {
 	t.Parallel()
@@ -365,6 +534,252 @@ func TestUsageReporterDiscard(t *testing.T) {
 	}
 }
 
+// TestUsageReporterSubmitBackoff verifies that submission delays grow with
+// consecutive failures and reset on success.
+func TestUsageReporterSubmitBackoff(t *testing.T) {
+	t.Parallel()
+
+	submitRetry, err := retryutils.NewLinear(retryutils.LinearConfig{
+		Step: testBackoffStep,
+		Max:  usageReporterBackoffMax,
+	})
+	require.NoError(t, err)
+
+	reporter := &UsageReporter{
+		submitDelay: usageReporterSubmitDelay,
+		submitRetry: submitRetry,
+	}
+
+	// Consecutive failures should produce strictly growing delays.
+	prev := reporter.nextSubmitDelay(true)
+	require.Greater(t, prev, usageReporterSubmitDelay)
+	for i := 0; i < 5; i++ {
+		next := reporter.nextSubmitDelay(true)
+		require.Greater(t, next, prev)
+		prev = next
+	}
+
+	// A success should reset the delay to its baseline.
+	require.Equal(t, usageReporterSubmitDelay, reporter.nextSubmitDelay(false))
+}
+
+// TestUsageReporterResubmitNonBlocking ensures that resubmission of failed
+// events can't deadlock the submission goroutine when the run loop isn't
+// accepting events, and that the events it drops are dead-lettered.
+func TestUsageReporterResubmitNonBlocking(t *testing.T) {
+	t.Parallel()
+
+	// A reporter without a running run loop, with its events channel already
+	// full, to simulate a run loop that is busy with a full buffer.
+	reporter := &UsageReporter{
+		Entry: log.WithFields(log.Fields{
+			trace.Component: teleport.Component(teleport.ComponentUsageReporting),
+		}),
+		events:        make(chan []*SubmittedEvent, 1),
+		deadLetterDir: t.TempDir(),
+	}
+	reporter.events <- []*SubmittedEvent{}
+
+	batch := []*SubmittedEvent{{
+		Event: &prehogapi.SubmitEventRequest{
+			Event: &prehogapi.SubmitEventRequest_SsoCreate{
+				SsoCreate: &prehogapi.SSOCreateEvent{ConnectorType: types.KindGithubConnector},
+			},
+		},
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		reporter.resubmitEvents(batch)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("resubmitEvents blocked on a full events channel")
+	}
+
+	// The dropped batch should have been dead-lettered.
+	data, err := os.ReadFile(filepath.Join(reporter.deadLetterDir, usageReporterDeadLetterFileName))
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 1)
+}
+
+// TestUsageReporterGracefulStop ensures buffered and queued events are
+// submitted on graceful shutdown.
+func TestUsageReporterGracefulStop(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clockwork.NewFakeClock()
+	fakeSubmitClock := clockwork.NewFakeClock()
+	submitter, batchChan := newTestSubmitter(4)
+
+	reporter, cancel, rx := newTestingUsageReporter(t, fakeClock, fakeSubmitClock, submitter)
+	defer cancel()
+
+	// Create a couple of events, not enough to trigger a size-based
+	// submission, so they stay buffered.
+	events := createDummyEvents(0, 2)
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(events...))
+	<-rx
+
+	require.NoError(t, reporter.GracefulStop(context.Background()))
+
+	// The buffered events should have been submitted on the way out.
+	select {
+	case e := <-batchChan:
+		require.Len(t, e, len(events))
+		compareUsageEvents(t, reporter, events, e)
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+}
+
+// TestUsageReporterMetrics verifies that the queue depth gauges and event
+// counters track reporter activity. Deliberately not parallel: the metrics are
+// package globals, so concurrent reporter tests would interfere with the
+// scraped values.
+func TestUsageReporterMetrics(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	fakeSubmitClock := clockwork.NewFakeClock()
+	submitter, batchChan := newTestSubmitter(2)
+
+	reporter, cancel, rx := newTestingUsageReporter(t, fakeClock, fakeSubmitClock, submitter)
+	defer cancel()
+
+	submittedBefore := testutil.ToFloat64(usageEventsSubmitted)
+
+	// Two events stay buffered, below minBatchSize.
+	events := createDummyEvents(0, 2)
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(events...))
+	<-rx
+
+	require.Equal(t, submittedBefore+2, testutil.ToFloat64(usageEventsSubmitted))
+	require.Equal(t, float64(2), testutil.ToFloat64(usageEventsBuffered))
+
+	// A third event triggers a size-based enqueue, draining the buffer.
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(createDummyEvents(2, 1)...))
+	<-rx
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(usageEventsBuffered) == 0
+	}, time.Second*5, time.Millisecond*10)
+
+	select {
+	case e := <-batchChan:
+		require.Len(t, e, 3)
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+
+	// Once the batch has been picked up, the queue gauge drops back to zero.
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(usageBatchesQueued) == 0
+	}, time.Second*5, time.Millisecond*10)
+}
+
+// countingEvent is a usage event that counts how many times it has been
+// anonymized.
+type countingEvent struct {
+	anonymizeCalls int32
+}
+
+func (c *countingEvent) Anonymize(a utils.Anonymizer) prehogapi.SubmitEventRequest {
+	atomic.AddInt32(&c.anonymizeCalls, 1)
+
+	return prehogapi.SubmitEventRequest{
+		Event: &prehogapi.SubmitEventRequest_SsoCreate{
+			SsoCreate: &prehogapi.SSOCreateEvent{ConnectorType: types.KindGithubConnector},
+		},
+	}
+}
+
+// TestUsageReporterAnonymizeOnce asserts that each submitted event is
+// anonymized exactly once, when it enters the reporter.
+func TestUsageReporterAnonymizeOnce(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clockwork.NewFakeClock()
+	fakeSubmitClock := clockwork.NewFakeClock()
+	submitter, batchChan := newTestSubmitter(2)
+
+	reporter, cancel, rx := newTestingUsageReporter(t, fakeClock, fakeSubmitClock, submitter)
+	defer cancel()
+
+	events := []*countingEvent{{}, {}, {}}
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(events[0], events[1], events[2]))
+	<-rx
+
+	// Batch submission triggers at minBatchSize.
+	select {
+	case e := <-batchChan:
+		require.Len(t, e, len(events))
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+
+	for _, event := range events {
+		require.Equal(t, int32(1), atomic.LoadInt32(&event.anonymizeCalls))
+	}
+}
+
+// TestUsageReporterDeadLetter verifies that events discarded due to buffer
+// overflow are persisted to the dead-letter file, and that the file is rotated
+// by size.
+func TestUsageReporterDeadLetter(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clockwork.NewFakeClock()
+	fakeSubmitClock := clockwork.NewFakeClock()
+	submitter, _ := newTestSubmitter(4)
+
+	reporter, cancel, rx := newTestingUsageReporter(t, fakeClock, fakeSubmitClock, submitter)
+	defer cancel()
+
+	// Overfill the buffer by two events; the overflow should land in the
+	// dead-letter file.
+	events := createDummyEvents(0, testMaxBufferSize+2)
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(events...))
+	<-rx
+
+	path := filepath.Join(reporter.deadLetterDir, usageReporterDeadLetterFileName)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	for i, line := range lines {
+		var event prehogapi.SubmitEventRequest
+		require.NoError(t, protojson.Unmarshal([]byte(line), &event))
+
+		userLogin := event.GetUserLogin()
+		require.NotNil(t, userLogin)
+		require.Equal(t, reporter.anonymizer.AnonymizeString(fmt.Sprintf("%d", testMaxBufferSize+i)), userLogin.UserName)
+	}
+
+	// A file at the size limit should be rotated before the next append.
+	require.NoError(t, os.Rename(path, path+".old"))
+	require.NoError(t, os.WriteFile(path, make([]byte, usageReporterDeadLetterMaxSize), 0600))
+
+	reporter.deadLetter([]*SubmittedEvent{{
+		Event: &prehogapi.SubmitEventRequest{
+			Event: &prehogapi.SubmitEventRequest_SsoCreate{
+				SsoCreate: &prehogapi.SSOCreateEvent{ConnectorType: types.KindGithubConnector},
+			},
+		},
+	}})
+
+	rotated, err := os.Stat(path + ".1")
+	require.NoError(t, err)
+	require.EqualValues(t, usageReporterDeadLetterMaxSize, rotated.Size())
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 1)
+}
+
 // TestUsageReporterErrorReenqueue ensures failed events are added back to the
 // queue and eventually dropped.
 func TestUsageReporterErrorReenqueue(t *testing.T) {
@@ -409,7 +824,9 @@ func TestUsageReporterErrorReenqueue(t *testing.T) {
 		require.Equal(t, testRetryAttempts-1, event.retriesRemaining)
 	}
 
-	advanceClocks(usageReporterSubmitDelay, fakeClock, fakeSubmitClock)
+	// Each consecutive failure grows the submission delay by another backoff
+	// step.
+	advanceClocks(usageReporterSubmitDelay+testBackoffStep, fakeClock, fakeSubmitClock)
 
 	// Receive the second batch.
 	select {
@@ -434,7 +851,7 @@ func TestUsageReporterErrorReenqueue(t *testing.T) {
 		require.Equal(t, testRetryAttempts-1, event.retriesRemaining)
 	}
 
-	advanceClocks(usageReporterSubmitDelay, fakeClock, fakeSubmitClock)
+	advanceClocks(usageReporterSubmitDelay+2*testBackoffStep, fakeClock, fakeSubmitClock)
 
 	// Receive the first batch again, since it was reenqueued.
 	select {
@@ -457,7 +874,7 @@ func TestUsageReporterErrorReenqueue(t *testing.T) {
 		require.Equal(t, 0, event.retriesRemaining)
 	}
 
-	advanceClocks(usageReporterSubmitDelay, fakeClock, fakeSubmitClock)
+	advanceClocks(usageReporterSubmitDelay+3*testBackoffStep, fakeClock, fakeSubmitClock)
 
 	// Receive the second batch again, since it was reenqueued.
 	select {
@@ -482,3 +899,212 @@ func TestUsageReporterErrorReenqueue(t *testing.T) {
 	// All events should have been dropped.
 	require.Empty(t, reporter.buf)
 }
+
+// TestUsageReporterHooks verifies that the optional submission lifecycle
+// callbacks fire with the correct counts on success, failure, and buffer
+// overflow.
+func TestUsageReporterHooks(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clockwork.NewFakeClock()
+	fakeSubmitClock := clockwork.NewFakeClock()
+	submitter, batchChan := newTestSubmitter(2)
+
+	successChan := make(chan int, 4)
+	discardChan := make(chan int, 4)
+
+	reporter, cancel, rx := newTestingUsageReporter(t, fakeClock, fakeSubmitClock, submitter,
+		func(r *UsageReporter) {
+			r.onSubmitSuccess = func(n int) { successChan <- n }
+			r.onDiscard = func(n int) { discardChan <- n }
+		})
+	defer cancel()
+
+	// Create enough events to overflow the buffer; the overflow should be
+	// reported to the discard hook.
+	events := createDummyEvents(0, testMaxBufferSize+2)
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(events...))
+	<-rx
+
+	select {
+	case n := <-discardChan:
+		require.Equal(t, 2, n)
+	case <-time.After(time.Second):
+		t.Fatalf("Discard hook did not fire.")
+	}
+
+	// The first batch is submitted successfully and reported to the success
+	// hook with its size.
+	select {
+	case e := <-batchChan:
+		require.Len(t, e, testMaxBatchSize)
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+
+	select {
+	case n := <-successChan:
+		require.Equal(t, testMaxBatchSize, n)
+	case <-time.After(time.Second):
+		t.Fatalf("Success hook did not fire.")
+	}
+
+	// Now verify the error hook with a submitter that always fails.
+	failingClock := clockwork.NewFakeClock()
+	failingSubmitClock := clockwork.NewFakeClock()
+	failingSubmitter, failedBatchChan := newFailingSubmitter(2)
+
+	type submitFailure struct {
+		n   int
+		err error
+	}
+	errorChan := make(chan submitFailure, 4)
+
+	failingReporter, failingCancel, failingRx := newTestingUsageReporter(
+		t, failingClock, failingSubmitClock, failingSubmitter,
+		func(r *UsageReporter) {
+			r.onSubmitError = func(n int, err error) { errorChan <- submitFailure{n: n, err: err} }
+		})
+	defer failingCancel()
+
+	events = createDummyEvents(0, testMaxBatchSize)
+	require.NoError(t, failingReporter.SubmitAnonymizedUsageEvents(events...))
+	<-failingRx
+
+	select {
+	case e := <-failedBatchChan:
+		require.Len(t, e, testMaxBatchSize)
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+
+	select {
+	case failure := <-errorChan:
+		require.Equal(t, testMaxBatchSize, failure.n)
+		require.Error(t, failure.err)
+	case <-time.After(time.Second):
+		t.Fatalf("Error hook did not fire.")
+	}
+}
+
+// TestUsageReporterAnonymizerRotation verifies that the anonymizer can be
+// swapped at runtime and that events submitted before and after the swap are
+// anonymized with the respective keys.
+func TestUsageReporterAnonymizerRotation(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clockwork.NewFakeClock()
+	fakeSubmitClock := clockwork.NewFakeClock()
+	submitter, batchChan := newTestSubmitter(2)
+
+	reporter, cancel, rx := newTestingUsageReporter(t, fakeClock, fakeSubmitClock, submitter)
+	defer cancel()
+
+	oldAnonymizer := reporter.getAnonymizer()
+
+	// Submit a batch with the original anonymizer.
+	events := createDummyEvents(0, testMinBatchSize)
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(events...))
+	<-rx
+
+	select {
+	case e := <-batchChan:
+		require.Len(t, e, testMinBatchSize)
+		require.Equal(t, oldAnonymizer.AnonymizeString("0"), e[0].Event.GetUserLogin().UserName)
+		require.Equal(t, oldAnonymizer.AnonymizeString(testClusterName), e[0].Event.ClusterName)
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+
+	// Rotate the anonymization key. A nil anonymizer must be refused.
+	require.Error(t, reporter.SetAnonymizer(nil))
+
+	newAnonymizer, err := utils.NewHMACAnonymizer("rotated-key")
+	require.NoError(t, err)
+	require.NoError(t, reporter.SetAnonymizer(newAnonymizer))
+
+	// Events submitted after the rotation use the new key, including for the
+	// cluster name field.
+	events = createDummyEvents(testMinBatchSize, testMinBatchSize)
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(events...))
+	<-rx
+
+	// Wait out the submission delay before the second batch.
+	fakeSubmitClock.BlockUntil(1)
+	fakeClock.BlockUntil(1)
+	advanceClocks(usageReporterSubmitDelay, fakeClock, fakeSubmitClock)
+
+	select {
+	case e := <-batchChan:
+		require.Len(t, e, testMinBatchSize)
+		require.Equal(t, newAnonymizer.AnonymizeString(fmt.Sprintf("%d", testMinBatchSize)), e[0].Event.GetUserLogin().UserName)
+		require.Equal(t, newAnonymizer.AnonymizeString(testClusterName), e[0].Event.ClusterName)
+		require.NotEqual(t, oldAnonymizer.AnonymizeString(testClusterName), e[0].Event.ClusterName)
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+}
+
+// TestUsageReporterDedup verifies that events carrying the same idempotency
+// key are deduplicated within the configured window, and accepted again once
+// the window has passed.
+func TestUsageReporterDedup(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clockwork.NewFakeClock()
+	fakeSubmitClock := clockwork.NewFakeClock()
+	submitter, batchChan := newTestSubmitter(2)
+
+	const dedupWindow = time.Minute
+
+	reporter, cancel, rx := newTestingUsageReporter(t, fakeClock, fakeSubmitClock, submitter, func(r *UsageReporter) {
+		r.dedupWindow = dedupWindow
+		r.dedupSeen = make(map[string]time.Time)
+	})
+	defer cancel()
+
+	event := func() services.UsageAnonymizable {
+		return &services.UsageEventWithDedupKey{
+			UsageAnonymizable: &services.UsageSSOCreate{ConnectorType: types.KindGithubConnector},
+			Key:               "sso-create-1",
+		}
+	}
+
+	// Submit the same event twice within the window; the duplicate should be
+	// dropped before it enters the buffer.
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(event()))
+	<-rx
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(event()))
+	<-rx
+
+	fakeClock.BlockUntil(1)
+	advanceClocks(2*usageReporterMaxBatchAge, fakeClock, fakeSubmitClock)
+	fakeSubmitClock.BlockUntil(1)
+
+	select {
+	case e := <-batchChan:
+		require.Len(t, e, 1)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+
+	// Once the window has passed, the same key should be accepted again.
+	fakeClock.BlockUntil(1)
+	advanceClocks(dedupWindow, fakeClock, fakeSubmitClock)
+
+	require.NoError(t, reporter.SubmitAnonymizedUsageEvents(event()))
+	<-rx
+
+	fakeClock.BlockUntil(1)
+	advanceClocks(2*usageReporterMaxBatchAge, fakeClock, fakeSubmitClock)
+
+	// Note: no BlockUntil on the submit clock here; the advance above may
+	// consume the submission goroutine's existing sleeper, and with no further
+	// batches coming a BlockUntil would never return.
+	select {
+	case e := <-batchChan:
+		require.Len(t, e, 1)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Did not receive expected events.")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/gravitational/trace"
 
 	usageevents "github.com/gravitational/teleport/api/gen/proto/go/usageevents/v1"
+	"github.com/gravitational/teleport/api/types"
 	prehogv1 "github.com/gravitational/teleport/lib/prehog/gen/prehog/v1alpha"
 	"github.com/gravitational/teleport/lib/utils"
 )
@@ -33,11 +34,37 @@ type UsageAnonymizable interface {
 
 // UsageReporter is a service that accepts Teleport usage events.
 type UsageReporter interface {
-	// SubmitAnonymizedUsageEvent submits a usage event. The payload will be
-	// anonymized by the reporter implementation.
+	// SubmitAnonymizedUsageEvent submits a usage event. Callers must pass
+	// non-anonymized events: the payload is anonymized exactly once, by the
+	// reporter implementation, and anonymizing it beforehand would cause
+	// identifying fields to be hashed twice.
 	SubmitAnonymizedUsageEvents(event ...UsageAnonymizable) error
 }
 
+// UsageDeduplicable is an optional interface implemented by usage events that
+// carry a caller-provided idempotency key. Reporters may use the key to drop
+// duplicate submissions of the same underlying event.
+type UsageDeduplicable interface {
+	// DedupKey returns the event's idempotency key. An empty key disables
+	// deduplication for the event.
+	DedupKey() string
+}
+
+// UsageEventWithDedupKey wraps a usage event with a caller-provided
+// idempotency key so that retried submissions of the same event can be
+// deduplicated by the reporter.
+type UsageEventWithDedupKey struct {
+	UsageAnonymizable
+
+	// Key is the event's idempotency key.
+	Key string
+}
+
+// DedupKey implements UsageDeduplicable.
+func (u *UsageEventWithDedupKey) DedupKey() string {
+	return u.Key
+}
+
 // UsageUserLogin is an event emitted when a user logs into Teleport,
 // potentially via SSO.
 type UsageUserLogin prehogv1.UserLoginEvent
@@ -81,6 +108,82 @@ func (u *UsageSessionStart) Anonymize(a utils.Anonymizer) prehogv1.SubmitEventRe
 	}
 }
 
+// UsageKubeSessionStart is an event emitted when a Kubernetes session has
+// started. It maps onto the generic session start event with the session type
+// fixed to kubernetes.
+type UsageKubeSessionStart struct {
+	// UserName is the name of the user that started the session.
+	UserName string
+}
+
+func (u *UsageKubeSessionStart) Anonymize(a utils.Anonymizer) prehogv1.SubmitEventRequest {
+	return prehogv1.SubmitEventRequest{
+		Event: &prehogv1.SubmitEventRequest_SessionStart{
+			SessionStart: &prehogv1.SessionStartEvent{
+				UserName:    a.AnonymizeString(u.UserName),
+				SessionType: string(types.KubernetesSessionKind),
+			},
+		},
+	}
+}
+
+// UsageDatabaseSessionStart is an event emitted when a database session has
+// started. It maps onto the generic session start event with the session type
+// fixed to database.
+type UsageDatabaseSessionStart struct {
+	// UserName is the name of the user that started the session.
+	UserName string
+}
+
+func (u *UsageDatabaseSessionStart) Anonymize(a utils.Anonymizer) prehogv1.SubmitEventRequest {
+	return prehogv1.SubmitEventRequest{
+		Event: &prehogv1.SubmitEventRequest_SessionStart{
+			SessionStart: &prehogv1.SessionStartEvent{
+				UserName:    a.AnonymizeString(u.UserName),
+				SessionType: string(types.DatabaseSessionKind),
+			},
+		},
+	}
+}
+
+// UsageAppSessionStart is an event emitted when an application session has
+// started. It maps onto the generic session start event with the session type
+// fixed to app.
+type UsageAppSessionStart struct {
+	// UserName is the name of the user that started the session.
+	UserName string
+}
+
+func (u *UsageAppSessionStart) Anonymize(a utils.Anonymizer) prehogv1.SubmitEventRequest {
+	return prehogv1.SubmitEventRequest{
+		Event: &prehogv1.SubmitEventRequest_SessionStart{
+			SessionStart: &prehogv1.SessionStartEvent{
+				UserName:    a.AnonymizeString(u.UserName),
+				SessionType: string(types.AppSessionKind),
+			},
+		},
+	}
+}
+
+// UsageWindowsDesktopSessionStart is an event emitted when a Windows desktop
+// session has started. It maps onto the generic session start event with the
+// session type fixed to desktop.
+type UsageWindowsDesktopSessionStart struct {
+	// UserName is the name of the user that started the session.
+	UserName string
+}
+
+func (u *UsageWindowsDesktopSessionStart) Anonymize(a utils.Anonymizer) prehogv1.SubmitEventRequest {
+	return prehogv1.SubmitEventRequest{
+		Event: &prehogv1.SubmitEventRequest_SessionStart{
+			SessionStart: &prehogv1.SessionStartEvent{
+				UserName:    a.AnonymizeString(u.UserName),
+				SessionType: string(types.WindowsDesktopSessionKind),
+			},
+		},
+	}
+}
+
 // UsageResourceCreate is an event emitted when various resource types have been
 // created.
 type UsageResourceCreate prehogv1.ResourceCreateEvent
@@ -19,9 +19,13 @@ package cassandra
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/datastax/go-cassandra-native-protocol/client"
@@ -42,7 +46,9 @@ type Session = gocql.Session
 
 // ClientOptionsParams is a struct for client configuration options.
 type ClientOptionsParams struct {
-	Username string
+	Username        string
+	Password        string
+	ProtocolVersion primitive.ProtocolVersion
 }
 
 // ClientOptions allows setting test client options.
@@ -55,6 +61,20 @@ func WithCassandraUsername(username string) ClientOptions {
 	}
 }
 
+// WithCassandraPassword set the password used during cassandra login.
+func WithCassandraPassword(password string) ClientOptions {
+	return func(params *ClientOptionsParams) {
+		params.Password = password
+	}
+}
+
+// WithProtocolVersion sets the native protocol version used by the client.
+func WithProtocolVersion(version primitive.ProtocolVersion) ClientOptions {
+	return func(params *ClientOptionsParams) {
+		params.ProtocolVersion = version
+	}
+}
+
 // MakeTestClient returns Cassandra client connection according to the provided
 // parameters.
 func MakeTestClient(_ context.Context, config common.TestClientConfig, opts ...ClientOptions) (*Session, error) {
@@ -62,7 +82,11 @@ func MakeTestClient(_ context.Context, config common.TestClientConfig, opts ...C
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
-	clientOptions := &ClientOptionsParams{}
+	clientOptions := &ClientOptionsParams{
+		Username:        "cassandra",
+		Password:        "cassandra",
+		ProtocolVersion: primitive.ProtocolVersion4,
+	}
 	for _, opt := range opts {
 		opt(clientOptions)
 	}
@@ -74,10 +98,10 @@ func MakeTestClient(_ context.Context, config common.TestClientConfig, opts ...C
 	cluster.DisableInitialHostLookup = true
 	cluster.ConnectTimeout = 5 * time.Second
 	cluster.Timeout = 5 * time.Second
-	cluster.ProtoVersion = 4
+	cluster.ProtoVersion = int(clientOptions.ProtocolVersion)
 	cluster.Authenticator = gocql.PasswordAuthenticator{
-		Username: "cassandra",
-		Password: "cassandra",
+		Username: clientOptions.Username,
+		Password: clientOptions.Password,
 	}
 	session, err := cluster.CreateSession()
 	if err != nil {
@@ -96,49 +120,85 @@ type TestServer struct {
 	tlsConfig *tls.Config
 	log       logrus.FieldLogger
 	server    *client.CqlServer
+
+	// authError, when set, makes the server reject every authentication
+	// attempt with this message.
+	authError string
+	// responseDelay, when set, is how long the server sleeps before
+	// responding to each request past the handshake.
+	responseDelay time.Duration
+
+	// mu guards the query and event registries.
+	mu sync.RWMutex
+	// queryResults maps normalized query strings to the rows returned for
+	// them, both for plain queries and prepared statements.
+	queryResults map[string]message.RowSet
+	// eventRegistrations tracks connections that registered for server-side
+	// events and the protocol version they registered with.
+	eventRegistrations map[*client.CqlServerConnection]eventRegistration
+	// queryErrors maps normalized query strings to errors injected for them.
+	queryErrors map[string]message.Error
+	// clientCert is the leaf certificate presented by the most recent
+	// client that passed certificate verification.
+	clientCert *x509.Certificate
 }
 
-// NewTestServer returns a new instance of a test Snowflake server.
-func NewTestServer(config common.TestServerConfig, opts ...TestServerOption) (*TestServer, error) {
-	address := "localhost:0"
-	tlsConfig, err := common.MakeTestServerTLSConfig(config)
-	if err != nil {
-		return nil, trace.Wrap(err)
+// eventRegistration records which event types a connection registered for.
+type eventRegistration struct {
+	version primitive.ProtocolVersion
+	types   map[primitive.EventType]struct{}
+}
+
+// WithAuthError makes the test server reject every authentication attempt
+// with the provided message.
+func WithAuthError(message string) TestServerOption {
+	return func(ts *TestServer) {
+		ts.authError = message
 	}
+}
 
-	server := client.NewCqlServer(address, &client.AuthCredentials{
-		Password: "cassandra",
-		Username: "cassandra",
-	})
-	if config.Listener != nil {
-		server.Listener = tls.NewListener(config.Listener, tlsConfig)
+// WithResponseDelay makes the test server sleep for the given duration before
+// responding to each request past the handshake.
+func WithResponseDelay(delay time.Duration) TestServerOption {
+	return func(ts *TestServer) {
+		ts.responseDelay = delay
+	}
+}
+
+// WithQueryError makes the test server respond to the given query with the
+// provided error.
+func WithQueryError(query string, err message.Error) TestServerOption {
+	return func(ts *TestServer) {
+		ts.queryErrors[normalizeQuery(query)] = err
 	}
+}
 
-	server.RequestHandlers = []client.RequestHandler{
-		client.HandshakeHandler,
-		handleMessageOption,
-		handleMessageQuery,
-		handleMessagePrepare,
-		handleMessageExecute,
-		handleMessageBatch,
-		handleMessageRegister,
+// NewTestServer returns a new instance of a test Snowflake server.
+func NewTestServer(config common.TestServerConfig, opts ...TestServerOption) (svr *TestServer, err error) {
+	if err := config.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
 	}
+	defer config.CloseOnError(&err)
 
-	server.TLSConfig = tlsConfig
-	if err := server.Start(context.Background()); err != nil {
+	tlsConfig, err := common.MakeTestServerTLSConfig(config)
+	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	// Resolve the bound port from our own listener up front instead of
+	// reaching into the server internals after start.
+	_, port, err := net.SplitHostPort(config.Listener.Addr().String())
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
 	testServer := &TestServer{
-		cfg:       config,
-		port:      port,
-		tlsConfig: tlsConfig,
-		server:    server,
+		cfg:                config,
+		port:               port,
+		tlsConfig:          tlsConfig,
+		queryResults:       make(map[string]message.RowSet),
+		eventRegistrations: make(map[*client.CqlServerConnection]eventRegistration),
+		queryErrors:        make(map[string]message.Error),
 		log: logrus.WithFields(logrus.Fields{
 			trace.Component: defaults.ProtocolCassandra,
 			"name":          config.Name,
@@ -147,9 +207,98 @@ func NewTestServer(config common.TestServerConfig, opts ...TestServerOption) (*T
 	for _, opt := range opts {
 		opt(testServer)
 	}
+
+	// Record the identity of clients that pass certificate verification so
+	// tests can assert on it.
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+			return nil
+		}
+		testServer.setClientCertificate(verifiedChains[0][0])
+		return nil
+	}
+
+	server := client.NewCqlServer(config.Listener.Addr().String(), &client.AuthCredentials{
+		Password: "cassandra",
+		Username: "cassandra",
+	})
+	server.Listener = tls.NewListener(config.Listener, tlsConfig)
+
+	server.RequestHandlers = []client.RequestHandler{
+		testServer.handshakeHandler(),
+		testServer.wrapHandler(handleMessageOption),
+		testServer.wrapHandler(testServer.handleMessageQuery),
+		testServer.wrapHandler(testServer.handleMessagePrepare),
+		testServer.wrapHandler(testServer.handleMessageExecute),
+		testServer.wrapHandler(handleMessageBatch),
+		testServer.wrapHandler(testServer.handleMessageRegister),
+	}
+
+	server.TLSConfig = tlsConfig
+	if err := server.Start(context.Background()); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	testServer.server = server
+
 	return testServer, nil
 }
 
+// wrapHandler applies the configured response delay and query error
+// injection before delegating to the handler.
+func (s *TestServer) wrapHandler(handler client.RequestHandler) client.RequestHandler {
+	return func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+		if s.responseDelay > 0 {
+			time.Sleep(s.responseDelay)
+		}
+		if queryErr := s.injectedQueryError(request); queryErr != nil {
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, queryErr)
+		}
+		return handler(request, conn, ctx)
+	}
+}
+
+// injectedQueryError returns the error injected for the request's query, if
+// any.
+func (s *TestServer) injectedQueryError(request *frame.Frame) message.Error {
+	var query string
+	switch msg := request.Body.Message.(type) {
+	case *message.Query:
+		query = msg.Query
+	case *message.Prepare:
+		query = msg.Query
+	default:
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.queryErrors[normalizeQuery(query)]
+}
+
+// handshakeHandler returns the handler used for the server-side handshake.
+// By default it delegates to the library handler that validates credentials;
+// when an auth error is injected, every authentication attempt is rejected
+// with the configured message.
+func (s *TestServer) handshakeHandler() client.RequestHandler {
+	return func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+		if s.authError == "" {
+			return client.HandshakeHandler(request, conn, ctx)
+		}
+		version := request.Header.Version
+		id := request.Header.StreamId
+		switch request.Body.Message.(type) {
+		case *message.Options:
+			return frame.NewFrame(version, id, &message.Supported{})
+		case *message.Startup:
+			return frame.NewFrame(version, id, &message.Authenticate{
+				Authenticator: "org.apache.cassandra.auth.PasswordAuthenticator",
+			})
+		case *message.AuthResponse:
+			return frame.NewFrame(version, id, &message.AuthenticationError{ErrorMessage: s.authError})
+		}
+		return nil
+	}
+}
+
 // Serve starts serving client connections.
 func (s *TestServer) Serve() error {
 	return s.server.Start(context.Background())
@@ -164,6 +313,129 @@ func (s *TestServer) Port() string {
 	return s.port
 }
 
+// ClientCertificate returns the leaf certificate presented by the most
+// recent client that passed certificate verification, or nil if none did.
+func (s *TestServer) ClientCertificate() *x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientCert
+}
+
+func (s *TestServer) setClientCertificate(cert *x509.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientCert = cert
+}
+
+// RegisterQueryHandler registers rows to return for the provided query, both
+// when it's sent as a plain query and when it's prepared and executed. Rows
+// are returned as varchar columns. Built-in queries keep working unless
+// overridden.
+func (s *TestServer) RegisterQueryHandler(query string, rows message.RowSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queryResults[normalizeQuery(query)] = rows
+}
+
+// registeredRows returns the rows registered for the query, if any.
+func (s *TestServer) registeredRows(query string) (message.RowSet, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rows, ok := s.queryResults[normalizeQuery(query)]
+	return rows, ok
+}
+
+func normalizeQuery(query string) string {
+	return strings.TrimSpace(strings.ToLower(query))
+}
+
+// preparedQueryID returns a deterministic prepared statement ID for a
+// registered query.
+func preparedQueryID(query string) []byte {
+	sum := sha256.Sum256([]byte(normalizeQuery(query)))
+	return sum[:16]
+}
+
+// rowsMetadata builds generic varchar column metadata for registered rows.
+func rowsMetadata(rows message.RowSet) *message.RowsMetadata {
+	columnCount := 0
+	if len(rows) > 0 {
+		columnCount = len(rows[0])
+	}
+	columns := make([]*message.ColumnMetadata, 0, columnCount)
+	for i := 0; i < columnCount; i++ {
+		columns = append(columns, &message.ColumnMetadata{
+			Keyspace: "test",
+			Table:    "test",
+			Name:     fmt.Sprintf("col%d", i),
+			Index:    int32(i),
+			Type:     datatype.Varchar,
+		})
+	}
+	return &message.RowsMetadata{
+		ColumnCount: int32(columnCount),
+		Columns:     columns,
+	}
+}
+
+// handleMessageQuery serves registered queries and falls back to the
+// built-in ones.
+func (s *TestServer) handleMessageQuery(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+	if msg, ok := request.Body.Message.(*message.Query); ok {
+		if rows, ok := s.registeredRows(msg.Query); ok {
+			return frame.NewFrame(
+				request.Header.Version,
+				request.Header.StreamId,
+				&message.RowsResult{
+					Metadata: rowsMetadata(rows),
+					Data:     rows,
+				},
+			)
+		}
+	}
+	return handleMessageQuery(request, conn, ctx)
+}
+
+// handleMessagePrepare serves prepares of registered queries and falls back
+// to the built-in ones.
+func (s *TestServer) handleMessagePrepare(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+	if msg, ok := request.Body.Message.(*message.Prepare); ok {
+		if rows, ok := s.registeredRows(msg.Query); ok {
+			return frame.NewFrame(
+				request.Header.Version,
+				request.Header.StreamId,
+				&message.PreparedResult{
+					PreparedQueryId: preparedQueryID(msg.Query),
+					ResultMetadata:  rowsMetadata(rows),
+				},
+			)
+		}
+	}
+	return handleMessagePrepare(request, conn, ctx)
+}
+
+// handleMessageExecute serves executions of registered prepared statements
+// and falls back to the built-in ones.
+func (s *TestServer) handleMessageExecute(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+	if msg, ok := request.Body.Message.(*message.Execute); ok {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		for query, rows := range s.queryResults {
+			if bytes.Equal(msg.QueryId, preparedQueryID(query)) {
+				return frame.NewFrame(
+					request.Header.Version,
+					request.Header.StreamId,
+					&message.RowsResult{
+						Metadata: rowsMetadata(rows),
+						Data:     rows,
+					},
+				)
+			}
+		}
+	}
+	return handleMessageExecute(request, conn, ctx)
+}
+
 func handleMessageQuery(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
 	switch msg := request.Body.Message.(type) {
 	case *message.Query:
@@ -304,9 +576,24 @@ func handleMessageExecute(request *frame.Frame, conn *client.CqlServerConnection
 	return nil
 }
 
-func handleMessageRegister(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
-	switch request.Body.Message.(type) {
+// handleMessageRegister acknowledges REGISTER requests and records the
+// registration so events can be pushed to the connection later.
+func (s *TestServer) handleMessageRegister(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+	switch msg := request.Body.Message.(type) {
 	case *message.Register:
+		s.mu.Lock()
+		reg, ok := s.eventRegistrations[conn]
+		if !ok {
+			reg = eventRegistration{
+				version: request.Header.Version,
+				types:   make(map[primitive.EventType]struct{}),
+			}
+			s.eventRegistrations[conn] = reg
+		}
+		for _, eventType := range msg.EventTypes {
+			reg.types[eventType] = struct{}{}
+		}
+		s.mu.Unlock()
 		return frame.NewFrame(
 			request.Header.Version,
 			request.Header.StreamId,
@@ -317,10 +604,39 @@ func handleMessageRegister(request *frame.Frame, conn *client.CqlServerConnectio
 	}
 }
 
+// PushEvent sends the event to all connections that registered for its event
+// type. Connections that can no longer be written to are dropped from the
+// registry.
+func (s *TestServer) PushEvent(ev message.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for conn, reg := range s.eventRegistrations {
+		if _, ok := reg.types[ev.GetEventType()]; !ok {
+			continue
+		}
+		// Event frames are sent with stream ID -1.
+		if err := conn.Send(frame.NewFrame(reg.version, -1, ev)); err != nil {
+			delete(s.eventRegistrations, conn)
+			errs = append(errs, trace.Wrap(err))
+		}
+	}
+	return trace.NewAggregate(errs...)
+}
+
 func handleMessageBatch(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
 	codec := frame.NewRawCodec()
 	switch request.Body.Message.(type) {
 	case *message.Batch:
+		if request.Header.Version.SupportsModernFramingLayout() {
+			// Protocol v5 and later wrap frames in the modern framing layout,
+			// so let the frame codec take care of the body encoding.
+			return frame.NewFrame(
+				request.Header.Version,
+				request.Header.StreamId,
+				&message.VoidResult{},
+			)
+		}
 		resp := &frame.RawFrame{
 			Header: &frame.Header{
 				IsResponse: true,
@@ -23,6 +23,7 @@ import (
 	"testing"
 	"time"
 
+	cqlclient "github.com/datastax/go-cassandra-native-protocol/client"
 	"github.com/datastax/go-cassandra-native-protocol/frame"
 	"github.com/datastax/go-cassandra-native-protocol/message"
 	"github.com/datastax/go-cassandra-native-protocol/primitive"
@@ -35,6 +36,7 @@ import (
 	libevents "github.com/gravitational/teleport/lib/events"
 	"github.com/gravitational/teleport/lib/srv/db/cassandra"
 	"github.com/gravitational/teleport/lib/srv/db/common"
+	"github.com/gravitational/teleport/lib/tlsca"
 )
 
 func TestAccessCassandra(t *testing.T) {
@@ -130,6 +132,20 @@ func TestAccessCassandra(t *testing.T) {
 	}
 }
 
+// TestCassandraServerPort verifies that the test server reports the port its
+// listener is actually bound to.
+func TestCassandraServerPort(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCtx := setupTestContext(ctx, t, withCassandra("cassandra"))
+	go testCtx.startHandlingConnections()
+
+	server := testCtx.cassandra["cassandra"].db
+	conn, err := net.Dial("tcp", net.JoinHostPort("localhost", server.Port()))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+}
+
 func TestAccessCassandraHandshake(t *testing.T) {
 	t.Parallel()
 
@@ -194,6 +210,346 @@ func TestAccessCassandraHandshake(t *testing.T) {
 	}
 }
 
+// TestCassandraClientCertAuth verifies that the test server rejects
+// connections without a valid client certificate when client certificate
+// validation is required, and records the presented identity.
+func TestCassandraClientCertAuth(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCtx := setupTestContext(ctx, t, withCassandra("cassandra"))
+	go testCtx.startHandlingConnections()
+
+	cassandraServer, err := cassandra.NewTestServer(common.TestServerConfig{
+		Name:       "cassandra-mtls",
+		AuthClient: testCtx.authClient,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	})
+	require.NoError(t, err)
+	go cassandraServer.Serve()
+	t.Cleanup(func() { cassandraServer.Close() })
+
+	// The server verifies clients against the database CA, so borrow a
+	// database CA-issued certificate for the client side.
+	dbCertConfig, err := common.MakeTestServerTLSConfig(common.TestServerConfig{
+		AuthClient: testCtx.authClient,
+		CN:         "db-client",
+	})
+	require.NoError(t, err)
+
+	connect := func(t *testing.T, tlsConfig *tls.Config) error {
+		cc := cqlclient.NewCqlClient(net.JoinHostPort("localhost", cassandraServer.Port()), &cqlclient.AuthCredentials{
+			Username: "cassandra",
+			Password: "cassandra",
+		})
+		cc.TLSConfig = tlsConfig
+		conn, err := cc.ConnectAndInit(ctx, primitive.ProtocolVersion4, 0)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	t.Run("with client cert", func(t *testing.T) {
+		err := connect(t, &tls.Config{
+			Certificates:       dbCertConfig.Certificates,
+			InsecureSkipVerify: true,
+		})
+		require.NoError(t, err)
+
+		clientCert := cassandraServer.ClientCertificate()
+		require.NotNil(t, clientCert)
+		require.Equal(t, "db-client", clientCert.Subject.CommonName)
+	})
+
+	t.Run("without client cert", func(t *testing.T) {
+		err := connect(t, &tls.Config{
+			InsecureSkipVerify: true,
+		})
+		require.Error(t, err)
+	})
+}
+
+// TestCassandraInjection verifies the latency and error injection hooks on
+// the test server.
+func TestCassandraInjection(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCtx := setupTestContext(ctx, t, withCassandra("cassandra"))
+	go testCtx.startHandlingConnections()
+
+	testCtx.createUserAndRole(ctx, t, "alice", "admin", []string{"cassandra"}, []string{types.Wildcard})
+
+	// Servers don't require client certificates so the raw client can connect
+	// to them directly.
+	newServer := func(t *testing.T, name string, opts ...cassandra.TestServerOption) *cassandra.TestServer {
+		server, err := cassandra.NewTestServer(common.TestServerConfig{
+			Name:       name,
+			AuthClient: testCtx.authClient,
+		}, opts...)
+		require.NoError(t, err)
+		go server.Serve()
+		t.Cleanup(func() { server.Close() })
+		return server
+	}
+
+	connect := func(t *testing.T, server *cassandra.TestServer, readTimeout time.Duration) *cqlclient.CqlClientConnection {
+		tlsConfig, err := common.MakeTestClientTLSConfig(common.TestClientConfig{
+			AuthClient: testCtx.authClient,
+			AuthServer: testCtx.authServer,
+			Address:    net.JoinHostPort("localhost", server.Port()),
+			Cluster:    testCtx.clusterName,
+			Username:   "alice",
+			RouteToDatabase: tlsca.RouteToDatabase{
+				ServiceName: "cassandra",
+				Protocol:    defaults.ProtocolCassandra,
+				Username:    "cassandra",
+			},
+		})
+		require.NoError(t, err)
+
+		cc := cqlclient.NewCqlClient(net.JoinHostPort("localhost", server.Port()), &cqlclient.AuthCredentials{
+			Username: "cassandra",
+			Password: "cassandra",
+		})
+		cc.TLSConfig = tlsConfig
+		cc.ReadTimeout = readTimeout
+
+		conn, err := cc.ConnectAndInit(ctx, primitive.ProtocolVersion4, 0)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	t.Run("delayed response trips a short client timeout", func(t *testing.T) {
+		server := newServer(t, "cassandra-delay", cassandra.WithResponseDelay(2*time.Second))
+		conn := connect(t, server, 500*time.Millisecond)
+
+		_, err := conn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 1, &message.Query{
+			Query: "select * from system.local where key='local'",
+		}))
+		require.Error(t, err)
+	})
+
+	t.Run("injected error surfaces to the client", func(t *testing.T) {
+		server := newServer(t, "cassandra-error", cassandra.WithQueryError(
+			"SELECT * FROM failing.table",
+			&message.ServerError{ErrorMessage: "injected server error"},
+		))
+		conn := connect(t, server, 5*time.Second)
+
+		resp, err := conn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 1, &message.Query{
+			Query: "SELECT * FROM failing.table",
+		}))
+		require.NoError(t, err)
+		serverErr, ok := resp.Body.Message.(*message.ServerError)
+		require.True(t, ok)
+		require.Equal(t, "injected server error", serverErr.ErrorMessage)
+	})
+}
+
+// TestCassandraPushEvent verifies that the test server pushes events to
+// connections that registered for their event type.
+func TestCassandraPushEvent(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCtx := setupTestContext(ctx, t, withCassandra("cassandra"))
+	go testCtx.startHandlingConnections()
+
+	testCtx.createUserAndRole(ctx, t, "alice", "admin", []string{"cassandra"}, []string{types.Wildcard})
+
+	// Start a separate server that doesn't require client certificates so the
+	// raw client can connect to it directly.
+	cassandraServer, err := cassandra.NewTestServer(common.TestServerConfig{
+		Name:       "cassandra-events",
+		AuthClient: testCtx.authClient,
+	})
+	require.NoError(t, err)
+	go cassandraServer.Serve()
+	t.Cleanup(func() { cassandraServer.Close() })
+
+	tlsConfig, err := common.MakeTestClientTLSConfig(common.TestClientConfig{
+		AuthClient: testCtx.authClient,
+		AuthServer: testCtx.authServer,
+		Address:    net.JoinHostPort("localhost", cassandraServer.Port()),
+		Cluster:    testCtx.clusterName,
+		Username:   "alice",
+		RouteToDatabase: tlsca.RouteToDatabase{
+			ServiceName: "cassandra",
+			Protocol:    defaults.ProtocolCassandra,
+			Username:    "cassandra",
+		},
+	})
+	require.NoError(t, err)
+
+	eventCh := make(chan *frame.Frame, 1)
+	cc := cqlclient.NewCqlClient(net.JoinHostPort("localhost", cassandraServer.Port()), &cqlclient.AuthCredentials{
+		Username: "cassandra",
+		Password: "cassandra",
+	})
+	cc.TLSConfig = tlsConfig
+	cc.EventHandlers = []cqlclient.EventHandler{
+		func(event *frame.Frame, conn *cqlclient.CqlClientConnection) {
+			select {
+			case eventCh <- event:
+			default:
+			}
+		},
+	}
+
+	conn, err := cc.ConnectAndInit(ctx, primitive.ProtocolVersion4, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	resp, err := conn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 1, &message.Register{
+		EventTypes: []primitive.EventType{primitive.EventTypeSchemaChange},
+	}))
+	require.NoError(t, err)
+	require.IsType(t, &message.Ready{}, resp.Body.Message)
+
+	pushed := &message.SchemaChangeEvent{
+		ChangeType: primitive.SchemaChangeTypeCreated,
+		Target:     primitive.SchemaChangeTargetKeyspace,
+		Keyspace:   "my_keyspace",
+	}
+	require.NoError(t, cassandraServer.PushEvent(pushed))
+
+	select {
+	case event := <-eventCh:
+		received, ok := event.Body.Message.(*message.SchemaChangeEvent)
+		require.True(t, ok)
+		require.Equal(t, pushed, received)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Did not receive the pushed event.")
+	}
+}
+
+// TestCassandraRegisterQueryHandler verifies that tests can register custom
+// query results on the test server and the client receives them.
+func TestCassandraRegisterQueryHandler(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCtx := setupTestContext(ctx, t, withCassandra("cassandra"))
+	go testCtx.startHandlingConnections()
+
+	testCtx.createUserAndRole(ctx, t, "alice", "admin", []string{types.Wildcard}, []string{types.Wildcard})
+
+	server := testCtx.cassandra["cassandra"].db
+	server.RegisterQueryHandler("SELECT * FROM my.table", message.RowSet{
+		{[]byte("first")},
+		{[]byte("second")},
+	})
+
+	dbConn, err := testCtx.cassandraClient(ctx, "alice", "cassandra", "cassandra")
+	require.NoError(t, err)
+	t.Cleanup(dbConn.Close)
+
+	var value string
+	var values []string
+	iter := dbConn.Query("SELECT * FROM my.table").Iter()
+	for iter.Scan(&value) {
+		values = append(values, value)
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"first", "second"}, values)
+}
+
+// TestCassandraClientCredentials verifies that the credentials configured on
+// the test client are the ones presented to the server during the handshake.
+func TestCassandraClientCredentials(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCtx := setupTestContext(ctx, t, withCassandra("cassandra"))
+	go testCtx.startHandlingConnections()
+
+	testCtx.createUserAndRole(ctx, t, "alice", "admin", []string{types.Wildcard}, []string{types.Wildcard})
+
+	// A username the server doesn't know about is rejected during the
+	// handshake, proving the configured username was presented.
+	_, err := testCtx.cassandraClient(ctx, "alice", "cassandra", "bob",
+		cassandra.WithCassandraUsername("bob"))
+	require.Error(t, err)
+	require.ErrorContains(t, err, "invalid credentials")
+
+	// Same for a wrong password.
+	_, err = testCtx.cassandraClient(ctx, "alice", "cassandra", "cassandra",
+		cassandra.WithCassandraPassword("wrong-password"))
+	require.Error(t, err)
+	require.ErrorContains(t, err, "invalid credentials")
+
+	// The default credentials are accepted.
+	dbConn, err := testCtx.cassandraClient(ctx, "alice", "cassandra", "cassandra")
+	require.NoError(t, err)
+	dbConn.Close()
+}
+
+// TestCassandraAuthError verifies that an injected authentication error is
+// surfaced to the client on login.
+func TestCassandraAuthError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCtx := setupTestContext(ctx, t,
+		withCassandra("cassandra", cassandra.WithAuthError("injected auth failure")))
+	go testCtx.startHandlingConnections()
+
+	testCtx.createUserAndRole(ctx, t, "alice", "admin", []string{"cassandra"}, []string{types.Wildcard})
+
+	_, err := testCtx.cassandraClient(ctx, "alice", "cassandra", "cassandra")
+	require.Error(t, err)
+	require.ErrorContains(t, err, "injected auth failure")
+}
+
+// TestCassandraProtocolV5 verifies that the test server can negotiate a
+// native protocol v5 session and serve the system.local query.
+func TestCassandraProtocolV5(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCtx := setupTestContext(ctx, t, withCassandra("cassandra"))
+	go testCtx.startHandlingConnections()
+
+	testCtx.createUserAndRole(ctx, t, "alice", "admin", []string{"cassandra"}, []string{types.Wildcard})
+
+	// Start a separate server that doesn't require client certificates so the
+	// raw client can connect to it directly.
+	cassandraServer, err := cassandra.NewTestServer(common.TestServerConfig{
+		Name:       "cassandra-v5",
+		AuthClient: testCtx.authClient,
+	})
+	require.NoError(t, err)
+	go cassandraServer.Serve()
+	t.Cleanup(func() { cassandraServer.Close() })
+
+	tlsConfig, err := common.MakeTestClientTLSConfig(common.TestClientConfig{
+		AuthClient: testCtx.authClient,
+		AuthServer: testCtx.authServer,
+		Address:    net.JoinHostPort("localhost", cassandraServer.Port()),
+		Cluster:    testCtx.clusterName,
+		Username:   "alice",
+		RouteToDatabase: tlsca.RouteToDatabase{
+			ServiceName: "cassandra",
+			Protocol:    defaults.ProtocolCassandra,
+			Username:    "cassandra",
+		},
+	})
+	require.NoError(t, err)
+
+	cc := cqlclient.NewCqlClient(net.JoinHostPort("localhost", cassandraServer.Port()), &cqlclient.AuthCredentials{
+		Username: "cassandra",
+		Password: "cassandra",
+	})
+	cc.TLSConfig = tlsConfig
+
+	conn, err := cc.ConnectAndInit(ctx, primitive.ProtocolVersion5, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	fr := frame.NewFrame(primitive.ProtocolVersion5, 1, &message.Query{
+		Query: "select * from system.local where key='local'",
+	})
+	resp, err := conn.SendAndReceive(fr)
+	require.NoError(t, err)
+	require.IsType(t, &message.RowsResult{}, resp.Body.Message)
+}
+
 func TestAuditCassandra(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/tls"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
@@ -46,6 +47,10 @@ import (
 type STSMock struct {
 	stsiface.STSAPI
 	ARN string
+	// AssumedRoleARNs records the role ARNs of assume-role calls.
+	AssumedRoleARNs []string
+	// AssumedRoleExternalIDs records the external IDs of assume-role calls.
+	AssumedRoleExternalIDs []string
 }
 
 func (m *STSMock) GetCallerIdentityWithContext(aws.Context, *sts.GetCallerIdentityInput, ...request.Option) (*sts.GetCallerIdentityOutput, error) {
@@ -54,6 +59,23 @@ func (m *STSMock) GetCallerIdentityWithContext(aws.Context, *sts.GetCallerIdenti
 	}, nil
 }
 
+func (m *STSMock) AssumeRole(in *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return m.AssumeRoleWithContext(context.Background(), in)
+}
+
+func (m *STSMock) AssumeRoleWithContext(ctx aws.Context, in *sts.AssumeRoleInput, _ ...request.Option) (*sts.AssumeRoleOutput, error) {
+	m.AssumedRoleARNs = append(m.AssumedRoleARNs, aws.StringValue(in.RoleArn))
+	m.AssumedRoleExternalIDs = append(m.AssumedRoleExternalIDs, aws.StringValue(in.ExternalId))
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("FAKEACCESSKEYID"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
 // RDSMock mocks AWS RDS API.
 type RDSMock struct {
 	rdsiface.RDSAPI
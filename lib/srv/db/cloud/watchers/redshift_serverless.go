@@ -0,0 +1,343 @@
+/*
+Copyright 2023 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watchers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/redshiftserverless"
+	"github.com/aws/aws-sdk-go/service/redshiftserverless/redshiftserverlessiface"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/teleport/lib/srv/db/common"
+)
+
+// redshiftServerlessFetcherConfig is the Redshift Serverless databases
+// fetcher configuration.
+type redshiftServerlessFetcherConfig struct {
+	// Labels is a selector to match cloud databases.
+	Labels types.Labels
+	// Region is the AWS region to query databases in.
+	Region string
+	// Client is the Redshift Serverless API client. When empty, a client
+	// is constructed from Session using the AssumeRoleARN credentials.
+	Client redshiftserverlessiface.RedshiftServerlessAPI
+	// Session is the AWS session used to construct the API client when
+	// Client is not set.
+	Session *awssession.Session
+	// AssumeRoleARN is an optional IAM role ARN the fetcher assumes when
+	// constructing its client, so databases can be fetched from another
+	// AWS account.
+	AssumeRoleARN string
+	// ExternalID is an optional external ID passed along when assuming
+	// AssumeRoleARN in another account.
+	ExternalID string
+	// STS is the STS API client used to assume AssumeRoleARN. Required
+	// when AssumeRoleARN is set.
+	STS stsiface.STSAPI
+	// MaxPages is the maximum number of pages to fetch from the paginated
+	// list APIs. Defaults to common.MaxPages.
+	MaxPages int
+	// UseFIPSEndpoint targets the FIPS endpoint of the region instead of
+	// the default one when the client is constructed by the fetcher.
+	UseFIPSEndpoint bool
+}
+
+// CheckAndSetDefaults validates the config and sets defaults.
+func (c *redshiftServerlessFetcherConfig) CheckAndSetDefaults() error {
+	if len(c.Labels) == 0 {
+		return trace.BadParameter("missing parameter Labels")
+	}
+	if c.Region == "" {
+		return trace.BadParameter("missing parameter Region")
+	}
+	if c.ExternalID != "" && c.AssumeRoleARN == "" {
+		return trace.BadParameter("missing parameter AssumeRoleARN (required when ExternalID is set)")
+	}
+	var cred *credentials.Credentials
+	if c.AssumeRoleARN != "" {
+		parsed, err := arn.Parse(c.AssumeRoleARN)
+		if err != nil {
+			return trace.BadParameter("invalid AssumeRoleARN %q: %v", c.AssumeRoleARN, err)
+		}
+		if parsed.Service != "iam" || !strings.HasPrefix(parsed.Resource, "role/") {
+			return trace.BadParameter("AssumeRoleARN %q is not an IAM role ARN", c.AssumeRoleARN)
+		}
+		if c.STS == nil {
+			return trace.BadParameter("missing parameter STS (required when AssumeRoleARN is set)")
+		}
+		cred = stscreds.NewCredentialsWithClient(c.STS, c.AssumeRoleARN, func(provider *stscreds.AssumeRoleProvider) {
+			if c.ExternalID != "" {
+				provider.ExternalID = aws.String(c.ExternalID)
+			}
+		})
+		// Assume the role once to verify the credentials work before the
+		// watcher starts polling with them.
+		if _, err := cred.Get(); err != nil {
+			return trace.Wrap(common.ConvertError(err))
+		}
+	}
+	if c.Client == nil {
+		if c.Session == nil {
+			return trace.BadParameter("missing parameter Client or Session")
+		}
+		config := aws.NewConfig().WithRegion(c.Region)
+		if cred != nil {
+			config = config.WithCredentials(cred)
+		}
+		if c.UseFIPSEndpoint {
+			// The SDK endpoint defaults do not have FIPS variants for
+			// Redshift Serverless, so target the FIPS hostname directly.
+			config = config.WithEndpoint(fmt.Sprintf("redshift-serverless-fips.%s.amazonaws.com", c.Region))
+		}
+		c.Client = redshiftserverless.New(c.Session, config)
+	} else if c.UseFIPSEndpoint {
+		return trace.BadParameter("UseFIPSEndpoint requires the client to be constructed by the fetcher (unset Client and provide Session)")
+	}
+	if c.MaxPages <= 0 {
+		c.MaxPages = common.MaxPages
+	}
+	return nil
+}
+
+// redshiftServerlessWorkgroupWithTags is a Redshift Serverless workgroup
+// with its resource tags attached.
+type redshiftServerlessWorkgroupWithTags struct {
+	*redshiftserverless.Workgroup
+
+	Tags []*redshiftserverless.Tag
+}
+
+// redshiftServerlessFetcher retrieves Redshift Serverless databases.
+type redshiftServerlessFetcher struct {
+	cfg redshiftServerlessFetcherConfig
+	log logrus.FieldLogger
+}
+
+// newRedshiftServerlessFetcher returns a new Redshift Serverless databases
+// fetcher instance.
+func newRedshiftServerlessFetcher(config redshiftServerlessFetcherConfig) (Fetcher, error) {
+	if err := config.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	fields := logrus.Fields{
+		trace.Component: "watch:redshift-serverless",
+		"labels":        config.Labels,
+		"region":        config.Region,
+	}
+	if config.AssumeRoleARN != "" {
+		fields["role"] = config.AssumeRoleARN
+	}
+	return &redshiftServerlessFetcher{
+		cfg: config,
+		log: logrus.WithFields(fields),
+	}, nil
+}
+
+// Get returns Redshift Serverless databases matching the watcher's selectors.
+// Per-resource errors are aggregated and returned alongside the databases
+// that were built successfully, so partial discovery still succeeds.
+func (f *redshiftServerlessFetcher) Get(ctx context.Context) (types.Databases, error) {
+	var errs []error
+	databases, workgroups, err := f.getDatabasesFromWorkgroups(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(workgroups) > 0 {
+		endpointDatabases, err := f.getDatabasesFromVPCEndpoints(ctx, workgroups)
+		if err != nil {
+			if trace.IsAccessDenied(err) {
+				f.log.Debugf("No permission to get Redshift Serverless VPC endpoints: %v.", err)
+			} else {
+				f.log.Warnf("Failed to get Redshift Serverless VPC endpoints: %v.", err)
+			}
+			errs = append(errs, err)
+		}
+
+		databases = append(databases, endpointDatabases...)
+	}
+	return filterDatabasesByLabels(databases, f.cfg.Labels, f.log), trace.NewAggregate(errs...)
+}
+
+// String returns the fetcher's string description.
+func (f *redshiftServerlessFetcher) String() string {
+	return fmt.Sprintf("redshiftServerlessFetcher(Region=%v, Labels=%v)",
+		f.cfg.Region, f.cfg.Labels)
+}
+
+func (f *redshiftServerlessFetcher) getDatabasesFromWorkgroups(ctx context.Context) (types.Databases, []*redshiftServerlessWorkgroupWithTags, error) {
+	workgroups, err := f.getWorkgroups(ctx)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+
+	var errs []error
+	var databases types.Databases
+	var workgroupsWithTags []*redshiftServerlessWorkgroupWithTags
+	for _, workgroup := range workgroups {
+		if !services.IsRedshiftServerlessWorkgroupAvailable(workgroup) {
+			f.log.Debugf("The current status of Redshift Serverless workgroup %q is %q. Skipping.",
+				aws.StringValue(workgroup.WorkgroupName),
+				aws.StringValue(workgroup.Status))
+			continue
+		}
+
+		// Convert the workgroup without its tags when the tag lookup
+		// fails; the error is reported to the caller in the aggregate.
+		tags, err := f.getResourceTags(ctx, workgroup.WorkgroupArn)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		database, err := services.NewDatabaseFromRedshiftServerlessWorkgroup(workgroup, tags)
+		if err != nil {
+			f.log.Infof("Could not convert Redshift Serverless workgroup %q to database resource: %v.",
+				aws.StringValue(workgroup.WorkgroupName), err)
+			continue
+		}
+
+		databases = append(databases, database)
+		workgroupsWithTags = append(workgroupsWithTags, &redshiftServerlessWorkgroupWithTags{
+			Workgroup: workgroup,
+			Tags:      tags,
+		})
+	}
+	return databases, workgroupsWithTags, trace.NewAggregate(errs...)
+}
+
+func (f *redshiftServerlessFetcher) getDatabasesFromVPCEndpoints(ctx context.Context, workgroups []*redshiftServerlessWorkgroupWithTags) (types.Databases, error) {
+	endpoints, err := f.getVPCEndpoints(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var databases types.Databases
+	for _, endpoint := range endpoints {
+		workgroup, found := findWorkgroupWithName(workgroups, aws.StringValue(endpoint.WorkgroupName))
+		if !found {
+			f.log.Debugf("Could not find matching workgroup for Redshift Serverless endpoint %q. Skipping.",
+				aws.StringValue(endpoint.EndpointName))
+			continue
+		}
+
+		if !services.IsRedshiftServerlessEndpointAvailable(endpoint) {
+			f.log.Debugf("The current status of Redshift Serverless endpoint %q is %q. Skipping.",
+				aws.StringValue(endpoint.EndpointName),
+				aws.StringValue(endpoint.EndpointStatus))
+			continue
+		}
+
+		// VPC endpoints do not have resource tags attached to them. Use
+		// the tags from the workgroup instead.
+		database, err := services.NewDatabaseFromRedshiftServerlessVPCEndpoint(endpoint, workgroup.Workgroup, workgroup.Tags)
+		if err != nil {
+			f.log.Infof("Could not convert Redshift Serverless endpoint %q to database resource: %v.",
+				aws.StringValue(endpoint.EndpointName), err)
+			continue
+		}
+		databases = append(databases, database)
+	}
+	return databases, nil
+}
+
+func (f *redshiftServerlessFetcher) getResourceTags(ctx context.Context, arn *string) ([]*redshiftserverless.Tag, error) {
+	output, err := f.cfg.Client.ListTagsForResourceWithContext(ctx, &redshiftserverless.ListTagsForResourceInput{
+		ResourceArn: arn,
+	})
+	if err != nil {
+		err = common.ConvertError(err)
+		if trace.IsAccessDenied(err) {
+			f.log.WithError(err).Debugf("No permission to get tags for %q.", aws.StringValue(arn))
+		} else {
+			f.log.WithError(err).Warnf("Failed to get tags for %q.", aws.StringValue(arn))
+		}
+		return nil, trace.Wrap(err)
+	}
+	return output.Tags, nil
+}
+
+// getWorkgroups fetches all Redshift Serverless workgroups using the
+// fetcher's client, up to the configured max number of pages.
+func (f *redshiftServerlessFetcher) getWorkgroups(ctx context.Context) ([]*redshiftserverless.Workgroup, error) {
+	var workgroups []*redshiftserverless.Workgroup
+	var pageNum int
+	var truncated bool
+	err := f.cfg.Client.ListWorkgroupsPagesWithContext(ctx, nil,
+		func(page *redshiftserverless.ListWorkgroupsOutput, lastPage bool) bool {
+			pageNum++
+			workgroups = append(workgroups, page.Workgroups...)
+			if pageNum >= f.cfg.MaxPages {
+				truncated = !lastPage
+				return false
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, common.ConvertError(err)
+	}
+	if truncated {
+		f.log.Warnf("Reached the maximum number of pages (%v) fetching Redshift Serverless workgroups. Results may be incomplete.", f.cfg.MaxPages)
+	}
+	return workgroups, nil
+}
+
+// getVPCEndpoints fetches all Redshift Serverless VPC endpoints using the
+// fetcher's client, up to the configured max number of pages.
+func (f *redshiftServerlessFetcher) getVPCEndpoints(ctx context.Context) ([]*redshiftserverless.EndpointAccess, error) {
+	var endpoints []*redshiftserverless.EndpointAccess
+	var pageNum int
+	var truncated bool
+	err := f.cfg.Client.ListEndpointAccessPagesWithContext(ctx, nil,
+		func(page *redshiftserverless.ListEndpointAccessOutput, lastPage bool) bool {
+			pageNum++
+			endpoints = append(endpoints, page.Endpoints...)
+			if pageNum >= f.cfg.MaxPages {
+				truncated = !lastPage
+				return false
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, common.ConvertError(err)
+	}
+	if truncated {
+		f.log.Warnf("Reached the maximum number of pages (%v) fetching Redshift Serverless VPC endpoints. Results may be incomplete.", f.cfg.MaxPages)
+	}
+	return endpoints, nil
+}
+
+func findWorkgroupWithName(workgroups []*redshiftServerlessWorkgroupWithTags, name string) (*redshiftServerlessWorkgroupWithTags, bool) {
+	for _, workgroup := range workgroups {
+		if aws.StringValue(workgroup.WorkgroupName) == name {
+			return workgroup, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2023 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watchers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/redshiftserverless"
+	"github.com/gravitational/trace"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gravitational/teleport/api/types"
+	clients "github.com/gravitational/teleport/lib/cloud"
+	cloudtest "github.com/gravitational/teleport/lib/cloud/test"
+	"github.com/gravitational/teleport/lib/services"
+	"github.com/gravitational/teleport/lib/srv/db/cloud"
+	"github.com/gravitational/teleport/lib/srv/db/common"
+)
+
+// TestRedshiftServerlessFetcher tests the Redshift Serverless databases
+// fetcher with assume-role credentials.
+func TestRedshiftServerlessFetcher(t *testing.T) {
+	ctx := context.Background()
+	wildcardLabels := types.Labels{types.Wildcard: []string{types.Wildcard}}
+
+	workgroupProd, workgroupProdTags, databaseProd := makeRedshiftServerlessWorkgroup(t, "wg-prod", "us-east-1", "prod")
+	workgroupDev, workgroupDevTags, _ := makeRedshiftServerlessWorkgroup(t, "wg-dev", "us-east-1", "dev")
+	workgroupUnavailable, _, _ := makeRedshiftServerlessWorkgroup(t, "wg-creating", "us-east-1", "prod",
+		func(workgroup *redshiftserverless.Workgroup) {
+			workgroup.Status = aws.String(redshiftserverless.WorkgroupStatusCreating)
+		})
+
+	clientMock := &cloudtest.RedshiftServerlessMock{
+		Workgroups: []*redshiftserverless.Workgroup{workgroupProd, workgroupDev, workgroupUnavailable},
+		TagsByARN: map[string][]*redshiftserverless.Tag{
+			aws.StringValue(workgroupProd.WorkgroupArn): workgroupProdTags,
+			aws.StringValue(workgroupDev.WorkgroupArn):  workgroupDevTags,
+		},
+	}
+
+	t.Run("assume role", func(t *testing.T) {
+		roleARN := "arn:aws:iam::123456789012:role/test-role"
+		externalID := "externalid01"
+		stsMock := &cloud.STSMock{}
+
+		fetcher, err := newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+			Region:        "us-east-1",
+			Labels:        wildcardLabels,
+			Client:        clientMock,
+			AssumeRoleARN: roleARN,
+			ExternalID:    externalID,
+			STS:           stsMock,
+		})
+		require.NoError(t, err)
+
+		// The fetcher verified the role by assuming it with the
+		// configured external ID.
+		require.Equal(t, []string{roleARN}, stsMock.AssumedRoleARNs)
+		require.Equal(t, []string{externalID}, stsMock.AssumedRoleExternalIDs)
+
+		databases, err := fetcher.Get(ctx)
+		require.NoError(t, err)
+		require.Len(t, databases, 2)
+
+		// Discovered databases carry the source account of their ARNs.
+		for _, database := range databases {
+			require.Equal(t, "123456789012", database.GetAllLabels()["account-id"])
+		}
+	})
+
+	t.Run("labels selector", func(t *testing.T) {
+		fetcher, err := newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+			Region: "us-east-1",
+			Labels: types.Labels{"env": []string{"prod"}},
+			Client: clientMock,
+		})
+		require.NoError(t, err)
+
+		databases, err := fetcher.Get(ctx)
+		require.NoError(t, err)
+		require.Equal(t, types.Databases{databaseProd}, databases)
+	})
+
+	t.Run("config errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			config redshiftServerlessFetcherConfig
+		}{
+			{
+				name: "external ID without role",
+				config: redshiftServerlessFetcherConfig{
+					Region:     "us-east-1",
+					Labels:     wildcardLabels,
+					Client:     clientMock,
+					ExternalID: "externalid01",
+				},
+			},
+			{
+				name: "invalid role ARN",
+				config: redshiftServerlessFetcherConfig{
+					Region:        "us-east-1",
+					Labels:        wildcardLabels,
+					Client:        clientMock,
+					AssumeRoleARN: "arn:aws:sts::123456789012:federated-user/Alice",
+					STS:           &cloud.STSMock{},
+				},
+			},
+			{
+				name: "role without STS client",
+				config: redshiftServerlessFetcherConfig{
+					Region:        "us-east-1",
+					Labels:        wildcardLabels,
+					Client:        clientMock,
+					AssumeRoleARN: "arn:aws:iam::123456789012:role/test-role",
+				},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := newRedshiftServerlessFetcher(tt.config)
+				require.True(t, trace.IsBadParameter(err), "expected BadParameter, got %v", err)
+			})
+		}
+	})
+}
+
+// TestRedshiftServerlessFetcherFIPSEndpoint verifies the fetcher constructs
+// its client against the FIPS endpoint when the flag is set and keeps the
+// default endpoint otherwise.
+func TestRedshiftServerlessFetcherFIPSEndpoint(t *testing.T) {
+	wildcardLabels := types.Labels{types.Wildcard: []string{types.Wildcard}}
+	session := awssession.Must(awssession.NewSession(aws.NewConfig().WithRegion("us-east-1")))
+
+	fetcher, err := newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+		Region:          "us-east-1",
+		Labels:          wildcardLabels,
+		Session:         session,
+		UseFIPSEndpoint: true,
+	})
+	require.NoError(t, err)
+
+	client, ok := fetcher.(*redshiftServerlessFetcher).cfg.Client.(*redshiftserverless.RedshiftServerless)
+	require.True(t, ok)
+	require.Equal(t, "https://redshift-serverless-fips.us-east-1.amazonaws.com", client.Endpoint)
+
+	// The default endpoint is kept when the flag is unset.
+	fetcher, err = newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+		Region:  "us-east-1",
+		Labels:  wildcardLabels,
+		Session: session,
+	})
+	require.NoError(t, err)
+
+	client, ok = fetcher.(*redshiftServerlessFetcher).cfg.Client.(*redshiftserverless.RedshiftServerless)
+	require.True(t, ok)
+	require.NotContains(t, client.Endpoint, "fips")
+
+	// The flag only applies when the fetcher constructs the client itself.
+	_, err = newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+		Region:          "us-east-1",
+		Labels:          wildcardLabels,
+		Client:          &cloudtest.RedshiftServerlessMock{},
+		UseFIPSEndpoint: true,
+	})
+	require.True(t, trace.IsBadParameter(err), "expected BadParameter, got %v", err)
+}
+
+// pagedRedshiftServerlessMock mocks the RedshiftServerless API returning
+// each page of workgroups separately.
+type pagedRedshiftServerlessMock struct {
+	cloudtest.RedshiftServerlessMock
+	workgroupPages [][]*redshiftserverless.Workgroup
+}
+
+func (m *pagedRedshiftServerlessMock) ListWorkgroupsPagesWithContext(_ aws.Context, _ *redshiftserverless.ListWorkgroupsInput, fn func(*redshiftserverless.ListWorkgroupsOutput, bool) bool, _ ...request.Option) error {
+	for i, page := range m.workgroupPages {
+		if !fn(&redshiftserverless.ListWorkgroupsOutput{Workgroups: page}, i == len(m.workgroupPages)-1) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// TestRedshiftServerlessFetcherMaxPages verifies the fetcher caps pagination
+// at the configured number of pages and warns about truncated results.
+func TestRedshiftServerlessFetcherMaxPages(t *testing.T) {
+	ctx := context.Background()
+	wildcardLabels := types.Labels{types.Wildcard: []string{types.Wildcard}}
+
+	var pages [][]*redshiftserverless.Workgroup
+	for i := 0; i < 5; i++ {
+		workgroup, _, _ := makeRedshiftServerlessWorkgroup(t, fmt.Sprintf("wg-%d", i), "us-east-1", "prod")
+		pages = append(pages, []*redshiftserverless.Workgroup{workgroup})
+	}
+	clientMock := &pagedRedshiftServerlessMock{workgroupPages: pages}
+
+	// MaxPages defaults to the package-wide page limit.
+	fetcher, err := newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+		Region: "us-east-1",
+		Labels: wildcardLabels,
+		Client: clientMock,
+	})
+	require.NoError(t, err)
+	require.Equal(t, common.MaxPages, fetcher.(*redshiftServerlessFetcher).cfg.MaxPages)
+
+	fetcher, err = newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+		Region:   "us-east-1",
+		Labels:   wildcardLabels,
+		Client:   clientMock,
+		MaxPages: 2,
+	})
+	require.NoError(t, err)
+
+	logger, hook := logrustest.NewNullLogger()
+	fetcher.(*redshiftServerlessFetcher).log = logger.WithField("test", t.Name())
+
+	databases, err := fetcher.Get(ctx)
+	require.NoError(t, err)
+	require.Len(t, databases, 2)
+
+	var warned bool
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "maximum number of pages") {
+			warned = true
+		}
+	}
+	require.True(t, warned, "expected a warning that the page limit was reached")
+}
+
+// failingTagsRedshiftServerlessMock mocks the RedshiftServerless API failing
+// tag lookups for a specific resource ARN.
+type failingTagsRedshiftServerlessMock struct {
+	cloudtest.RedshiftServerlessMock
+	failTagsARN string
+}
+
+func (m *failingTagsRedshiftServerlessMock) ListTagsForResourceWithContext(ctx aws.Context, input *redshiftserverless.ListTagsForResourceInput, opts ...request.Option) (*redshiftserverless.ListTagsForResourceOutput, error) {
+	if aws.StringValue(input.ResourceArn) == m.failTagsARN {
+		return nil, trace.AccessDenied("access denied")
+	}
+	return m.RedshiftServerlessMock.ListTagsForResourceWithContext(ctx, input, opts...)
+}
+
+// TestRedshiftServerlessFetcherPartialResults verifies the fetcher returns
+// the databases it successfully built alongside an aggregated error when
+// some per-resource calls fail.
+func TestRedshiftServerlessFetcherPartialResults(t *testing.T) {
+	ctx := context.Background()
+	wildcardLabels := types.Labels{types.Wildcard: []string{types.Wildcard}}
+
+	workgroupProd, workgroupProdTags, databaseProd := makeRedshiftServerlessWorkgroup(t, "wg-prod", "us-east-1", "prod")
+	workgroupDev, _, _ := makeRedshiftServerlessWorkgroup(t, "wg-dev", "us-east-1", "dev")
+
+	clientMock := &failingTagsRedshiftServerlessMock{
+		RedshiftServerlessMock: cloudtest.RedshiftServerlessMock{
+			Workgroups: []*redshiftserverless.Workgroup{workgroupProd, workgroupDev},
+			TagsByARN: map[string][]*redshiftserverless.Tag{
+				aws.StringValue(workgroupProd.WorkgroupArn): workgroupProdTags,
+			},
+		},
+		failTagsARN: aws.StringValue(workgroupDev.WorkgroupArn),
+	}
+
+	fetcher, err := newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+		Region: "us-east-1",
+		Labels: wildcardLabels,
+		Client: clientMock,
+	})
+	require.NoError(t, err)
+
+	databases, err := fetcher.Get(ctx)
+	require.Error(t, err)
+	require.ErrorContains(t, err, "access denied")
+
+	// Both workgroups are still discovered: the one with the failed tag
+	// lookup is converted without its tags.
+	require.Len(t, databases, 2)
+	require.Contains(t, databases, databaseProd)
+	require.Equal(t, "prod", databaseProd.GetAllLabels()["env"])
+}
+
+// TestWatcherRedshiftServerlessPartialResults verifies that partial fetcher
+// results still flow through the watcher when a per-resource call fails.
+func TestWatcherRedshiftServerlessPartialResults(t *testing.T) {
+	ctx := context.Background()
+
+	workgroupProd, workgroupProdTags, databaseProd := makeRedshiftServerlessWorkgroup(t, "wg-prod", "us-east-1", "prod")
+	workgroupDev, _, _ := makeRedshiftServerlessWorkgroup(t, "wg-dev", "us-east-1", "dev")
+
+	// The workgroup with the failed tag lookup is discovered without its tags.
+	databaseDev, err := services.NewDatabaseFromRedshiftServerlessWorkgroup(workgroupDev, nil)
+	require.NoError(t, err)
+
+	clientMock := &failingTagsRedshiftServerlessMock{
+		RedshiftServerlessMock: cloudtest.RedshiftServerlessMock{
+			Workgroups: []*redshiftserverless.Workgroup{workgroupProd, workgroupDev},
+			TagsByARN: map[string][]*redshiftserverless.Tag{
+				aws.StringValue(workgroupProd.WorkgroupArn): workgroupProdTags,
+			},
+		},
+		failTagsARN: aws.StringValue(workgroupDev.WorkgroupArn),
+	}
+
+	watcher, err := NewWatcher(ctx, WatcherConfig{
+		AWSMatchers: []services.AWSMatcher{{
+			Types:   []string{services.AWSMatcherRedshiftServerless},
+			Regions: []string{"us-east-1"},
+			Tags:    types.Labels{types.Wildcard: []string{types.Wildcard}},
+		}},
+		Clients: &clients.TestCloudClients{
+			RedshiftServerless: clientMock,
+		},
+	})
+	require.NoError(t, err)
+
+	checkFetchAndSend(t, watcher, types.Databases{databaseProd, databaseDev})
+}
+
+func makeRedshiftServerlessWorkgroup(t *testing.T, name, region, env string, opts ...func(*redshiftserverless.Workgroup)) (*redshiftserverless.Workgroup, []*redshiftserverless.Tag, types.Database) {
+	workgroup := &redshiftserverless.Workgroup{
+		WorkgroupArn:  aws.String(fmt.Sprintf("arn:aws:redshift-serverless:%s:123456789012:workgroup/%s", region, name)),
+		WorkgroupName: aws.String(name),
+		WorkgroupId:   aws.String(fmt.Sprintf("%s-id", name)),
+		NamespaceName: aws.String("my-namespace"),
+		Status:        aws.String(redshiftserverless.WorkgroupStatusAvailable),
+		Endpoint: &redshiftserverless.Endpoint{
+			Address: aws.String(fmt.Sprintf("%s.123456789012.%s.redshift-serverless.amazonaws.com", name, region)),
+			Port:    aws.Int64(5439),
+		},
+	}
+	for _, opt := range opts {
+		opt(workgroup)
+	}
+
+	tags := []*redshiftserverless.Tag{{
+		Key:   aws.String("env"),
+		Value: aws.String(env),
+	}}
+
+	database, err := services.NewDatabaseFromRedshiftServerlessWorkgroup(workgroup, tags)
+	require.NoError(t, err)
+	return workgroup, tags, database
+}
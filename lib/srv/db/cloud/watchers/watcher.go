@@ -121,6 +121,10 @@ func (w *Watcher) fetchAndSend() {
 	var result types.Databases
 	for _, fetcher := range w.fetchers {
 		databases, err := fetcher.Get(w.ctx)
+		// Fetchers may return partial results alongside an aggregated error
+		// when only some of their resources failed to fetch, so collect
+		// whatever came back before looking at the error.
+		result = append(result, databases...)
 		if err != nil {
 			// DB agent may have permissions to fetch some databases but not
 			// others. This is acceptable, thus continue to other fetchers.
@@ -131,10 +135,10 @@ func (w *Watcher) fetchAndSend() {
 				continue
 			}
 
-			w.log.WithError(err).Errorf("%s failed.", fetcher)
-			return
+			// Other errors are not fatal either: one failing fetcher should
+			// not hide the databases discovered by the others.
+			w.log.WithError(err).Warnf("%s failed.", fetcher)
 		}
-		result = append(result, databases...)
 	}
 	select {
 	case w.databasesC <- result:
@@ -167,11 +171,12 @@ func makeFetchers(ctx context.Context, config *WatcherConfig) (result []Fetcher,
 func makeAWSFetchers(clients cloud.Clients, matchers []services.AWSMatcher) (result []Fetcher, err error) {
 	type makeFetcherFunc func(cloud.Clients, string, types.Labels) (Fetcher, error)
 	makeFetcherFuncs := map[string][]makeFetcherFunc{
-		services.AWSMatcherRDS:         {makeRDSInstanceFetcher, makeRDSAuroraFetcher},
-		services.AWSMatcherRDSProxy:    {makeRDSProxyFetcher},
-		services.AWSMatcherRedshift:    {makeRedshiftFetcher},
-		services.AWSMatcherElastiCache: {makeElastiCacheFetcher},
-		services.AWSMatcherMemoryDB:    {makeMemoryDBFetcher},
+		services.AWSMatcherRDS:                {makeRDSInstanceFetcher, makeRDSAuroraFetcher},
+		services.AWSMatcherRDSProxy:           {makeRDSProxyFetcher},
+		services.AWSMatcherRedshift:           {makeRedshiftFetcher},
+		services.AWSMatcherRedshiftServerless: {makeRedshiftServerlessFetcher},
+		services.AWSMatcherElastiCache:        {makeElastiCacheFetcher},
+		services.AWSMatcherMemoryDB:           {makeMemoryDBFetcher},
 	}
 
 	for _, matcher := range matchers {
@@ -295,6 +300,20 @@ func makeRedshiftFetcher(clients cloud.Clients, region string, tags types.Labels
 	})
 }
 
+// makeRedshiftServerlessFetcher returns Redshift Serverless fetcher for the
+// provided region and tags.
+func makeRedshiftServerlessFetcher(clients cloud.Clients, region string, tags types.Labels) (Fetcher, error) {
+	client, err := clients.GetAWSRedshiftServerlessClient(region)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return newRedshiftServerlessFetcher(redshiftServerlessFetcherConfig{
+		Region: region,
+		Labels: tags,
+		Client: client,
+	})
+}
+
 // makeElastiCacheFetcher returns ElastiCache fetcher for the provided region and tags.
 func makeElastiCacheFetcher(clients cloud.Clients, region string, tags types.Labels) (Fetcher, error) {
 	elastiCache, err := clients.GetAWSElastiCacheClient(region)
@@ -0,0 +1,1092 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versioncontrol
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport"
+	"github.com/gravitational/teleport/api/types"
+)
+
+// defaultShell is the interpreter directive used when a script does not
+// specify one on POSIX targets.
+const defaultShell = "/bin/sh"
+
+// defaultShellWindows is the interpreter directive used when a script does not
+// specify one on windows targets.
+const defaultShellWindows = `C:\Windows\System32\cmd.exe`
+
+// windowsAbsPathPattern matches windows-style absolute paths such as
+// C:\Windows\System32\cmd.exe.
+var windowsAbsPathPattern = regexp.MustCompile(`^[a-zA-Z]:\\`)
+
+// per-execution state file names.
+const (
+	paramsFileName      = "params.json"
+	scriptFileName      = "script.sh"
+	outputFileName      = "output.log"
+	stdoutFileName      = "stdout.log"
+	stderrFileName      = "stderr.log"
+	outputJSONLFileName = "output.jsonl"
+	resultFileName      = "result.json"
+)
+
+// defaultMaxOutputBytes is the default cap on the size of a single
+// execution's output file.
+const defaultMaxOutputBytes = 4 * 1024 * 1024
+
+// ExecutorConfig configures a script Executor.
+type ExecutorConfig struct {
+	// Dir is the directory under which per-execution state is stored.
+	Dir string
+	// MaxOutputBytes caps how much script output is persisted per execution.
+	// Output past the cap is discarded while the script keeps running.
+	// Defaults to defaultMaxOutputBytes when unset.
+	MaxOutputBytes int64
+	// GracePeriod is how long a script is given to exit after SIGTERM before
+	// it is killed when an execution is stopped due to timeout or
+	// cancellation. Zero means scripts are killed immediately.
+	GracePeriod time.Duration
+	// TargetOS is the OS whose conventions shell directives are validated
+	// against and invoked with ("windows" or a POSIX GOOS value). Defaults to
+	// the host OS.
+	TargetOS string
+	// OutputJSONL additionally captures each line of script output as a
+	// timestamped, stream-tagged JSON object in an output.jsonl file alongside
+	// output.log, for consumers that ingest output as structured events.
+	OutputJSONL bool
+	// SeparateStreams captures stdout and stderr into separate stdout.log and
+	// stderr.log files instead of the combined output.log, with the output cap
+	// applied to each stream separately. Load the captures by passing a stream
+	// name to LoadOutput.
+	SeparateStreams bool
+	// MaxConcurrent caps how many executions may run concurrently, protecting
+	// node resources during mass rollouts. Zero means no limit. When the limit
+	// is reached, Exec and ExecAsync block until a slot frees up, unless
+	// FailWhenLimited is set.
+	MaxConcurrent int
+	// FailWhenLimited makes Exec and ExecAsync fail with a trace.LimitExceeded
+	// error instead of blocking when MaxConcurrent executions are already
+	// running.
+	FailWhenLimited bool
+}
+
+// CheckAndSetDefaults checks the executor config and sets default values.
+func (c *ExecutorConfig) CheckAndSetDefaults() error {
+	if c.Dir == "" {
+		return trace.BadParameter("executor config missing required parameter 'Dir'")
+	}
+
+	if c.MaxOutputBytes < 0 {
+		return trace.BadParameter("executor config parameter 'MaxOutputBytes' must not be negative (got %d)", c.MaxOutputBytes)
+	}
+
+	if c.MaxOutputBytes == 0 {
+		c.MaxOutputBytes = defaultMaxOutputBytes
+	}
+
+	if c.GracePeriod < 0 {
+		return trace.BadParameter("executor config parameter 'GracePeriod' must not be negative (got %v)", c.GracePeriod)
+	}
+
+	if c.TargetOS == "" {
+		c.TargetOS = runtime.GOOS
+	}
+
+	if c.MaxConcurrent < 0 {
+		return trace.BadParameter("executor config parameter 'MaxConcurrent' must not be negative (got %d)", c.MaxConcurrent)
+	}
+
+	return nil
+}
+
+// Executor runs scripts on the local node, persisting their parameters,
+// output, and results under a state directory so that past executions
+// can be inspected.
+type Executor struct {
+	cfg ExecutorConfig
+	mu  sync.Mutex
+	// inFlight tracks refs with an execution currently in progress, guarded
+	// by mu.
+	inFlight map[ref]struct{}
+	// sem limits the number of concurrent executions when MaxConcurrent is
+	// set; nil means no limit.
+	sem chan struct{}
+}
+
+// NewExecutor builds an executor with the given config.
+func NewExecutor(cfg ExecutorConfig) (*Executor, error) {
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var sem chan struct{}
+	if cfg.MaxConcurrent > 0 {
+		sem = make(chan struct{}, cfg.MaxConcurrent)
+	}
+
+	return &Executor{
+		cfg:      cfg,
+		inFlight: make(map[ref]struct{}),
+		sem:      sem,
+	}, nil
+}
+
+// acquireSlot reserves a concurrency slot, blocking until one is available or
+// failing with a trace.LimitExceeded error when FailWhenLimited is set. The
+// returned release function must be called once the execution completes.
+func (e *Executor) acquireSlot() (release func(), err error) {
+	if e.sem == nil {
+		return func() {}, nil
+	}
+
+	if e.cfg.FailWhenLimited {
+		select {
+		case e.sem <- struct{}{}:
+		default:
+			return nil, trace.LimitExceeded("the maximum number of concurrent executions (%d) has been reached", e.cfg.MaxConcurrent)
+		}
+	} else {
+		e.sem <- struct{}{}
+	}
+
+	return func() { <-e.sem }, nil
+}
+
+// acquireRef marks the given ref as having an execution in progress. A
+// trace.AlreadyExists error is returned if an execution for the ref is
+// already in flight, preventing concurrent runs from clobbering each other's
+// state directory.
+func (e *Executor) acquireRef(r ref) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.inFlight[r]; ok {
+		return trace.AlreadyExists("execution %q is already in progress", r)
+	}
+
+	e.inFlight[r] = struct{}{}
+	return nil
+}
+
+// releaseRef marks the given ref's execution as complete.
+func (e *Executor) releaseRef(r ref) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.inFlight, r)
+}
+
+// ref identifies a specific execution by type and id.
+type ref struct {
+	etype string
+	id    uint64
+}
+
+// String formats the ref as the execution's directory name.
+func (r ref) String() string {
+	return fmt.Sprintf("%s-%d", r.etype, r.id)
+}
+
+// parseRef parses an execution directory name of the form <type>-<id>.
+func parseRef(name string) (ref, error) {
+	idx := strings.LastIndex(name, "-")
+	if idx < 1 || idx == len(name)-1 {
+		return ref{}, trace.BadParameter("%q is not a valid execution ref", name)
+	}
+
+	id, err := strconv.ParseUint(name[idx+1:], 10, 64)
+	if err != nil {
+		return ref{}, trace.BadParameter("%q is not a valid execution ref", name)
+	}
+
+	return ref{etype: name[:idx], id: id}, nil
+}
+
+// Exec runs the given script synchronously, returning its result. Failures
+// are recorded in the result rather than returned as errors so that they can
+// be persisted and inspected like any other outcome.
+func (e *Executor) Exec(params types.ExecScript) types.ExecScriptResult {
+	return e.ExecContext(context.Background(), params)
+}
+
+// ExecContext is like Exec, but kills the script and records a cancellation
+// error in the result if the given context is canceled before the script
+// completes.
+func (e *Executor) ExecContext(ctx context.Context, params types.ExecScript) types.ExecScriptResult {
+	r := ref{etype: params.Type, id: params.ID}
+	if err := e.acquireRef(r); err != nil {
+		return types.ExecScriptResult{
+			Type:  params.Type,
+			ID:    params.ID,
+			Error: err.Error(),
+			Time:  time.Now(),
+		}
+	}
+	defer e.releaseRef(r)
+
+	release, err := e.acquireSlot()
+	if err != nil {
+		return types.ExecScriptResult{
+			Type:  params.Type,
+			ID:    params.ID,
+			Error: err.Error(),
+			Time:  time.Now(),
+		}
+	}
+	defer release()
+
+	exc := &execution{
+		params:          params,
+		dir:             filepath.Join(e.cfg.Dir, r.String()),
+		maxOutputBytes:  e.cfg.MaxOutputBytes,
+		gracePeriod:     e.cfg.GracePeriod,
+		targetOS:        e.cfg.TargetOS,
+		outputJSONL:     e.cfg.OutputJSONL,
+		separateStreams: e.cfg.SeparateStreams,
+	}
+
+	if err := exc.init(); err != nil {
+		return types.ExecScriptResult{
+			Type:  params.Type,
+			ID:    params.ID,
+			Error: err.Error(),
+			Time:  time.Now(),
+		}
+	}
+
+	return exc.run(ctx)
+}
+
+// ExecAsync starts the given script without waiting for it to complete,
+// returning a ref identifying the execution. When a concurrency limit is
+// configured, a slot is reserved before returning. Initialization failures
+// (invalid parameters, state directory problems, an execution already in
+// flight) are returned synchronously; once ExecAsync returns successfully, callers poll
+// for completion with LoadResult, which returns a trace.NotFound error until
+// the result has been persisted.
+func (e *Executor) ExecAsync(params types.ExecScript) (ref, error) {
+	r := ref{etype: params.Type, id: params.ID}
+	if err := e.acquireRef(r); err != nil {
+		return ref{}, trace.Wrap(err)
+	}
+
+	release, err := e.acquireSlot()
+	if err != nil {
+		e.releaseRef(r)
+		return ref{}, trace.Wrap(err)
+	}
+
+	exc := &execution{
+		params:          params,
+		dir:             filepath.Join(e.cfg.Dir, r.String()),
+		maxOutputBytes:  e.cfg.MaxOutputBytes,
+		gracePeriod:     e.cfg.GracePeriod,
+		targetOS:        e.cfg.TargetOS,
+		outputJSONL:     e.cfg.OutputJSONL,
+		separateStreams: e.cfg.SeparateStreams,
+	}
+
+	if err := exc.init(); err != nil {
+		release()
+		e.releaseRef(r)
+		return ref{}, trace.Wrap(err)
+	}
+
+	go func() {
+		defer e.releaseRef(r)
+		defer release()
+		exc.run(context.Background())
+	}()
+
+	return r, nil
+}
+
+// ListExecutions lists the executions present under the executor's state
+// directory, sorted by type and then id. Entries that are not directories or
+// do not parse as execution refs are ignored.
+func (e *Executor) ListExecutions() ([]ref, error) {
+	entries, err := os.ReadDir(e.cfg.Dir)
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	var refs []ref
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		parsed, err := parseRef(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		refs = append(refs, parsed)
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].etype != refs[j].etype {
+			return refs[i].etype < refs[j].etype
+		}
+		return refs[i].id < refs[j].id
+	})
+
+	return refs, nil
+}
+
+// storedParams is the on-disk form of an execution's parameters: the script
+// parameters plus a checksum of the persisted script body.
+type storedParams struct {
+	types.ExecScript
+	// ScriptSHA256 is the hex-encoded SHA-256 of the script body, used to
+	// verify the stored script file before it is reused.
+	ScriptSHA256 string `json:"script_sha256,omitempty"`
+}
+
+// LoadParams loads the stored parameters of an execution.
+func (e *Executor) LoadParams(etype string, id uint64) (types.ExecScript, error) {
+	var params types.ExecScript
+	if err := e.loadJSON(etype, id, paramsFileName, &params); err != nil {
+		return types.ExecScript{}, trace.Wrap(err)
+	}
+
+	return params, nil
+}
+
+// LoadScript loads the stored script body of an execution, verifying it
+// against the SHA-256 checksum recorded in params.json when the execution was
+// initialized. A trace.CompareFailed error is returned if the script does not
+// match its checksum, guarding re-runs against partial writes and tampering.
+func (e *Executor) LoadScript(etype string, id uint64) ([]byte, error) {
+	var stored storedParams
+	if err := e.loadJSON(etype, id, paramsFileName, &stored); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	// The script file name depends on the stored shell directive and the
+	// target OS, so reconstruct it the same way init did.
+	exc := &execution{
+		params:   stored.ExecScript,
+		targetOS: e.cfg.TargetOS,
+	}
+
+	script, err := os.ReadFile(e.stateFilePath(etype, id, exc.scriptFileName()))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	sum := sha256.Sum256(script)
+	if hex.EncodeToString(sum[:]) != stored.ScriptSHA256 {
+		return nil, trace.CompareFailed("stored script of execution %q does not match its checksum, refusing to use it", ref{etype: etype, id: id})
+	}
+
+	return script, nil
+}
+
+// LoadResult loads the stored result of an execution. A trace.NotFound error
+// is returned if the execution does not exist or has not yet completed.
+func (e *Executor) LoadResult(etype string, id uint64) (types.ExecScriptResult, error) {
+	var result types.ExecScriptResult
+	if err := e.loadJSON(etype, id, resultFileName, &result); err != nil {
+		return types.ExecScriptResult{}, trace.Wrap(err)
+	}
+
+	return result, nil
+}
+
+// streamPollInterval is how often StreamOutput polls for new output.
+const streamPollInterval = time.Millisecond * 50
+
+// StreamOutput returns a reader that streams the output of an execution as it
+// is written. Reads block waiting for new output until the execution's result
+// is persisted, at which point the remaining output is drained and the reader
+// returns io.EOF.
+func (e *Executor) StreamOutput(etype string, id uint64) (io.ReadCloser, error) {
+	file, err := os.Open(e.stateFilePath(etype, id, outputFileName))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	return &outputStream{
+		file:       file,
+		resultPath: e.stateFilePath(etype, id, resultFileName),
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+// outputStream tails an execution's output file until its result appears.
+type outputStream struct {
+	file       *os.File
+	resultPath string
+	done       bool
+	closeOnce  sync.Once
+	closed     chan struct{}
+}
+
+// Read implements io.Reader, blocking for new output until the execution
+// completes or the stream is closed.
+func (s *outputStream) Read(p []byte) (int, error) {
+	for {
+		n, err := s.file.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, trace.ConvertSystemError(err)
+		}
+
+		if s.done {
+			return 0, io.EOF
+		}
+
+		// The result file is written after the last of the output, so drain
+		// the output once more before reporting EOF.
+		if _, err := os.Stat(s.resultPath); err == nil {
+			s.done = true
+			continue
+		}
+
+		select {
+		case <-s.closed:
+			return 0, io.EOF
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+// Close implements io.Closer, unblocking any pending reads.
+func (s *outputStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	return trace.Wrap(s.file.Close())
+}
+
+// LoadOutput loads the stored output of an execution. The stream parameter
+// selects which capture to load: "stdout" or "stderr" for executions run with
+// SeparateStreams enabled, or empty for the combined stdout/stderr log.
+func (e *Executor) LoadOutput(etype string, id uint64, stream string) ([]byte, error) {
+	name := outputFileName
+	switch stream {
+	case "":
+	case "stdout":
+		name = stdoutFileName
+	case "stderr":
+		name = stderrFileName
+	default:
+		return nil, trace.BadParameter("unknown output stream %q", stream)
+	}
+
+	out, err := os.ReadFile(e.stateFilePath(etype, id, name))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	return out, nil
+}
+
+// OutputEvent is a single line of script output tagged with the stream that
+// produced it and the time it was captured.
+type OutputEvent struct {
+	// Stream is the stream the line was read from, "stdout" or "stderr".
+	Stream string `json:"stream"`
+	// Time is when the line was captured.
+	Time time.Time `json:"ts"`
+	// Line is the line's content, without the trailing newline.
+	Line string `json:"line"`
+}
+
+// LoadOutputJSONL loads the structured output events of an execution that was
+// run with OutputJSONL enabled, in the order they were captured.
+func (e *Executor) LoadOutputJSONL(etype string, id uint64) ([]OutputEvent, error) {
+	file, err := os.Open(e.stateFilePath(etype, id, outputJSONLFileName))
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	defer file.Close()
+
+	var events []OutputEvent
+	decoder := json.NewDecoder(file)
+	for {
+		var event OutputEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, trace.Wrap(err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// jsonlOutput appends output events to a shared JSON-lines encoder. It is
+// shared by the per-stream writers so that events land in the order they are
+// captured regardless of which stream produced them.
+type jsonlOutput struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// writeEvent encodes a single output event.
+func (j *jsonlOutput) writeEvent(stream, line string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return trace.Wrap(j.enc.Encode(OutputEvent{
+		Stream: stream,
+		Time:   time.Now(),
+		Line:   line,
+	}))
+}
+
+// streamWriter returns a writer that tags complete lines written to it with
+// the given stream name.
+func (j *jsonlOutput) streamWriter(stream string) *jsonlStreamWriter {
+	return &jsonlStreamWriter{out: j, stream: stream}
+}
+
+// jsonlStreamWriter buffers writes from a single stream and emits one output
+// event per complete line.
+type jsonlStreamWriter struct {
+	out    *jsonlOutput
+	stream string
+	buf    []byte
+}
+
+// Write implements io.Writer.
+func (w *jsonlStreamWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		if err := w.out.writeEvent(w.stream, string(w.buf[:idx])); err != nil {
+			return 0, trace.Wrap(err)
+		}
+		w.buf = w.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// flush emits any buffered output that was not newline-terminated.
+func (w *jsonlStreamWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	err := w.out.writeEvent(w.stream, string(w.buf))
+	w.buf = nil
+	return trace.Wrap(err)
+}
+
+// loadJSON decodes one of an execution's state files into val.
+func (e *Executor) loadJSON(etype string, id uint64, name string, val interface{}) error {
+	data, err := os.ReadFile(e.stateFilePath(etype, id, name))
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	return trace.Wrap(json.Unmarshal(data, val))
+}
+
+// stateFilePath builds the path of one of an execution's state files.
+func (e *Executor) stateFilePath(etype string, id uint64, name string) string {
+	return filepath.Join(e.cfg.Dir, ref{etype: etype, id: id}.String(), name)
+}
+
+// execution tracks the state of a single script execution.
+type execution struct {
+	params         types.ExecScript
+	dir            string
+	maxOutputBytes int64
+	gracePeriod    time.Duration
+	// targetOS selects the shell conventions used to validate and invoke the
+	// script. Empty means the host OS.
+	targetOS string
+	// outputJSONL additionally captures output as structured events in an
+	// output.jsonl file.
+	outputJSONL bool
+	// separateStreams captures stdout and stderr into separate files instead
+	// of the combined output log.
+	separateStreams bool
+}
+
+// windowsTarget returns true if the execution uses windows shell conventions.
+func (e *execution) windowsTarget() bool {
+	if e.targetOS == "" {
+		return runtime.GOOS == "windows"
+	}
+	return e.targetOS == "windows"
+}
+
+// shell returns the execution's interpreter directive, falling back to the
+// target OS default when the params do not specify one.
+func (e *execution) shell() string {
+	if e.params.Shell != "" {
+		return e.params.Shell
+	}
+	if e.windowsTarget() {
+		return defaultShellWindows
+	}
+	return defaultShell
+}
+
+// scriptFileName returns the name of the persisted script file. Windows
+// interpreters select scripts by extension, so powershell scripts are stored
+// as .ps1 and cmd scripts as .cmd; POSIX targets always use script.sh.
+func (e *execution) scriptFileName() string {
+	if !e.windowsTarget() {
+		return scriptFileName
+	}
+	if isPowershell(e.shell()) {
+		return "script.ps1"
+	}
+	return "script.cmd"
+}
+
+// isPowershell returns true if the given shell directive invokes powershell.
+// The path is split manually rather than with filepath so that windows-style
+// paths are handled on any host OS.
+func isPowershell(shell string) bool {
+	interpreter := strings.Split(shell, " ")[0]
+	if idx := strings.LastIndexAny(interpreter, `/\`); idx >= 0 {
+		interpreter = interpreter[idx+1:]
+	}
+	interpreter = strings.TrimSuffix(strings.ToLower(interpreter), ".exe")
+	return interpreter == "powershell" || interpreter == "pwsh"
+}
+
+// clear removes any state left behind by previous executions of the same ref.
+func (e *execution) clear() error {
+	return trace.ConvertSystemError(os.RemoveAll(e.dir))
+}
+
+// init validates the execution's parameters and sets up its state directory,
+// persisting the parameters and script body.
+func (e *execution) init() error {
+	if err := e.params.Check(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := e.checkShell(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := e.clear(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := os.MkdirAll(e.dir, teleport.PrivateDirMode); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	// The script's checksum is stored with the parameters so the script file
+	// can be verified before being reused.
+	sum := sha256.Sum256([]byte(e.params.Script))
+	paramsBytes, err := json.Marshal(storedParams{
+		ExecScript:   e.params,
+		ScriptSHA256: hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(e.dir, paramsFileName), paramsBytes, teleport.FileMaskOwnerOnly); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(e.dir, e.scriptFileName()), []byte(e.params.Script), teleport.FileMaskOwnerOnly); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	return nil
+}
+
+// run executes the script and persists its result. Failures are recorded in
+// the returned result rather than returned as errors.
+func (e *execution) run(ctx context.Context) types.ExecScriptResult {
+	result := types.ExecScriptResult{
+		Type:      e.params.Type,
+		ID:        e.params.ID,
+		StartTime: time.Now(),
+	}
+
+	if err := e.doRun(ctx, &result); err != nil && result.Error == "" {
+		result.Error = err.Error()
+	}
+	result.EndTime = time.Now()
+	result.Time = result.EndTime
+
+	// A result that can't be persisted is still returned to the caller.
+	if resultBytes, err := json.Marshal(result); err == nil {
+		os.WriteFile(filepath.Join(e.dir, resultFileName), resultBytes, teleport.FileMaskOwnerOnly)
+	}
+
+	return result
+}
+
+// doRun starts the script process and waits for it to complete, killing it
+// if the given context is canceled or the configured timeout elapses first.
+func (e *execution) doRun(ctx context.Context, result *types.ExecScriptResult) error {
+	runCtx := ctx
+	if e.params.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, e.params.Timeout)
+		defer cancel()
+	}
+
+	cmd, err := e.command()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	var stdout, stderr io.Writer
+	var outputTruncated func() bool
+	if e.separateStreams {
+		outFile, err := os.OpenFile(filepath.Join(e.dir, stdoutFileName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, teleport.FileMaskOwnerOnly)
+		if err != nil {
+			return trace.ConvertSystemError(err)
+		}
+		// Closing the output files also flushes any partial output from killed runs.
+		defer outFile.Close()
+
+		errFile, err := os.OpenFile(filepath.Join(e.dir, stderrFileName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, teleport.FileMaskOwnerOnly)
+		if err != nil {
+			return trace.ConvertSystemError(err)
+		}
+		defer errFile.Close()
+
+		limitedOut := &limitWriter{w: outFile, remaining: e.maxOutputBytes}
+		limitedErr := &limitWriter{w: errFile, remaining: e.maxOutputBytes}
+		stdout, stderr = limitedOut, limitedErr
+		outputTruncated = func() bool { return limitedOut.isTruncated() || limitedErr.isTruncated() }
+	} else {
+		out, err := os.OpenFile(filepath.Join(e.dir, outputFileName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, teleport.FileMaskOwnerOnly)
+		if err != nil {
+			return trace.ConvertSystemError(err)
+		}
+		// Closing the output file also flushes any partial output from killed runs.
+		defer out.Close()
+
+		limited := &limitWriter{w: out, remaining: e.maxOutputBytes}
+		stdout, stderr = limited, limited
+		outputTruncated = func() bool { return limited.isTruncated() }
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if e.outputJSONL {
+		jsonlFile, err := os.OpenFile(filepath.Join(e.dir, outputJSONLFileName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, teleport.FileMaskOwnerOnly)
+		if err != nil {
+			return trace.ConvertSystemError(err)
+		}
+		defer jsonlFile.Close()
+
+		jsonl := &jsonlOutput{enc: json.NewEncoder(jsonlFile)}
+		stdoutEvents := jsonl.streamWriter("stdout")
+		stderrEvents := jsonl.streamWriter("stderr")
+		// Flush any trailing output that was not newline-terminated before the
+		// result is persisted.
+		defer stdoutEvents.flush()
+		defer stderrEvents.flush()
+
+		cmd.Stdout = io.MultiWriter(stdout, stdoutEvents)
+		cmd.Stderr = io.MultiWriter(stderr, stderrEvents)
+	}
+	// Scripts run from their state directory unless the params request a
+	// specific working directory; state files stay under e.dir either way.
+	cmd.Dir = e.dir
+	if e.params.WorkingDir != "" {
+		cmd.Dir = e.params.WorkingDir
+	}
+	env, err := buildEnv(e.params)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	cmd.Env = env
+
+	// Run the child in its own process group so that killing it on timeout
+	// also kills any processes the script spawned.
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-errCh:
+		result.Code = cmd.ProcessState.ExitCode()
+		result.OutputTruncated = outputTruncated()
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		result.Success = true
+		return nil
+	case <-runCtx.Done():
+		result.Signal = e.stopProcess(cmd, errCh)
+		result.OutputTruncated = outputTruncated()
+
+		// If the caller's context is done, this was a cancellation rather
+		// than a timeout.
+		if ctx.Err() != nil {
+			result.Code = -1
+			return trace.Wrap(ctx.Err(), "script execution canceled")
+		}
+
+		result.Code = types.ExecScriptCodeTimeout
+		return trace.LimitExceeded("script execution timed out after %v", e.params.Timeout)
+	}
+}
+
+// stopProcess stops a running script, first asking it to terminate so that it
+// can clean up, then killing it if it hasn't exited within the grace period.
+// Returns the name of the signal that stopped the process.
+func (e *execution) stopProcess(cmd *exec.Cmd, errCh <-chan error) string {
+	if e.gracePeriod > 0 {
+		terminateProcessGroup(cmd)
+
+		select {
+		case <-errCh:
+			return sigtermName
+		case <-time.After(e.gracePeriod):
+		}
+	}
+
+	killProcessGroup(cmd)
+	<-errCh
+	return sigkillName
+}
+
+// truncationMarker is appended to an execution's output file when the output
+// cap is reached.
+const truncationMarker = "\n[output truncated]\n"
+
+// limitWriter writes through to an underlying writer until its byte budget is
+// spent, then appends a truncation marker and discards further writes. Writes
+// are serialized: when JSONL capture wraps stdout and stderr in separate
+// MultiWriters, os/exec copies the two streams from separate goroutines that
+// may share a limitWriter.
+type limitWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	remaining int64
+	truncated bool
+}
+
+// Write implements io.Writer. Writes never fail due to the budget; excess
+// bytes are reported as written but discarded.
+func (l *limitWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.truncated {
+		return len(p), nil
+	}
+
+	if int64(len(p)) > l.remaining {
+		if _, err := l.w.Write(p[:l.remaining]); err != nil {
+			return 0, err
+		}
+		if _, err := io.WriteString(l.w, truncationMarker); err != nil {
+			return 0, err
+		}
+		l.remaining = 0
+		l.truncated = true
+		return len(p), nil
+	}
+
+	n, err := l.w.Write(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// isTruncated reports whether the writer's byte budget was spent.
+func (l *limitWriter) isTruncated() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.truncated
+}
+
+// checkShell verifies that the execution's interpreter exists, so that a
+// missing interpreter surfaces as a clear error before any state is written
+// rather than as a generic start failure. Interpreter paths that are not
+// absolute are resolved via PATH, preserving the "/usr/bin/env bash" pattern.
+// Absolute paths are judged by the target OS's conventions, so windows-style
+// paths pass when targeting windows; existence checks are skipped when the
+// target OS differs from the host since the path cannot be stat'd locally.
+func (e *execution) checkShell() error {
+	interpreter := strings.Split(e.shell(), " ")[0]
+
+	if e.windowsTarget() {
+		if !windowsAbsPathPattern.MatchString(interpreter) {
+			return trace.BadParameter("shell interpreter %q is not a windows-style absolute path", interpreter)
+		}
+		if runtime.GOOS != "windows" {
+			return nil
+		}
+		if _, err := os.Stat(interpreter); err != nil {
+			return trace.BadParameter("shell interpreter %q does not exist", interpreter)
+		}
+		return nil
+	}
+
+	if filepath.IsAbs(interpreter) {
+		if _, err := os.Stat(interpreter); err != nil {
+			return trace.BadParameter("shell interpreter %q does not exist", interpreter)
+		}
+		return nil
+	}
+
+	if _, err := exec.LookPath(interpreter); err != nil {
+		return trace.BadParameter("shell interpreter %q was not found in PATH", interpreter)
+	}
+
+	return nil
+}
+
+// command builds the exec.Cmd for this execution's script and shell directive.
+// The shell may be either a bare interpreter path or an interpreter with a
+// single argument, emulating a limited form of shebang directive (e.g.
+// "/usr/bin/env bash"). Script arguments are appended after the script path.
+// On windows targets the interpreter's own invocation pattern is applied:
+// powershell scripts are run with "-NoProfile -File" and cmd scripts with "/C".
+func (e *execution) command() (*exec.Cmd, error) {
+	shell := e.shell()
+	scriptPath := filepath.Join(e.dir, e.scriptFileName())
+
+	if e.windowsTarget() {
+		interpreter := strings.Split(shell, " ")[0]
+		var args []string
+		if isPowershell(shell) {
+			args = append(args, "-NoProfile", "-File", scriptPath)
+		} else {
+			args = append(args, "/C", scriptPath)
+		}
+		args = append(args, e.params.Args...)
+		return exec.Command(interpreter, args...), nil
+	}
+
+	parts := strings.Split(shell, " ")
+	var args []string
+	switch len(parts) {
+	case 1:
+		args = append(args, scriptPath)
+	case 2:
+		args = append(args, parts[1], scriptPath)
+	default:
+		return nil, trace.BadParameter("shell directive %q has too many parts", shell)
+	}
+	args = append(args, e.params.Args...)
+
+	return exec.Command(parts[0], args...), nil
+}
+
+// envRefPattern matches ${VAR} references within env values.
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// buildEnv constructs the child environment from passthrough of selected host
+// variables and explicit env entries, with the latter taking precedence.
+// ${VAR} references within env values are expanded against passthrough-provided
+// values and other env entries, so that values like "${PATH}:/opt/teleport/bin"
+// work without baking in absolute paths. Passthrough values win over env
+// entries during expansion, letting an entry extend the host value of a
+// variable of the same name. Undefined references expand to the empty string,
+// and reference cycles between env entries are an error.
+func buildEnv(params types.ExecScript) ([]string, error) {
+	env := make([]string, 0, len(params.EnvPassthrough)+len(params.Env))
+	passthrough := make(map[string]string, len(params.EnvPassthrough))
+	for _, name := range params.EnvPassthrough {
+		if val, ok := os.LookupEnv(name); ok {
+			passthrough[name] = val
+			env = append(env, name+"="+val)
+		}
+	}
+
+	expanded := make(map[string]string, len(params.Env))
+	expanding := make(map[string]bool)
+	var expand func(name string) (string, error)
+	expand = func(name string) (string, error) {
+		if val, ok := expanded[name]; ok {
+			return val, nil
+		}
+		if expanding[name] {
+			return "", trace.BadParameter("env variable %q is part of a reference cycle", name)
+		}
+		expanding[name] = true
+		defer delete(expanding, name)
+
+		var expandErr error
+		val := envRefPattern.ReplaceAllStringFunc(params.Env[name], func(match string) string {
+			ref := match[2 : len(match)-1]
+			if hostVal, ok := passthrough[ref]; ok {
+				return hostVal
+			}
+			if _, ok := params.Env[ref]; ok {
+				refVal, err := expand(ref)
+				if err != nil && expandErr == nil {
+					expandErr = err
+				}
+				return refVal
+			}
+			return ""
+		})
+		if expandErr != nil {
+			return "", trace.Wrap(expandErr)
+		}
+
+		expanded[name] = val
+		return val, nil
+	}
+
+	for name := range params.Env {
+		val, err := expand(name)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		env = append(env, name+"="+val)
+	}
+
+	return env, nil
+}
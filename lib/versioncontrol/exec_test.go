@@ -0,0 +1,853 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versioncontrol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gravitational/teleport/api/types"
+)
+
+func newTestExecutor(t *testing.T) *Executor {
+	executor, err := NewExecutor(ExecutorConfig{
+		Dir: t.TempDir(),
+	})
+	require.NoError(t, err)
+	return executor
+}
+
+func TestExecutor(t *testing.T) {
+	t.Parallel()
+
+	tts := []struct {
+		params  types.ExecScript
+		success bool
+		code    int
+		output  string
+		desc    string
+	}{
+		{
+			params: types.ExecScript{
+				Type:   "test-run",
+				ID:     1,
+				Script: "echo hello",
+			},
+			success: true,
+			output:  "hello\n",
+			desc:    "basic success",
+		},
+		{
+			params: types.ExecScript{
+				Type:   "test-run",
+				ID:     2,
+				Script: "echo failing && exit 3",
+			},
+			code:   3,
+			output: "failing\n",
+			desc:   "non-zero exit",
+		},
+		{
+			params: types.ExecScript{
+				Type:   "test-run",
+				ID:     3,
+				Script: "echo \"var=$TEST_EXEC_VAR\"",
+				Env: map[string]string{
+					"TEST_EXEC_VAR": "some-value",
+				},
+			},
+			success: true,
+			output:  "var=some-value\n",
+			desc:    "env variables",
+		},
+		{
+			params: types.ExecScript{
+				Type:           "test-run",
+				ID:             4,
+				Script:         "echo hello",
+				Shell:          "/usr/bin/env bash",
+				EnvPassthrough: []string{"PATH"},
+			},
+			success: true,
+			output:  "hello\n",
+			desc:    "shebang-style shell directive",
+		},
+		{
+			params: types.ExecScript{
+				Type:   "test-run",
+				ID:     5,
+				Script: "echo \"first=$1 second=$2\"",
+				Args:   []string{"one", "two"},
+			},
+			success: true,
+			output:  "first=one second=two\n",
+			desc:    "positional arguments",
+		},
+	}
+
+	for _, tt := range tts {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			t.Parallel()
+			executor := newTestExecutor(t)
+
+			result := executor.Exec(tt.params)
+			require.Equal(t, tt.params.Type, result.Type)
+			require.Equal(t, tt.params.ID, result.ID)
+			require.Equal(t, tt.success, result.Success)
+			require.Equal(t, tt.code, result.Code)
+			if tt.success {
+				require.Empty(t, result.Error)
+			} else {
+				require.NotEmpty(t, result.Error)
+			}
+
+			require.True(t, result.EndTime.After(result.StartTime))
+			require.Greater(t, result.Duration(), time.Duration(0))
+			require.Equal(t, result.EndTime, result.Time)
+
+			// The result should be persisted and loadable.
+			loaded, err := executor.LoadResult(tt.params.Type, tt.params.ID)
+			require.NoError(t, err)
+			require.Equal(t, result.Success, loaded.Success)
+			require.Equal(t, result.Code, loaded.Code)
+
+			if tt.output != "" {
+				out, err := executor.LoadOutput(tt.params.Type, tt.params.ID, "")
+				require.NoError(t, err)
+				require.Equal(t, tt.output, string(out))
+			}
+		})
+	}
+}
+
+func TestExecutorWorkingDir(t *testing.T) {
+	t.Parallel()
+	executor := newTestExecutor(t)
+
+	workingDir := t.TempDir()
+	result := executor.Exec(types.ExecScript{
+		Type:       "test-workdir",
+		ID:         1,
+		Script:     "pwd",
+		WorkingDir: workingDir,
+	})
+	require.True(t, result.Success)
+
+	out, err := executor.LoadOutput("test-workdir", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, workingDir+"\n", string(out))
+
+	// State files stay under the executor's directory, not the working dir.
+	_, err = executor.LoadResult("test-workdir", 1)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(workingDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestExecutorTimeout(t *testing.T) {
+	t.Parallel()
+	executor := newTestExecutor(t)
+
+	start := time.Now()
+	result := executor.Exec(types.ExecScript{
+		Type:    "test-timeout",
+		ID:      1,
+		Script:  "echo started && sleep 10",
+		Timeout: time.Millisecond * 100,
+	})
+	require.Less(t, time.Since(start), time.Second*5)
+
+	require.False(t, result.Success)
+	require.Equal(t, types.ExecScriptCodeTimeout, result.Code)
+	require.Contains(t, result.Error, "timed out")
+
+	// Output written before the timeout should still be flushed.
+	out, err := executor.LoadOutput("test-timeout", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, "started\n", string(out))
+}
+
+func TestExecContextCancel(t *testing.T) {
+	t.Parallel()
+	executor := newTestExecutor(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		cancel()
+	}()
+
+	start := time.Now()
+	result := executor.ExecContext(ctx, types.ExecScript{
+		Type:   "test-cancel",
+		ID:     1,
+		Script: "echo started && sleep 10",
+	})
+	require.Less(t, time.Since(start), time.Second*5)
+
+	require.False(t, result.Success)
+	require.Equal(t, -1, result.Code)
+	require.Contains(t, result.Error, "canceled")
+
+	// Output written before the cancellation should still be flushed.
+	out, err := executor.LoadOutput("test-cancel", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, "started\n", string(out))
+}
+
+func TestExecutorGracePeriod(t *testing.T) {
+	t.Parallel()
+	executor, err := NewExecutor(ExecutorConfig{
+		Dir:         t.TempDir(),
+		GracePeriod: time.Second * 5,
+	})
+	require.NoError(t, err)
+
+	// The script traps SIGTERM and exits cleanly, so it should be stopped by
+	// SIGTERM within the grace period rather than killed.
+	start := time.Now()
+	result := executor.Exec(types.ExecScript{
+		Type:    "test-grace",
+		ID:      1,
+		Script:  "trap 'echo terminated; exit 0' TERM; echo started; sleep 10",
+		Timeout: time.Millisecond * 200,
+	})
+	require.Less(t, time.Since(start), time.Second*5)
+
+	require.False(t, result.Success)
+	require.Equal(t, types.ExecScriptCodeTimeout, result.Code)
+	require.Equal(t, "SIGTERM", result.Signal)
+
+	// The trap's output should be flushed. The shell may also report the
+	// interrupted sleep in between, so only the first and last lines are
+	// checked.
+	out, err := executor.LoadOutput("test-grace", 1, "")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(out), "started\n"), "output: %q", out)
+	require.True(t, strings.HasSuffix(string(out), "terminated\n"), "output: %q", out)
+}
+
+func TestExecutorShellCheck(t *testing.T) {
+	t.Parallel()
+	executor := newTestExecutor(t)
+
+	// An absolute interpreter path that doesn't exist should be rejected with
+	// a clear error naming the interpreter.
+	result := executor.Exec(types.ExecScript{
+		Type:   "test-shell",
+		ID:     1,
+		Script: "echo hello",
+		Shell:  "/this/shell/does/not/exist",
+	})
+	require.False(t, result.Success)
+	require.Contains(t, result.Error, `shell interpreter "/this/shell/does/not/exist" does not exist`)
+
+	// A relative interpreter should be resolved via PATH.
+	result = executor.Exec(types.ExecScript{
+		Type:   "test-shell",
+		ID:     2,
+		Script: "echo hello",
+		Shell:  "definitely-not-a-real-shell",
+	})
+	require.False(t, result.Success)
+	require.Contains(t, result.Error, `shell interpreter "definitely-not-a-real-shell" was not found in PATH`)
+
+	// The check runs before any state is written.
+	_, err := executor.LoadParams("test-shell", 1)
+	require.True(t, trace.IsNotFound(err))
+}
+
+func TestExecutorEnvExpansion(t *testing.T) {
+	executor := newTestExecutor(t)
+
+	// References to other env entries are expanded.
+	result := executor.Exec(types.ExecScript{
+		Type:   "test-env-expand",
+		ID:     1,
+		Script: "echo \"bin=$TEST_EXEC_BIN\"",
+		Env: map[string]string{
+			"TEST_EXEC_BASE": "/opt/teleport",
+			"TEST_EXEC_BIN":  "${TEST_EXEC_BASE}/bin",
+		},
+	})
+	require.True(t, result.Success)
+	out, err := executor.LoadOutput("test-env-expand", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, "bin=/opt/teleport/bin\n", string(out))
+
+	// References to passthrough variables resolve to the host value, even when
+	// the entry extends a variable of the same name.
+	t.Setenv("TEST_EXEC_HOST", "host-value")
+	result = executor.Exec(types.ExecScript{
+		Type:           "test-env-expand",
+		ID:             2,
+		Script:         "echo \"host=$TEST_EXEC_HOST\"",
+		EnvPassthrough: []string{"TEST_EXEC_HOST"},
+		Env: map[string]string{
+			"TEST_EXEC_HOST": "${TEST_EXEC_HOST}:extra",
+		},
+	})
+	require.True(t, result.Success)
+	out, err = executor.LoadOutput("test-env-expand", 2, "")
+	require.NoError(t, err)
+	require.Equal(t, "host=host-value:extra\n", string(out))
+
+	// Undefined references expand to the empty string.
+	result = executor.Exec(types.ExecScript{
+		Type:   "test-env-expand",
+		ID:     3,
+		Script: "echo \"val=$TEST_EXEC_VAL\"",
+		Env: map[string]string{
+			"TEST_EXEC_VAL": "x${TEST_EXEC_UNDEFINED}y",
+		},
+	})
+	require.True(t, result.Success)
+	out, err = executor.LoadOutput("test-env-expand", 3, "")
+	require.NoError(t, err)
+	require.Equal(t, "val=xy\n", string(out))
+
+	// Reference cycles are detected rather than looping forever.
+	result = executor.Exec(types.ExecScript{
+		Type:   "test-env-expand",
+		ID:     4,
+		Script: "echo hello",
+		Env: map[string]string{
+			"TEST_EXEC_A": "${TEST_EXEC_B}",
+			"TEST_EXEC_B": "${TEST_EXEC_A}",
+		},
+	})
+	require.False(t, result.Success)
+	require.Contains(t, result.Error, "reference cycle")
+}
+
+func TestExecutorWindowsShell(t *testing.T) {
+	t.Parallel()
+
+	tts := []struct {
+		shell      string
+		targetOS   string
+		scriptName string
+		args       []string
+		checkErr   string
+		desc       string
+	}{
+		{
+			shell:      `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`,
+			scriptName: "script.ps1",
+			args:       []string{"-NoProfile", "-File"},
+			desc:       "powershell directive",
+		},
+		{
+			shell:      `C:\Windows\System32\cmd.exe`,
+			scriptName: "script.cmd",
+			args:       []string{"/C"},
+			desc:       "cmd directive",
+		},
+		{
+			scriptName: "script.cmd",
+			args:       []string{"/C"},
+			desc:       "default windows shell",
+		},
+		{
+			shell:    "powershell",
+			checkErr: "is not a windows-style absolute path",
+			desc:     "relative windows shell rejected",
+		},
+		{
+			shell:    `C:\Windows\System32\cmd.exe`,
+			targetOS: "linux",
+			checkErr: "was not found in PATH",
+			desc:     "windows directive rejected on posix target",
+		},
+	}
+
+	for _, tt := range tts {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			t.Parallel()
+
+			targetOS := tt.targetOS
+			if targetOS == "" {
+				targetOS = "windows"
+			}
+			exc := &execution{
+				params: types.ExecScript{
+					Type:   "test-win",
+					ID:     1,
+					Script: "echo hello",
+					Shell:  tt.shell,
+				},
+				dir:      t.TempDir(),
+				targetOS: targetOS,
+			}
+
+			err := exc.checkShell()
+			if tt.checkErr != "" {
+				require.True(t, trace.IsBadParameter(err))
+				require.Contains(t, err.Error(), tt.checkErr)
+				return
+			}
+			require.NoError(t, err)
+
+			cmd, err := exc.command()
+			require.NoError(t, err)
+			expected := append(tt.args, filepath.Join(exc.dir, tt.scriptName))
+			require.Equal(t, expected, cmd.Args[1:])
+		})
+	}
+}
+
+func TestExecAsync(t *testing.T) {
+	t.Parallel()
+	executor := newTestExecutor(t)
+
+	r, err := executor.ExecAsync(types.ExecScript{
+		Type:   "test-async",
+		ID:     1,
+		Script: "sleep 0.5 && echo done",
+	})
+	require.NoError(t, err)
+	require.Equal(t, ref{etype: "test-async", id: 1}, r)
+
+	// The result should not be available while the script is still running.
+	_, err = executor.LoadResult("test-async", 1)
+	require.True(t, trace.IsNotFound(err))
+
+	// Starting the same ref again while it is in flight should fail early.
+	_, err = executor.ExecAsync(types.ExecScript{
+		Type:   "test-async",
+		ID:     1,
+		Script: "echo hello",
+	})
+	require.True(t, trace.IsAlreadyExists(err))
+
+	// The result should eventually be persisted.
+	var result types.ExecScriptResult
+	require.Eventually(t, func() bool {
+		var err error
+		result, err = executor.LoadResult("test-async", 1)
+		return err == nil
+	}, time.Second*5, time.Millisecond*50)
+	require.True(t, result.Success)
+
+	out, err := executor.LoadOutput("test-async", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, "done\n", string(out))
+
+	// Invalid parameters should surface synchronously.
+	_, err = executor.ExecAsync(types.ExecScript{
+		Type: "test-async",
+		ID:   2,
+	})
+	require.True(t, trace.IsBadParameter(err))
+}
+
+func TestExecConcurrentRef(t *testing.T) {
+	t.Parallel()
+	executor := newTestExecutor(t)
+
+	params := types.ExecScript{
+		Type:   "test-concurrent",
+		ID:     1,
+		Script: "sleep 0.5 && echo done",
+	}
+
+	// Launch two executions of the same ref concurrently. Exactly one should
+	// run, the other should fail with an already-in-progress error.
+	results := make(chan types.ExecScriptResult, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			results <- executor.Exec(params)
+		}()
+	}
+
+	first, second := <-results, <-results
+	if !first.Success {
+		first, second = second, first
+	}
+	require.True(t, first.Success)
+	require.False(t, second.Success)
+	require.Contains(t, second.Error, "already in progress")
+
+	// The winner's output should be intact.
+	out, err := executor.LoadOutput("test-concurrent", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, "done\n", string(out))
+}
+
+func TestExecutorOutputCap(t *testing.T) {
+	t.Parallel()
+	executor, err := NewExecutor(ExecutorConfig{
+		Dir:            t.TempDir(),
+		MaxOutputBytes: 1024,
+	})
+	require.NoError(t, err)
+
+	// Emit well over the cap while still exiting successfully.
+	result := executor.Exec(types.ExecScript{
+		Type:   "test-cap",
+		ID:     1,
+		Script: "i=0; while [ $i -lt 200 ]; do echo 'some script output that will exceed the cap'; i=$((i+1)); done",
+	})
+	require.True(t, result.Success)
+	require.True(t, result.OutputTruncated)
+
+	out, err := executor.LoadOutput("test-cap", 1, "")
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(out), 1024+len(truncationMarker))
+	require.Contains(t, string(out), "[output truncated]")
+}
+
+// TestLimitWriterConcurrent verifies that a limitWriter can be shared by
+// concurrent writers, as happens when JSONL capture wraps stdout and stderr
+// in separate MultiWriters and os/exec copies the streams from separate
+// goroutines.
+func TestLimitWriterConcurrent(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	lw := &limitWriter{w: &buf, remaining: 1024}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				// Writes to a bytes.Buffer cannot fail.
+				_, _ = lw.Write([]byte("0123456789"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 2000 bytes against a 1024 byte budget: the output must be capped at the
+	// budget plus the truncation marker, with nothing lost or duplicated.
+	require.True(t, lw.isTruncated())
+	require.Len(t, buf.Bytes(), 1024+len(truncationMarker))
+}
+
+func TestExecutorOutputJSONL(t *testing.T) {
+	t.Parallel()
+	executor, err := NewExecutor(ExecutorConfig{
+		Dir:         t.TempDir(),
+		OutputJSONL: true,
+	})
+	require.NoError(t, err)
+
+	// Interleave stdout and stderr lines, sleeping between writes so that the
+	// capture order is deterministic despite the streams using separate pipes.
+	result := executor.Exec(types.ExecScript{
+		Type:   "test-jsonl",
+		ID:     1,
+		Script: "echo out-one; sleep 0.1; echo err-one >&2; sleep 0.1; echo out-two",
+	})
+	require.True(t, result.Success)
+
+	events, err := executor.LoadOutputJSONL("test-jsonl", 1)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	require.Equal(t, "stdout", events[0].Stream)
+	require.Equal(t, "out-one", events[0].Line)
+	require.Equal(t, "stderr", events[1].Stream)
+	require.Equal(t, "err-one", events[1].Line)
+	require.Equal(t, "stdout", events[2].Stream)
+	require.Equal(t, "out-two", events[2].Line)
+
+	// Event timestamps should be non-decreasing.
+	for i := 1; i < len(events); i++ {
+		require.False(t, events[i].Time.Before(events[i-1].Time))
+	}
+
+	// The combined output log is still written alongside the events.
+	out, err := executor.LoadOutput("test-jsonl", 1, "")
+	require.NoError(t, err)
+	require.Contains(t, string(out), "out-one\n")
+	require.Contains(t, string(out), "err-one\n")
+
+	// Executions without the option enabled have no events to load.
+	plainExecutor := newTestExecutor(t)
+	result = plainExecutor.Exec(types.ExecScript{
+		Type:   "test-jsonl",
+		ID:     2,
+		Script: "echo hello",
+	})
+	require.True(t, result.Success)
+	_, err = plainExecutor.LoadOutputJSONL("test-jsonl", 2)
+	require.True(t, trace.IsNotFound(err))
+}
+
+func TestLoadScriptChecksum(t *testing.T) {
+	t.Parallel()
+	executor := newTestExecutor(t)
+
+	script := "echo hello"
+	result := executor.Exec(types.ExecScript{
+		Type:   "test-checksum",
+		ID:     1,
+		Script: script,
+	})
+	require.True(t, result.Success)
+
+	// An intact script should load and match the original body.
+	loaded, err := executor.LoadScript("test-checksum", 1)
+	require.NoError(t, err)
+	require.Equal(t, script, string(loaded))
+
+	// A corrupted script file should fail the checksum check.
+	scriptPath := filepath.Join(executor.cfg.Dir, "test-checksum-1", scriptFileName)
+	require.NoError(t, os.WriteFile(scriptPath, []byte("echo tampered"), 0600))
+	_, err = executor.LoadScript("test-checksum", 1)
+	require.True(t, trace.IsCompareFailed(err), "expected compare failed error, got %v", err)
+}
+
+func TestExecutorMaxConcurrent(t *testing.T) {
+	t.Parallel()
+	executor, err := NewExecutor(ExecutorConfig{
+		Dir:           t.TempDir(),
+		MaxConcurrent: 2,
+	})
+	require.NoError(t, err)
+
+	// Each execution marks itself as running with a marker file for the
+	// duration of its sleep, so the number of concurrently running scripts
+	// can be observed by counting markers.
+	markDir := t.TempDir()
+
+	var maxSeen int
+	stop := make(chan struct{})
+	pollerDone := make(chan struct{})
+	go func() {
+		defer close(pollerDone)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond * 5):
+			}
+			if entries, err := os.ReadDir(markDir); err == nil && len(entries) > maxSeen {
+				maxSeen = len(entries)
+			}
+		}
+	}()
+
+	const total = 5
+	for i := uint64(1); i <= total; i++ {
+		_, err := executor.ExecAsync(types.ExecScript{
+			Type:   "test-limit",
+			ID:     i,
+			Script: "touch \"$MARK_DIR/$1\"; sleep 0.2; rm \"$MARK_DIR/$1\"",
+			Args:   []string{fmt.Sprintf("mark-%d", i)},
+			Env:    map[string]string{"MARK_DIR": markDir},
+		})
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		for i := uint64(1); i <= total; i++ {
+			if _, err := executor.LoadResult("test-limit", i); err != nil {
+				return false
+			}
+		}
+		return true
+	}, time.Second*10, time.Millisecond*20)
+
+	close(stop)
+	<-pollerDone
+	require.Greater(t, maxSeen, 0)
+	require.LessOrEqual(t, maxSeen, 2)
+
+	// With FailWhenLimited, exceeding the limit fails immediately instead of
+	// blocking.
+	failExecutor, err := NewExecutor(ExecutorConfig{
+		Dir:             t.TempDir(),
+		MaxConcurrent:   1,
+		FailWhenLimited: true,
+	})
+	require.NoError(t, err)
+
+	_, err = failExecutor.ExecAsync(types.ExecScript{
+		Type:   "test-limit",
+		ID:     1,
+		Script: "sleep 1",
+	})
+	require.NoError(t, err)
+
+	_, err = failExecutor.ExecAsync(types.ExecScript{
+		Type:   "test-limit",
+		ID:     2,
+		Script: "echo hello",
+	})
+	require.True(t, trace.IsLimitExceeded(err))
+
+	result := failExecutor.Exec(types.ExecScript{
+		Type:   "test-limit",
+		ID:     3,
+		Script: "echo hello",
+	})
+	require.False(t, result.Success)
+	require.Contains(t, result.Error, "concurrent executions")
+}
+
+func TestExecutorSeparateStreams(t *testing.T) {
+	t.Parallel()
+	executor, err := NewExecutor(ExecutorConfig{
+		Dir:             t.TempDir(),
+		SeparateStreams: true,
+	})
+	require.NoError(t, err)
+
+	result := executor.Exec(types.ExecScript{
+		Type:   "test-streams",
+		ID:     1,
+		Script: "echo out-line; echo err-line >&2",
+	})
+	require.True(t, result.Success)
+
+	// Each stream's file should contain only its own output.
+	out, err := executor.LoadOutput("test-streams", 1, "stdout")
+	require.NoError(t, err)
+	require.Equal(t, "out-line\n", string(out))
+
+	errOut, err := executor.LoadOutput("test-streams", 1, "stderr")
+	require.NoError(t, err)
+	require.Equal(t, "err-line\n", string(errOut))
+
+	// No combined log is written in separate-streams mode.
+	_, err = executor.LoadOutput("test-streams", 1, "")
+	require.True(t, trace.IsNotFound(err))
+
+	// Unknown stream names are rejected.
+	_, err = executor.LoadOutput("test-streams", 1, "bogus")
+	require.True(t, trace.IsBadParameter(err))
+}
+
+func TestStreamOutput(t *testing.T) {
+	t.Parallel()
+	executor := newTestExecutor(t)
+
+	// Run asynchronously so that output can be streamed while it is written.
+	resultCh := make(chan types.ExecScriptResult, 1)
+	go func() {
+		resultCh <- executor.Exec(types.ExecScript{
+			Type:   "test-stream",
+			ID:     1,
+			Script: "echo one; sleep 0.5; echo two; sleep 0.5; echo three",
+		})
+	}()
+
+	// Wait for the output file to appear.
+	var stream io.ReadCloser
+	require.Eventually(t, func() bool {
+		var err error
+		stream, err = executor.StreamOutput("test-stream", 1)
+		return err == nil
+	}, time.Second*5, time.Millisecond*10)
+	defer stream.Close()
+
+	reader := bufio.NewReader(stream)
+	readLine := func() string {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		return line
+	}
+
+	// The first line should arrive while the script is still running.
+	require.Equal(t, "one\n", readLine())
+	_, err := executor.LoadResult("test-stream", 1)
+	require.True(t, trace.IsNotFound(err))
+
+	require.Equal(t, "two\n", readLine())
+	require.Equal(t, "three\n", readLine())
+
+	// Once the result is persisted, the stream should report EOF.
+	_, err = reader.ReadString('\n')
+	require.ErrorIs(t, err, io.EOF)
+
+	result := <-resultCh
+	require.True(t, result.Success)
+}
+
+func TestListExecutions(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	executor, err := NewExecutor(ExecutorConfig{Dir: dir})
+	require.NoError(t, err)
+
+	// Valid execution directories, created out of order.
+	for _, name := range []string{"test-run-7", "install-2", "install-1"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0700))
+	}
+
+	// Junk entries that should be ignored: an unparseable directory, a
+	// directory with a non-numeric id, and a parseable name that is a file.
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "notaref"), 0700))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "install-abc"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "install-3"), []byte("junk"), 0600))
+
+	refs, err := executor.ListExecutions()
+	require.NoError(t, err)
+	require.Equal(t, []ref{
+		{etype: "install", id: 1},
+		{etype: "install", id: 2},
+		{etype: "test-run", id: 7},
+	}, refs)
+}
+
+func TestParseRef(t *testing.T) {
+	t.Parallel()
+
+	tts := []struct {
+		name  string
+		etype string
+		id    uint64
+		ok    bool
+	}{
+		{name: "install-1", etype: "install", id: 1, ok: true},
+		{name: "test-run-42", etype: "test-run", id: 42, ok: true},
+		{name: "install-", ok: false},
+		{name: "-1", ok: false},
+		{name: "install", ok: false},
+		{name: "install-abc", ok: false},
+	}
+
+	for _, tt := range tts {
+		parsed, err := parseRef(tt.name)
+		if !tt.ok {
+			require.Error(t, err, "name=%q", tt.name)
+			continue
+		}
+		require.NoError(t, err, "name=%q", tt.name)
+		require.Equal(t, ref{etype: tt.etype, id: tt.id}, parsed)
+		require.Equal(t, tt.name, parsed.String())
+	}
+}
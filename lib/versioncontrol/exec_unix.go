@@ -0,0 +1,60 @@
+//go:build !windows
+
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versioncontrol
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup configures the command to run in its own process group so
+// that the whole group can be signaled together.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Signal names recorded in execution results.
+const (
+	sigtermName = "SIGTERM"
+	sigkillName = "SIGKILL"
+)
+
+// terminateProcessGroup sends SIGTERM to the command's process group, falling
+// back to signaling just the command's process if the group can't be signaled.
+func terminateProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		cmd.Process.Signal(syscall.SIGTERM)
+	}
+}
+
+// killProcessGroup kills the command's process group, falling back to killing
+// just the command's process if the group can't be signaled.
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
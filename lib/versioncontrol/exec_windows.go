@@ -0,0 +1,50 @@
+//go:build windows
+
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versioncontrol
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows, where process groups are not used to
+// manage script children.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// Signal names recorded in execution results. Windows has no SIGTERM
+// equivalent, so both stop paths kill the process outright.
+const (
+	sigtermName = "SIGKILL"
+	sigkillName = "SIGKILL"
+)
+
+// terminateProcessGroup kills the command's process. Graceful termination is
+// not supported on Windows.
+func terminateProcessGroup(cmd *exec.Cmd) {
+	killProcessGroup(cmd)
+}
+
+// killProcessGroup kills the command's process. Processes spawned by the
+// script are not tracked on Windows.
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	cmd.Process.Kill()
+}
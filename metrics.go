@@ -264,4 +264,12 @@ const (
 	// MetricUsageEventsDropped is a count of events dropped due to the
 	// submission buffer reaching a length limit.
 	MetricUsageEventsDropped = "usage_events_dropped_total"
+
+	// MetricUsageEventsBuffered is the current number of events waiting in the
+	// batching buffer.
+	MetricUsageEventsBuffered = "usage_events_buffered"
+
+	// MetricUsageBatchesQueued is the current number of batches waiting in the
+	// submission queue.
+	MetricUsageBatchesQueued = "usage_batches_queued"
 )